@@ -0,0 +1,493 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// API 中用掩码代替已设置的密钥，PATCH 时收到掩码表示不修改
+const apiSecretMask = "********"
+
+// apiAuth 优先使用 Authorization: Bearer 令牌，没有令牌时和 checklogin 使用相同的会话，
+// 未登录时返回 401 而不是跳转登录页
+func apiAuth(c *gin.Context) {
+	if header := c.GetHeader("Authorization"); header != "" {
+		scheme, token, _ := strings.Cut(header, " ")
+		if !strings.EqualFold(scheme, "Bearer") {
+			apiError(c, http.StatusUnauthorized, errors.New("authorization must use the Bearer scheme"))
+			return
+		}
+
+		record, err := authenticateAPIToken(strings.TrimSpace(token))
+		if err != nil {
+			apiError(c, http.StatusUnauthorized, err)
+			return
+		}
+		// 只读令牌只能发起不修改数据的请求
+		if record.Scope != apiScopeWrite && !isReadMethod(c.Request.Method) {
+			apiError(c, http.StatusForbidden, errors.New("token is read-only"))
+			return
+		}
+
+		c.Set("email", record.Email)
+	} else {
+		email, err := requestEmail(c.Request)
+		if err != nil {
+			apiError(c, http.StatusUnauthorized, errors.New("authentication required"))
+			return
+		}
+		c.Set("email", email)
+	}
+
+	if !isReadMethod(c.Request.Method) && !userCanWrite(c.GetString("email")) {
+		apiError(c, http.StatusForbidden, errors.New("account is read-only"))
+		return
+	}
+	c.Next()
+}
+
+// apiError 所有 API 错误都返回 {"error": "..."}，和 /api/search 一致
+func apiError(c *gin.Context, status int, err error) {
+	c.AbortWithStatusJSON(status, gin.H{"error": err.Error()})
+}
+
+func registerAPIRoutes(api *gin.RouterGroup) {
+	api.GET("/openapi.yaml", func(c *gin.Context) {
+		doc, _ := assetFs.ReadFile("assets/openapi.yaml")
+		c.Data(http.StatusOK, "application/yaml", doc)
+	})
+
+	api.GET("/feeds", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"feeds": getFeeds(c.GetString("email"))})
+	})
+
+	api.POST("/feeds", func(c *gin.Context) {
+		email := c.GetString("email")
+
+		var req struct {
+			URL string `json:"url"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil || req.URL == "" {
+			apiError(c, http.StatusBadRequest, errors.New("url is required"))
+			return
+		}
+
+		feeds, err := discoverFeeds(c.Request.Context(), req.URL)
+		if err != nil {
+			apiError(c, http.StatusBadGateway, err)
+			return
+		}
+		// 和网页一样，站点声明了多个 feed 时由调用方选择具体的地址
+		if len(feeds) > 1 {
+			candidates := make([]gin.H, 0, len(feeds))
+			for _, feed := range feeds {
+				candidates = append(candidates, gin.H{"url": feed.URL, "title": feed.Title, "type": feed.Type})
+			}
+			c.AbortWithStatusJSON(http.StatusMultipleChoices, gin.H{
+				"error": "multiple feeds found, subscribe to one of them",
+				"feeds": candidates,
+			})
+			return
+		}
+
+		feedID, err := addFeedAndCreateArticles(feeds[0], email)
+		if err != nil {
+			apiError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		c.JSON(http.StatusCreated, getFeed(strconv.FormatInt(feedID, 10), email))
+	})
+
+	api.GET("/feeds/:id", func(c *gin.Context) {
+		feed, ok := apiFeed(c)
+		if !ok {
+			return
+		}
+		c.JSON(http.StatusOK, feed)
+	})
+
+	api.PATCH("/feeds/:id", func(c *gin.Context) {
+		email := c.GetString("email")
+		feed, ok := apiFeed(c)
+		if !ok {
+			return
+		}
+
+		var req struct {
+			HideUnread        *bool   `json:"hide_unread"`
+			EnableReadability *bool   `json:"enable_readability"`
+			Highlight         *bool   `json:"highlight"`
+			RefreshInterval   *int    `json:"refresh_interval"`
+			Categories        *string `json:"categories"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			apiError(c, http.StatusBadRequest, fmt.Errorf("invalid body: %v", err))
+			return
+		}
+
+		// 未传的字段保持原值
+		hideUnread, enableReadability, highlight, refreshInterval := feed.HideUnread, feed.EnableReadability, feed.Highlight, feed.RefreshInterval
+		if req.HideUnread != nil {
+			hideUnread = *req.HideUnread
+		}
+		if req.EnableReadability != nil {
+			enableReadability = *req.EnableReadability
+		}
+		if req.Highlight != nil {
+			highlight = *req.Highlight
+		}
+		if req.RefreshInterval != nil {
+			refreshInterval = *req.RefreshInterval
+		}
+
+		id := c.Param("id")
+		if err := updateFeed(email, id, hideUnread, enableReadability, highlight, refreshInterval); err != nil {
+			status := http.StatusInternalServerError
+			if err == errInvalidRefreshInterval {
+				status = http.StatusBadRequest
+			}
+			apiError(c, status, err)
+			return
+		}
+		if req.Categories != nil {
+			if err := updateFeedCategory(email, id, *req.Categories); err != nil {
+				apiError(c, http.StatusInternalServerError, err)
+				return
+			}
+		}
+
+		c.JSON(http.StatusOK, getFeed(id, email))
+	})
+
+	api.DELETE("/feeds/:id", func(c *gin.Context) {
+		if _, ok := apiFeed(c); !ok {
+			return
+		}
+
+		deleteFeed(c.GetString("email"), c.Param("id"))
+		c.Status(http.StatusNoContent)
+	})
+
+	api.POST("/feeds/:id/refresh", func(c *gin.Context) {
+		if _, ok := apiFeed(c); !ok {
+			return
+		}
+
+		email, id := c.GetString("email"), c.Param("id")
+		refreshFeed(email, id)
+		c.JSON(http.StatusOK, getFeed(id, email))
+	})
+
+	api.GET("/articles", func(c *gin.Context) {
+		articles, next, err := apiListArticles(c)
+		if err != nil {
+			apiError(c, http.StatusBadRequest, err)
+			return
+		}
+		if articles == nil {
+			articles = []Article{}
+		}
+
+		c.JSON(http.StatusOK, gin.H{"articles": articles, "next": next})
+	})
+
+	api.GET("/articles/:uid", func(c *gin.Context) {
+		article, err := getArticle(c.Param("uid"), c.GetString("email"))
+		if err != nil {
+			apiError(c, http.StatusNotFound, errors.New("article not found"))
+			return
+		}
+		c.JSON(http.StatusOK, article)
+	})
+
+	api.PATCH("/articles/:uid", func(c *gin.Context) {
+		email, uid := c.GetString("email"), c.Param("uid")
+
+		var req struct {
+			Read     *bool `json:"read"`
+			Favorite *bool `json:"favorite"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			apiError(c, http.StatusBadRequest, fmt.Errorf("invalid body: %v", err))
+			return
+		}
+		if _, err := getArticle(uid, email); err != nil {
+			apiError(c, http.StatusNotFound, errors.New("article not found"))
+			return
+		}
+
+		if req.Read != nil {
+			if err := setArticleRead(uid, email, *req.Read); err != nil {
+				apiError(c, http.StatusInternalServerError, err)
+				return
+			}
+		}
+		if req.Favorite != nil {
+			if err := setArticleFavorite(uid, email, *req.Favorite); err != nil {
+				apiError(c, http.StatusInternalServerError, err)
+				return
+			}
+		}
+
+		article, _ := getArticle(uid, email)
+		c.JSON(http.StatusOK, article)
+	})
+
+	api.DELETE("/articles/:uid", func(c *gin.Context) {
+		email, uid := c.GetString("email"), c.Param("uid")
+
+		if _, err := getArticle(uid, email); err != nil {
+			apiError(c, http.StatusNotFound, errors.New("article not found"))
+			return
+		}
+		if err := deleteArticle(uid, email); err != nil {
+			apiError(c, http.StatusInternalServerError, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	})
+
+	api.POST("/articles/bulk", func(c *gin.Context) {
+		var req struct {
+			Action        string   `json:"action"`
+			Scope         string   `json:"scope"`
+			Uids          []string `json:"uids"`
+			FeedID        int64    `json:"feed_id"`
+			Category      string   `json:"category"`
+			ShowHidden    bool     `json:"show_hidden"`
+			OlderThanDays int      `json:"older_than_days"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			apiError(c, http.StatusBadRequest, fmt.Errorf("invalid body: %v", err))
+			return
+		}
+
+		record, err := bulkUpdateArticles(c.GetString("email"), req.Action, BulkTarget{
+			Scope:         req.Scope,
+			Uids:          req.Uids,
+			FeedID:        strconv.FormatInt(req.FeedID, 10),
+			Category:      req.Category,
+			ShowHidden:    req.ShowHidden,
+			OlderThanDays: req.OlderThanDays,
+		})
+		if err != nil {
+			apiError(c, http.StatusBadRequest, err)
+			return
+		}
+		c.JSON(http.StatusOK, record)
+	})
+
+	api.POST("/articles/bulk/undo", func(c *gin.Context) {
+		record, err := undoBulkAction(c.GetString("email"))
+		if err != nil {
+			apiError(c, http.StatusBadRequest, err)
+			return
+		}
+		c.JSON(http.StatusOK, record)
+	})
+
+	api.GET("/categories", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"categories": getCategories(c.GetString("email"))})
+	})
+
+	api.POST("/categories", func(c *gin.Context) {
+		var req struct {
+			Name  string `json:"name"`
+			Color string `json:"color"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.Name) == "" {
+			apiError(c, http.StatusBadRequest, errors.New("name is required"))
+			return
+		}
+		if req.Color == "" {
+			req.Color = "#007bff"
+		}
+
+		if err := createCategory(req.Name, req.Color, c.GetString("email")); err != nil {
+			apiError(c, http.StatusConflict, err)
+			return
+		}
+		c.JSON(http.StatusCreated, gin.H{"name": req.Name, "color": req.Color})
+	})
+
+	api.DELETE("/categories/:name", func(c *gin.Context) {
+		if err := deleteCategory(c.GetString("email"), c.Param("name")); err != nil {
+			apiError(c, http.StatusBadRequest, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	})
+
+	api.GET("/preference", func(c *gin.Context) {
+		pref, err := getUserPreference(c.GetString("email"))
+		if err != nil {
+			apiError(c, http.StatusInternalServerError, err)
+			return
+		}
+		c.JSON(http.StatusOK, maskPreference(*pref))
+	})
+
+	api.PATCH("/preference", func(c *gin.Context) {
+		email := c.GetString("email")
+
+		pref, err := getUserPreference(email)
+		if err != nil {
+			apiError(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		// 请求体合并到当前设置上，未传的字段保持原值
+		updated := *pref
+		if err := c.ShouldBindJSON(&updated); err != nil {
+			apiError(c, http.StatusBadRequest, fmt.Errorf("invalid body: %v", err))
+			return
+		}
+		updated = mergePreference(*pref, updated, ownsSiteSettings(email))
+		if updated.CleanupExpiredDays <= 0 {
+			apiError(c, http.StatusBadRequest, errors.New("cleanup_expired_days must be positive"))
+			return
+		}
+
+		if err := updateUserPreference(email, &updated); err != nil {
+			apiError(c, http.StatusInternalServerError, err)
+			return
+		}
+		c.JSON(http.StatusOK, maskPreference(updated))
+	})
+
+	api.GET("/ai-summaries", func(c *gin.Context) {
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", "30"))
+		if err != nil || limit <= 0 || limit > 365 {
+			apiError(c, http.StatusBadRequest, errors.New("limit must be between 1 and 365"))
+			return
+		}
+
+		summaries, err := getAISummariesForUser(c.GetString("email"), limit)
+		if err != nil {
+			apiError(c, http.StatusInternalServerError, err)
+			return
+		}
+		if summaries == nil {
+			summaries = []AISummary{}
+		}
+		c.JSON(http.StatusOK, gin.H{"summaries": summaries})
+	})
+}
+
+// apiFeed 返回路径中的订阅，不存在时直接写入 404
+func apiFeed(c *gin.Context) (*Feed, bool) {
+	feed := getFeed(c.Param("id"), c.GetString("email"))
+	if feed.ID == 0 {
+		apiError(c, http.StatusNotFound, errors.New("feed not found"))
+		return nil, false
+	}
+	return feed, true
+}
+
+// apiListArticles 把过滤条件组合到同一个 keyset 分页查询上，没有 read 参数时收藏和保存搜索列出全部
+func apiListArticles(c *gin.Context) ([]Article, string, error) {
+	email, cursor := c.GetString("email"), c.Query("before")
+	if cursor != "" {
+		if _, _, ok := parseArticleCursor(cursor); !ok {
+			return nil, "", errors.New("invalid cursor")
+		}
+	}
+
+	read, filtered := "false", false
+	query := globalDB.Table("articles a").Where("a.email = ? AND a.deleted = ?", email, false)
+	if id, ok := c.GetQuery("saved_search"); ok {
+		search := getSavedSearch(email, id)
+		if search == nil {
+			return nil, "", errors.New("saved search not found")
+		}
+		var err error
+		if query, err = savedSearchArticleQuery(email, parseSearchQuery(search.Query)); err != nil {
+			return nil, "", err
+		}
+		read, filtered = "all", true
+	}
+	if _, ok := c.GetQuery("favorite"); ok {
+		if c.Query("favorite") != "true" {
+			return nil, "", errors.New("favorite only supports true")
+		}
+		query = query.Where("a.favorite = ?", true)
+		read, filtered = "all", true
+	}
+	if id, ok := c.GetQuery("feed_id"); ok {
+		if getFeed(id, email).ID == 0 {
+			return nil, "", errors.New("feed not found")
+		}
+		query = query.Where("a.feed_id = ?", id)
+		filtered = true
+	}
+	if category, ok := c.GetQuery("category"); ok {
+		feedIDs, err := getCategoryFeedIDs(email, category)
+		if err != nil {
+			return nil, "", err
+		}
+		if len(feedIDs) == 0 {
+			return []Article{}, "", nil
+		}
+		query = query.Where("a.feed_id IN ?", feedIDs)
+		filtered = true
+	}
+	// 没有任何过滤条件时和首页一样排除隐藏的订阅
+	if !filtered && c.Query("show_hidden") != "true" {
+		query = query.Where("a.feed_id NOT IN (?)", globalDB.Model(&Feed{}).Select("id").Where("email = ? AND hide_unread = ?", email, true))
+	}
+
+	if value, ok := c.GetQuery("read"); ok {
+		read = value
+	}
+	switch read {
+	case "true", "false":
+		query = query.Where("a.read = ?", read == "true")
+	case "all":
+	default:
+		return nil, "", errors.New("read must be true, false or all")
+	}
+
+	articles, next, err := findArticlePage(query, cursor)
+	if err != nil {
+		return nil, "", fmt.Errorf("could not get articles: %v", err)
+	}
+	return articles, next, nil
+}
+
+// maskPreference 隐藏已设置的密钥
+func maskPreference(pref UserPreference) UserPreference {
+	for _, secret := range []*string{&pref.SendCloudAPIKey, &pref.GitHubSecret, &pref.OpenAIAPIKey} {
+		if *secret != "" {
+			*secret = apiSecretMask
+		}
+	}
+	return pref
+}
+
+// mergePreference 保留不允许通过 API 修改的字段：身份字段、掩码密钥，以及非管理员的管理设置
+func mergePreference(current, updated UserPreference, isAdmin bool) UserPreference {
+	updated.ID, updated.Email, updated.CreateAt = current.ID, current.Email, current.CreateAt
+
+	if !isAdmin {
+		updated.EnableGitHubLogin = current.EnableGitHubLogin
+		updated.GitHubClientID, updated.GitHubSecret = current.GitHubClientID, current.GitHubSecret
+		updated.OpenAIAPIKey, updated.OpenAIEndpoint = current.OpenAIAPIKey, current.OpenAIEndpoint
+	}
+
+	for _, secret := range []struct{ dst, src *string }{
+		{&updated.SendCloudAPIKey, &current.SendCloudAPIKey},
+		{&updated.GitHubSecret, &current.GitHubSecret},
+		{&updated.OpenAIAPIKey, &current.OpenAIAPIKey},
+	} {
+		if *secret.dst == apiSecretMask {
+			*secret.dst = *secret.src
+		}
+	}
+	return updated
+}
@@ -0,0 +1,158 @@
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAPI(t *testing.T) {
+	db := useTestDB(t)
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+	registerAPIRoutes(r.Group("/api/v1", apiAuth))
+
+	// 没有启用 GitHub 登录时请求使用默认用户
+	email := DefaultEmail
+	feedID, err := getSetFeed("https://example.com/feed", email, "Example", 0)
+	if err != nil {
+		t.Fatalf("getSetFeed() error = %v", err)
+	}
+	id := strconv.FormatInt(feedID, 10)
+	articles := []Article{
+		{Uid: "a1", FeedID: feedID, Email: email, GUID: "a1", Title: "First", PublishAt: 2},
+		{Uid: "a2", FeedID: feedID, Email: email, GUID: "a2", Title: "Second", PublishAt: 1},
+	}
+	if err := db.Create(&articles).Error; err != nil {
+		t.Fatalf("create articles: %v", err)
+	}
+
+	call := func(method, path, body string, want int) map[string]json.RawMessage {
+		t.Helper()
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+		if w.Code != want {
+			t.Fatalf("%s %s = %d %s, want %d", method, path, w.Code, w.Body.String(), want)
+		}
+
+		var resp map[string]json.RawMessage
+		if w.Body.Len() > 0 && strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") {
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("%s %s: invalid json %s", method, path, w.Body.String())
+			}
+		}
+		return resp
+	}
+	decode := func(raw json.RawMessage, v interface{}) {
+		t.Helper()
+		if err := json.Unmarshal(raw, v); err != nil {
+			t.Fatalf("decode %s: %v", raw, err)
+		}
+	}
+
+	var feeds []Feed
+	decode(call("GET", "/api/v1/feeds", "", http.StatusOK)["feeds"], &feeds)
+	if len(feeds) != 1 || feeds[0].ID != feedID {
+		t.Fatalf("feeds = %+v", feeds)
+	}
+
+	// 只修改传入的字段
+	call("PATCH", "/api/v1/feeds/"+id, `{"hide_unread": true}`, http.StatusOK)
+	resp := call("PATCH", "/api/v1/feeds/"+id, `{"highlight": true, "categories": "Tech"}`, http.StatusOK)
+	var feed Feed
+	decode(resp["highlight"], &feed.Highlight)
+	decode(resp["hide_unread"], &feed.HideUnread)
+	decode(resp["categories"], &feed.Categories)
+	if !feed.Highlight || !feed.HideUnread || feed.Categories != "Tech" {
+		t.Fatalf("patched feed = %+v", feed)
+	}
+
+	var message string
+	decode(call("GET", "/api/v1/feeds/999", "", http.StatusNotFound)["error"], &message)
+	if message != "feed not found" {
+		t.Fatalf("error body = %q", message)
+	}
+	call("PATCH", "/api/v1/feeds/"+id, `{"refresh_interval": -1}`, http.StatusBadRequest)
+	call("PATCH", "/api/v1/feeds/"+id, `{"refresh_interval": 1}`, http.StatusBadRequest)
+	call("PATCH", "/api/v1/feeds/"+id, `{"refresh_interval": 30}`, http.StatusOK)
+
+	var list []Article
+	resp = call("GET", "/api/v1/articles?feed_id="+id, "", http.StatusOK)
+	decode(resp["articles"], &list)
+	if len(list) != 2 || list[0].Uid != "a1" {
+		t.Fatalf("articles = %+v", list)
+	}
+	call("GET", "/api/v1/articles?read=maybe", "", http.StatusBadRequest)
+	call("GET", "/api/v1/articles?before=bad", "", http.StatusBadRequest)
+
+	var article Article
+	decode(call("PATCH", "/api/v1/articles/a1", `{"read": true, "favorite": true}`, http.StatusOK)["read"], &article.Read)
+	if !article.Read {
+		t.Fatalf("article should be read")
+	}
+	decode(call("GET", "/api/v1/articles?category=Tech", "", http.StatusOK)["articles"], &list)
+	if len(list) != 1 || list[0].Uid != "a2" {
+		t.Fatalf("read articles should leave the unread list, got %+v", list)
+	}
+	decode(call("GET", "/api/v1/articles?favorite=true", "", http.StatusOK)["articles"], &list)
+	if len(list) != 1 || list[0].Uid != "a1" {
+		t.Fatalf("favorites = %+v", list)
+	}
+	decode(call("GET", "/api/v1/articles?feed_id="+id+"&category=Tech&read=true", "", http.StatusOK)["articles"], &list)
+	if len(list) != 1 || list[0].Uid != "a1" {
+		t.Fatalf("read articles of the feed = %+v", list)
+	}
+	decode(call("GET", "/api/v1/articles?category=Tech&read=all", "", http.StatusOK)["articles"], &list)
+	if len(list) != 2 {
+		t.Fatalf("all articles of the category = %+v", list)
+	}
+	decode(call("GET", "/api/v1/articles?favorite=true&read=false", "", http.StatusOK)["articles"], &list)
+	if len(list) != 0 {
+		t.Fatalf("unread favorites = %+v", list)
+	}
+
+	call("DELETE", "/api/v1/articles/a2", "", http.StatusNoContent)
+	call("GET", "/api/v1/articles/missing", "", http.StatusNotFound)
+
+	call("POST", "/api/v1/categories", `{"name": "Podcasts"}`, http.StatusCreated)
+	call("POST", "/api/v1/categories", `{"name": "Podcasts"}`, http.StatusConflict)
+	call("DELETE", "/api/v1/categories/Podcasts", "", http.StatusNoContent)
+
+	call("PATCH", "/api/v1/preference", `{"openai_api_key": "sk-secret", "read_on_scroll": true}`, http.StatusOK)
+	resp = call("PATCH", "/api/v1/preference", `{"openai_api_key": "********", "cleanup_expired_days": 10}`, http.StatusOK)
+	var key string
+	decode(resp["openai_api_key"], &key)
+	pref, _ := getUserPreference(email)
+	if key != apiSecretMask || pref.OpenAIAPIKey != "sk-secret" || !pref.ReadOnScroll || pref.CleanupExpiredDays != 10 {
+		t.Fatalf("preference = %+v, masked key %q", pref, key)
+	}
+
+	call("GET", "/api/v1/ai-summaries?limit=0", "", http.StatusBadRequest)
+	call("GET", "/api/v1/ai-summaries", "", http.StatusOK)
+	call("DELETE", "/api/v1/feeds/"+id, "", http.StatusNoContent)
+	call("GET", "/api/v1/feeds/"+id, "", http.StatusNotFound)
+}
+
+func TestMergePreference(t *testing.T) {
+	current := UserPreference{ID: 1, Email: "alice@example.com", OpenAIAPIKey: "sk-admin", SendCloudAPIKey: "send"}
+	updated := UserPreference{ID: 9, Email: "bob@example.com", OpenAIAPIKey: "sk-mine", SendCloudAPIKey: apiSecretMask, ReadOnScroll: true}
+
+	got := mergePreference(current, updated, false)
+	if got.ID != 1 || got.Email != "alice@example.com" {
+		t.Fatalf("identity fields should not change: %+v", got)
+	}
+	if got.OpenAIAPIKey != "sk-admin" {
+		t.Fatalf("non admin should not change admin settings: %+v", got)
+	}
+	if got.SendCloudAPIKey != "send" || !got.ReadOnScroll {
+		t.Fatalf("merged preference = %+v", got)
+	}
+}
@@ -0,0 +1,155 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 批量更新时每条语句最多带的 uid 数，避免超过数据库参数上限
+const bulkChunkSize = 500
+
+// bulkActions 是每种批量操作要修改的列和目标值，撤销时写回相反的值
+var bulkActions = map[string]struct {
+	column string
+	value  bool
+}{
+	"read":       {"read", true},
+	"unread":     {"read", false},
+	"favorite":   {"favorite", true},
+	"unfavorite": {"favorite", false},
+	"delete":     {"deleted", true},
+}
+
+// BulkTarget 描述批量操作作用的文章范围
+type BulkTarget struct {
+	Scope         string   // selected / unread / feed / category
+	Uids          []string // scope 为 selected 时使用
+	FeedID        string
+	Category      string
+	ShowHidden    bool // scope 为 unread 时是否包含隐藏的订阅
+	OlderThanDays int  // 大于 0 时只处理发布时间早于 N 天的文章
+}
+
+func bulkTargetQuery(tx *gorm.DB, email string, target BulkTarget) (*gorm.DB, error) {
+	query := tx.Model(&Article{}).Where("email = ? AND deleted = ?", email, false)
+
+	switch target.Scope {
+	case "selected":
+		if len(target.Uids) == 0 {
+			return nil, fmt.Errorf("no articles selected")
+		}
+		query = query.Where("uid IN ?", target.Uids)
+	case "unread":
+		query = query.Where("read = ?", false)
+		if !target.ShowHidden {
+			query = query.Where("feed_id NOT IN (?)", tx.Model(&Feed{}).Select("id").Where("email = ? AND hide_unread = ?", email, true))
+		}
+	case "feed":
+		if getFeed(target.FeedID, email).ID == 0 {
+			return nil, fmt.Errorf("feed %s not found", target.FeedID)
+		}
+		query = query.Where("read = ? AND feed_id = ?", false, target.FeedID)
+	case "category":
+		feedIDs, err := getCategoryFeedIDs(email, target.Category)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where("read = ? AND feed_id IN ?", false, append(feedIDs, 0))
+	default:
+		return nil, fmt.Errorf("unknown scope %q", target.Scope)
+	}
+
+	if target.OlderThanDays > 0 {
+		query = query.Where("publish_at < ?", time.Now().AddDate(0, 0, -target.OlderThanDays).Unix())
+	}
+	return query, nil
+}
+
+// bulkUpdateArticles 在一个事务内执行批量操作，只记录状态真正改变的文章，
+// 并替换掉用户上一次的撤销记录
+func bulkUpdateArticles(email, action string, target BulkTarget) (*BulkAction, error) {
+	change, ok := bulkActions[action]
+	if !ok {
+		return nil, fmt.Errorf("unknown action %q", action)
+	}
+
+	record := &BulkAction{Email: email, Action: action, CreateAt: time.Now().Unix()}
+	err := globalDB.Transaction(func(tx *gorm.DB) error {
+		query, err := bulkTargetQuery(tx, email, target)
+		if err != nil {
+			return err
+		}
+
+		var uids []string
+		if err := query.Where(change.column+" = ?", !change.value).Pluck("uid", &uids).Error; err != nil {
+			return fmt.Errorf("could not get articles: %v", err)
+		}
+		if err := updateArticleColumn(tx, email, uids, change.column, change.value); err != nil {
+			return err
+		}
+
+		data, err := json.Marshal(uids)
+		if err != nil {
+			return fmt.Errorf("could not encode uids: %v", err)
+		}
+		record.Uids, record.Count = string(data), len(uids)
+
+		if err := tx.Where("email = ?", email).Delete(&BulkAction{}).Error; err != nil {
+			return fmt.Errorf("could not clear bulk actions: %v", err)
+		}
+		if err := tx.Create(record).Error; err != nil {
+			return fmt.Errorf("could not save bulk action: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// undoBulkAction 撤销用户最近一次批量操作，撤销后记录被删除，不能重复撤销
+func undoBulkAction(email string) (*BulkAction, error) {
+	var record BulkAction
+	err := globalDB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("email = ?", email).Order("id desc").First(&record).Error; err != nil {
+			return fmt.Errorf("nothing to undo")
+		}
+
+		change, ok := bulkActions[record.Action]
+		if !ok {
+			return fmt.Errorf("unknown action %q", record.Action)
+		}
+
+		var uids []string
+		if err := json.Unmarshal([]byte(record.Uids), &uids); err != nil {
+			return fmt.Errorf("could not decode uids: %v", err)
+		}
+		if err := updateArticleColumn(tx, email, uids, change.column, !change.value); err != nil {
+			return err
+		}
+
+		if err := tx.Delete(&record).Error; err != nil {
+			return fmt.Errorf("could not delete bulk action: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+func updateArticleColumn(tx *gorm.DB, email string, uids []string, column string, value bool) error {
+	for start := 0; start < len(uids); start += bulkChunkSize {
+		end := min(start+bulkChunkSize, len(uids))
+		err := tx.Model(&Article{}).Where("email = ? AND uid IN ?", email, uids[start:end]).Update(column, value).Error
+		if err != nil {
+			return fmt.Errorf("could not update articles: %v", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package internal
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestBulkUpdateArticles(t *testing.T) {
+	db := useTestDB(t)
+	email := "alice@example.com"
+
+	techID, _ := getSetFeed("https://example.com/tech", email, "Tech", 0)
+	newsID, _ := getSetFeed("https://example.com/news", email, "News", 0)
+	if err := updateFeedCategory(email, strconv.FormatInt(techID, 10), "Tech"); err != nil {
+		t.Fatalf("updateFeedCategory() error = %v", err)
+	}
+
+	now := time.Now()
+	articles := []Article{
+		{Uid: "t1", FeedID: techID, Email: email, GUID: "t1", PublishAt: now.Unix()},
+		{Uid: "t2", FeedID: techID, Email: email, GUID: "t2", PublishAt: now.AddDate(0, 0, -10).Unix()},
+		{Uid: "n1", FeedID: newsID, Email: email, GUID: "n1", PublishAt: now.Unix()},
+		{Uid: "n2", FeedID: newsID, Email: email, GUID: "n2", PublishAt: now.AddDate(0, 0, -10).Unix(), Read: true},
+		{Uid: "b1", FeedID: newsID, Email: "bob@example.com", GUID: "b1", PublishAt: now.Unix()},
+	}
+	if err := db.Create(&articles).Error; err != nil {
+		t.Fatalf("create articles: %v", err)
+	}
+
+	read := func() map[string]bool {
+		var got []Article
+		db.Find(&got)
+		states := make(map[string]bool)
+		for _, article := range got {
+			states[article.Uid] = article.Read
+		}
+		return states
+	}
+
+	// 只改动状态真正变化的文章，已读的 n2 不会记录在撤销里
+	record, err := bulkUpdateArticles(email, "read", BulkTarget{Scope: "unread", OlderThanDays: 7})
+	if err != nil || record.Count != 1 {
+		t.Fatalf("mark older read = %+v, %v", record, err)
+	}
+	if states := read(); !states["t2"] || states["t1"] || states["n1"] {
+		t.Fatalf("older than filter = %v", states)
+	}
+
+	record, err = bulkUpdateArticles(email, "read", BulkTarget{Scope: "category", Category: "Tech"})
+	if err != nil || record.Count != 1 {
+		t.Fatalf("mark category read = %+v, %v", record, err)
+	}
+	record, err = bulkUpdateArticles(email, "read", BulkTarget{Scope: "feed", FeedID: strconv.FormatInt(newsID, 10)})
+	if err != nil || record.Count != 1 {
+		t.Fatalf("mark feed read = %+v, %v", record, err)
+	}
+	if states := read(); !states["t1"] || !states["n1"] || states["b1"] {
+		t.Fatalf("other users should not be touched: %v", states)
+	}
+
+	// 撤销只回滚最近一次操作
+	if _, err := undoBulkAction(email); err != nil {
+		t.Fatalf("undoBulkAction() error = %v", err)
+	}
+	if states := read(); !states["t1"] || states["n1"] || !states["n2"] {
+		t.Fatalf("undo = %v", states)
+	}
+	if _, err := undoBulkAction(email); err == nil {
+		t.Fatalf("undo twice should fail")
+	}
+
+	if _, err := bulkUpdateArticles(email, "delete", BulkTarget{Scope: "selected", Uids: []string{"t1", "b1"}}); err != nil {
+		t.Fatalf("delete selected error = %v", err)
+	}
+	var deleted int64
+	db.Model(&Article{}).Where("deleted = ?", true).Count(&deleted)
+	if deleted != 1 {
+		t.Fatalf("deleted = %d, want 1", deleted)
+	}
+
+	for _, target := range []BulkTarget{{Scope: "selected"}, {Scope: "feed", FeedID: "999"}, {Scope: "everything"}} {
+		if _, err := bulkUpdateArticles(email, "read", target); err == nil {
+			t.Errorf("target %+v should be rejected", target)
+		}
+	}
+	if _, err := bulkUpdateArticles(email, "archive", BulkTarget{Scope: "unread"}); err == nil {
+		t.Errorf("unknown action should be rejected")
+	}
+}
+
+func TestPruneDropsBulkDeleteUndo(t *testing.T) {
+	db := useTestDB(t)
+	email := "alice@example.com"
+
+	feedID, _ := getSetFeed("https://example.com/feed", email, "Example", 0)
+	source := Source{URL: "https://example.com/feed", FetchedAt: 100}
+	db.Create(&source)
+	db.Model(&Feed{ID: feedID}).Update("source_id", source.ID)
+	entry := Entry{SourceID: source.ID, GUID: "a1", SeenAt: 50}
+	db.Create(&entry)
+	db.Create(&Article{Uid: "a1", FeedID: feedID, Email: email, GUID: "a1", EntryID: entry.ID})
+
+	if _, err := bulkUpdateArticles(email, "delete", BulkTarget{Scope: "selected", Uids: []string{"a1"}}); err != nil {
+		t.Fatalf("delete selected error = %v", err)
+	}
+
+	// entry 已经移出 feed，清理后撤销会恢复出没有内容的文章，因此撤销记录一并丢弃
+	pruneSharedStorage()
+	if _, err := undoBulkAction(email); err == nil {
+		t.Fatalf("undo after prune should fail")
+	}
+	var articles int64
+	if db.Model(&Article{}).Count(&articles); articles != 0 {
+		t.Fatalf("deleted article should be removed with its entry, got %d", articles)
+	}
+}
@@ -0,0 +1,152 @@
+package internal
+
+import (
+	"container/list"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DiskCache 是带总大小上限的磁盘缓存，超出上限时按最近最少使用淘汰。
+// 访问时会更新文件的修改时间，重启后按修改时间恢复 LRU 顺序
+type DiskCache struct {
+	mu       sync.Mutex
+	dir      string
+	maxBytes int64
+	size     int64
+	order    *list.List // 队首是最近使用的
+	items    map[string]*list.Element
+}
+
+type diskCacheEntry struct {
+	key  string
+	size int64
+}
+
+func NewDiskCache(dir string, maxBytes int64) (*DiskCache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("could not create cache dir: %v", err)
+	}
+
+	cache := &DiskCache{
+		dir:      dir,
+		maxBytes: maxBytes,
+		order:    list.New(),
+		items:    make(map[string]*list.Element),
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("could not read cache dir: %v", err)
+	}
+
+	type existing struct {
+		key     string
+		size    int64
+		modTime time.Time
+	}
+	var entries []existing
+	for _, file := range files {
+		info, err := file.Info()
+		if err != nil || !info.Mode().IsRegular() || filepath.Ext(file.Name()) == ".tmp" {
+			continue
+		}
+		entries = append(entries, existing{key: file.Name(), size: info.Size(), modTime: info.ModTime()})
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].modTime.After(entries[j].modTime) })
+	for _, e := range entries {
+		cache.items[e.key] = cache.order.PushBack(&diskCacheEntry{key: e.key, size: e.size})
+		cache.size += e.size
+	}
+
+	cache.mu.Lock()
+	cache.evictLocked()
+	cache.mu.Unlock()
+
+	return cache, nil
+}
+
+func (c *DiskCache) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+
+	path := filepath.Join(c.dir, key)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		c.removeLocked(elem)
+		return nil, false
+	}
+
+	c.order.MoveToFront(elem)
+	now := time.Now()
+	os.Chtimes(path, now, now)
+
+	return data, true
+}
+
+func (c *DiskCache) Set(key string, data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// 单个文件超过上限时不缓存
+	if int64(len(data)) > c.maxBytes {
+		return nil
+	}
+
+	path := filepath.Join(c.dir, key)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("could not write cache file: %v", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("could not rename cache file: %v", err)
+	}
+
+	if elem, ok := c.items[key]; ok {
+		entry := elem.Value.(*diskCacheEntry)
+		c.size += int64(len(data)) - entry.size
+		entry.size = int64(len(data))
+		c.order.MoveToFront(elem)
+	} else {
+		c.items[key] = c.order.PushFront(&diskCacheEntry{key: key, size: int64(len(data))})
+		c.size += int64(len(data))
+	}
+
+	c.evictLocked()
+	return nil
+}
+
+// Size 返回当前缓存占用的字节数
+func (c *DiskCache) Size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size
+}
+
+func (c *DiskCache) evictLocked() {
+	for c.size > c.maxBytes {
+		elem := c.order.Back()
+		if elem == nil {
+			return
+		}
+		c.removeLocked(elem)
+	}
+}
+
+func (c *DiskCache) removeLocked(elem *list.Element) {
+	entry := elem.Value.(*diskCacheEntry)
+	os.Remove(filepath.Join(c.dir, entry.key))
+	c.order.Remove(elem)
+	delete(c.items, entry.key)
+	c.size -= entry.size
+}
@@ -0,0 +1,192 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/html"
+)
+
+// 页面里没有声明 feed 时依次尝试的常见路径
+var feedProbePaths = []string{"/feed", "/rss", "/atom.xml", "/rss.xml", "/feed.xml", "/index.xml", "/feed.json"}
+
+// 自动发现时读取的页面大小上限
+const discoverMaxBodySize = 5 << 20
+
+var feedLinkTypes = map[string]string{
+	"application/rss+xml":   "RSS",
+	"application/atom+xml":  "Atom",
+	"application/feed+json": "JSON Feed",
+}
+
+type discoveredFeed struct {
+	URL   string
+	Title string
+	Type  string
+
+	// 发现过程中已经抓取并解析的结果，订阅时直接使用，不再请求一次
+	result *fetchResult
+}
+
+// discoverFeeds 返回地址对应的 feed：地址本身是 feed 时直接返回，
+// 否则从 HTML 的 <link rel="alternate"> 中查找，找不到再并发探测常见路径
+func discoverFeeds(ctx context.Context, pageURL string) ([]discoveredFeed, error) {
+	body, resp, err := fetchDiscoverPage(ctx, pageURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if feed, ok := parseDiscoveredFeed(pageURL, body, resp); ok {
+		return []discoveredFeed{feed}, nil
+	}
+
+	feeds := feedLinksFromHTML(body, resp.Request.URL)
+	if len(feeds) > 0 {
+		return feeds, nil
+	}
+
+	var probeURLs []string
+	seen := make(map[string]struct{})
+	for _, path := range feedProbePaths {
+		probeURL := resp.Request.URL.ResolveReference(&url.URL{Path: path}).String()
+		if _, dup := seen[probeURL]; dup {
+			continue
+		}
+		seen[probeURL] = struct{}{}
+		probeURLs = append(probeURLs, probeURL)
+	}
+
+	// 所有探测共用一个超时，按 feedProbePaths 的顺序返回
+	probeCtx, cancel := context.WithTimeout(ctx, feedFetchTimeout)
+	defer cancel()
+
+	probed := make([]*discoveredFeed, len(probeURLs))
+	var wg sync.WaitGroup
+	for i, probeURL := range probeURLs {
+		wg.Add(1)
+		go func(i int, probeURL string) {
+			defer wg.Done()
+
+			body, resp, err := fetchDiscoverPage(probeCtx, probeURL)
+			if err != nil {
+				return
+			}
+			if feed, ok := parseDiscoveredFeed(probeURL, body, resp); ok {
+				probed[i] = &feed
+			}
+		}(i, probeURL)
+	}
+	wg.Wait()
+
+	for _, feed := range probed {
+		if feed != nil {
+			feeds = append(feeds, *feed)
+		}
+	}
+
+	if len(feeds) == 0 {
+		return nil, fmt.Errorf("no feed found at %s", pageURL)
+	}
+
+	return feeds, nil
+}
+
+// parseDiscoveredFeed 尝试把响应解析为 feed，成功时保留抓取结果
+func parseDiscoveredFeed(feedURL string, body []byte, resp *http.Response) (discoveredFeed, bool) {
+	feed, err := newFeedParser().Parse(bytes.NewReader(body))
+	if err != nil {
+		return discoveredFeed{}, false
+	}
+
+	return discoveredFeed{URL: feedURL, Title: feed.Title, Type: feed.FeedType, result: newFetchResult(resp, feed)}, true
+}
+
+// fetchDiscoverPage 返回页面内容和响应，响应的 Request.URL 是重定向后的最终地址
+func fetchDiscoverPage(ctx context.Context, pageURL string) ([]byte, *http.Response, error) {
+	ctx, cancel := context.WithTimeout(ctx, feedFetchTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pageURL, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not create request: %v", err)
+	}
+	req.Header.Set("User-Agent", feedUserAgent)
+
+	resp, err := feedHTTPClient.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not fetch %s: %v", pageURL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, nil, fmt.Errorf("unexpected status for %s: %s", pageURL, resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, discoverMaxBodySize))
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not read %s: %v", pageURL, err)
+	}
+
+	return body, resp, nil
+}
+
+// feedLinksFromHTML 提取 <link rel="alternate"> 中声明的 RSS/Atom/JSON Feed 地址，
+// 相对地址按 <base href> 或页面地址解析
+func feedLinksFromHTML(body []byte, base *url.URL) []discoveredFeed {
+	doc, err := html.Parse(bytes.NewReader(body))
+	if err != nil {
+		return nil
+	}
+
+	var feeds []discoveredFeed
+	seen := make(map[string]struct{})
+
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && (n.Data == "base" || n.Data == "link") {
+			attrs := make(map[string]string, len(n.Attr))
+			for _, attr := range n.Attr {
+				attrs[strings.ToLower(attr.Key)] = strings.TrimSpace(attr.Val)
+			}
+
+			if n.Data == "base" {
+				if href, err := base.Parse(attrs["href"]); err == nil && attrs["href"] != "" {
+					base = href
+				}
+			} else if hasRel(attrs["rel"], "alternate") {
+				mediaType := strings.ToLower(strings.TrimSpace(strings.Split(attrs["type"], ";")[0]))
+				kind, ok := feedLinkTypes[mediaType]
+				if ok && attrs["href"] != "" {
+					if href, err := base.Parse(attrs["href"]); err == nil {
+						if _, dup := seen[href.String()]; !dup {
+							seen[href.String()] = struct{}{}
+							feeds = append(feeds, discoveredFeed{URL: href.String(), Title: attrs["title"], Type: kind})
+						}
+					}
+				}
+			}
+		}
+
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+
+	return feeds
+}
+
+func hasRel(rel, want string) bool {
+	for _, r := range strings.Fields(rel) {
+		if strings.EqualFold(r, want) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,99 @@
+package internal
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDiscoverFeeds(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/blog/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<html><head>
+<link rel="alternate" type="application/rss+xml" title="Posts" href="posts.xml">
+<link rel="alternate" type="application/atom+xml; charset=utf-8" title="Comments" href="/comments.atom">
+<link rel="alternate" type="application/json" href="/wp-json/wp/v2/pages/1">
+<link rel="stylesheet" href="/style.css">
+</head><body></body></html>`))
+	})
+	mux.HandleFunc("/plain/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<html><head><title>No links</title></head></html>`))
+	})
+	mux.HandleFunc("/atom.xml", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(testRSS))
+	})
+	var directHits atomic.Int32
+	mux.HandleFunc("/direct.xml", func(w http.ResponseWriter, r *http.Request) {
+		directHits.Add(1)
+		w.Write([]byte(testRSS))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	feeds, err := discoverFeeds(context.Background(), server.URL+"/blog/")
+	if err != nil {
+		t.Fatalf("discoverFeeds(blog) error = %v", err)
+	}
+	if len(feeds) != 2 ||
+		feeds[0].URL != server.URL+"/blog/posts.xml" || feeds[0].Title != "Posts" || feeds[0].Type != "RSS" ||
+		feeds[1].URL != server.URL+"/comments.atom" || feeds[1].Type != "Atom" {
+		t.Fatalf("discoverFeeds(blog) = %+v", feeds)
+	}
+
+	feeds, err = discoverFeeds(context.Background(), server.URL+"/plain/")
+	if err != nil {
+		t.Fatalf("discoverFeeds(plain) error = %v", err)
+	}
+	if len(feeds) != 1 || feeds[0].URL != server.URL+"/atom.xml" || feeds[0].Title != "Test" {
+		t.Fatalf("discoverFeeds(plain) should probe common paths, got %+v", feeds)
+	}
+
+	feeds, err = discoverFeeds(context.Background(), server.URL+"/direct.xml")
+	if err != nil {
+		t.Fatalf("discoverFeeds(direct) error = %v", err)
+	}
+	if len(feeds) != 1 || feeds[0].URL != server.URL+"/direct.xml" {
+		t.Fatalf("discoverFeeds(direct) = %+v", feeds)
+	}
+
+	// 订阅时使用发现时的抓取结果，不再请求一次
+	useTestDB(t)
+	if _, err := addFeedAndCreateArticles(feeds[0], "alice@example.com"); err != nil {
+		t.Fatalf("addFeedAndCreateArticles() error = %v", err)
+	}
+	if hits := directHits.Load(); hits != 1 {
+		t.Fatalf("direct feed fetched %d times, want 1", hits)
+	}
+}
+
+func TestDiscoverFeedsProbesConcurrently(t *testing.T) {
+	delay := 300 * time.Millisecond
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			w.Write([]byte(`<html><head><title>No links</title></head></html>`))
+			return
+		}
+		time.Sleep(delay)
+		if r.URL.Path == "/index.xml" || r.URL.Path == "/rss" {
+			w.Write([]byte(testRSS))
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+
+	start := time.Now()
+	feeds, err := discoverFeeds(context.Background(), server.URL+"/")
+	if err != nil {
+		t.Fatalf("discoverFeeds() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed >= 3*delay {
+		t.Fatalf("probes should run concurrently, took %s", elapsed)
+	}
+	if len(feeds) != 2 || feeds[0].URL != server.URL+"/rss" || feeds[1].URL != server.URL+"/index.xml" {
+		t.Fatalf("probed feeds should keep the path order, got %+v", feeds)
+	}
+}
@@ -0,0 +1,164 @@
+package internal
+
+import (
+	"fmt"
+	"mime"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/log"
+	"github.com/mmcdole/gofeed"
+	"gorm.io/gorm/clause"
+)
+
+// saveEntryEnclosures 保存条目附带的媒体文件，只写入新增或有变化的记录
+func saveEntryEnclosures(entries []*Entry, items map[string]*gofeed.Item) error {
+	ids := make([]int64, 0, len(entries))
+	for _, entry := range entries {
+		ids = append(ids, entry.ID)
+	}
+	existing := getEntryEnclosures(ids)
+
+	var changed []Enclosure
+	for _, entry := range entries {
+		item := items[entry.GUID]
+		if item == nil {
+			continue
+		}
+
+		duration := 0
+		if item.ITunesExt != nil {
+			duration = parseITunesDuration(item.ITunesExt.Duration)
+		}
+
+		known := make(map[string]Enclosure, len(existing[entry.ID]))
+		for _, enclosure := range existing[entry.ID] {
+			known[enclosure.URL] = enclosure
+		}
+
+		for _, e := range item.Enclosures {
+			if e == nil || strings.TrimSpace(e.URL) == "" {
+				continue
+			}
+
+			enclosure := Enclosure{
+				EntryID:  entry.ID,
+				URL:      strings.TrimSpace(e.URL),
+				MimeType: enclosureMimeType(e.Type, e.URL),
+				Duration: duration,
+			}
+			enclosure.Length, _ = strconv.ParseInt(strings.TrimSpace(e.Length), 10, 64)
+
+			if old, ok := known[enclosure.URL]; ok {
+				enclosure.ID = old.ID
+				if old == enclosure {
+					continue
+				}
+			}
+			changed = append(changed, enclosure)
+		}
+	}
+
+	if len(changed) == 0 {
+		return nil
+	}
+
+	err := globalDB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "entry_id"}, {Name: "url"}},
+		DoUpdates: clause.AssignmentColumns([]string{"mime_type", "length", "duration"}),
+	}).Omit("id").Create(&changed).Error
+	if err != nil {
+		return fmt.Errorf("could not save enclosures: %v", err)
+	}
+
+	return nil
+}
+
+func getEntryEnclosures(entryIDs []int64) map[int64][]Enclosure {
+	result := make(map[int64][]Enclosure)
+	for start := 0; start < len(entryIDs); start += 500 {
+		end := min(start+500, len(entryIDs))
+
+		var enclosures []Enclosure
+		if err := globalDB.Where("entry_id IN ?", entryIDs[start:end]).Order("id").Find(&enclosures).Error; err != nil {
+			log.Errorf("could not load enclosures: %v", err)
+			return result
+		}
+		for _, enclosure := range enclosures {
+			result[enclosure.EntryID] = append(result[enclosure.EntryID], enclosure)
+		}
+	}
+	return result
+}
+
+// enclosureMediaKind 返回可以直接播放的媒体类型 audio / video，其他类型返回空字符串
+func enclosureMediaKind(mimeType string) string {
+	kind, _, _ := strings.Cut(mimeType, "/")
+	if kind == "audio" || kind == "video" {
+		return kind
+	}
+	return ""
+}
+
+// episodeEnclosureIndex 返回第一个可播放附件的下标，播放进度保存在这个播放器上，没有时返回 -1
+func episodeEnclosureIndex(enclosures []Enclosure) int {
+	for i, enclosure := range enclosures {
+		if enclosureMediaKind(enclosure.MimeType) != "" {
+			return i
+		}
+	}
+	return -1
+}
+
+// enclosureMimeType 在 feed 没有给出 type 时按文件扩展名猜测
+func enclosureMimeType(mimeType, rawURL string) string {
+	if mimeType = strings.TrimSpace(mimeType); mimeType != "" {
+		return strings.ToLower(mimeType)
+	}
+
+	ext := path.Ext(strings.SplitN(strings.SplitN(rawURL, "?", 2)[0], "#", 2)[0])
+	if ext == "" {
+		return ""
+	}
+	if mimeType, _, err := mime.ParseMediaType(mime.TypeByExtension(strings.ToLower(ext))); err == nil {
+		return mimeType
+	}
+	return ""
+}
+
+// parseITunesDuration 解析 itunes:duration，支持 HH:MM:SS、MM:SS 和纯秒数
+func parseITunesDuration(raw string) int {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return 0
+	}
+
+	parts := strings.Split(raw, ":")
+	if len(parts) > 3 {
+		return 0
+	}
+
+	total := 0
+	for _, part := range parts {
+		// 部分 feed 的秒数带小数
+		value, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil || value < 0 {
+			return 0
+		}
+		total = total*60 + int(value)
+	}
+	return total
+}
+
+func updatePlaybackPosition(uid, email string, position int) error {
+	if position < 0 {
+		position = 0
+	}
+
+	err := globalDB.Model(&Article{}).Where("uid = ? AND email = ?", uid, email).Update("playback_position", position).Error
+	if err != nil {
+		return fmt.Errorf("could not update playback position: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseITunesDuration(t *testing.T) {
+	tests := map[string]int{
+		"":        0,
+		"95":      95,
+		"12:34":   754,
+		"1:02:03": 3723,
+		"61.5":    61,
+		"abc":     0,
+		"1:2:3:4": 0,
+		" 00:45 ": 45,
+	}
+
+	for raw, want := range tests {
+		if got := parseITunesDuration(raw); got != want {
+			t.Errorf("parseITunesDuration(%q) = %d, want %d", raw, got, want)
+		}
+	}
+}
+
+func TestEpisodeEnclosureIndex(t *testing.T) {
+	// 第一个附件是封面图时，进度保存在后面的音频上
+	enclosures := []Enclosure{{MimeType: "image/jpeg"}, {MimeType: "audio/mpeg"}, {MimeType: "video/mp4"}}
+	if got := episodeEnclosureIndex(enclosures); got != 1 {
+		t.Fatalf("episodeEnclosureIndex() = %d, want 1", got)
+	}
+	if got := episodeEnclosureIndex([]Enclosure{{MimeType: "application/pdf"}}); got != -1 {
+		t.Fatalf("episodeEnclosureIndex() without media = %d, want -1", got)
+	}
+}
+
+func TestSaveEnclosuresAndPlaybackPosition(t *testing.T) {
+	db := useTestDB(t)
+
+	pub := time.Now().UTC().Format(time.RFC1123Z)
+	feed, err := newFeedParser().ParseString(`<?xml version="1.0"?>
+<rss version="2.0" xmlns:itunes="http://www.itunes.com/dtds/podcast-1.0.dtd">
+<channel>
+  <title>Podcast</title>
+  <item>
+    <guid>ep-1</guid>
+    <title>Episode 1</title>
+    <link>https://example.com/ep-1</link>
+    <pubDate>` + pub + `</pubDate>
+    <enclosure url="https://example.com/ep-1.mp3" length="12345" type="audio/mpeg"/>
+    <enclosure url="https://example.com/ep-1.mp4" length="0" type=""/>
+    <itunes:duration>1:02:03</itunes:duration>
+  </item>
+</channel>
+</rss>`)
+	if err != nil {
+		t.Fatalf("parse feed: %v", err)
+	}
+
+	id, err := getSetFeed("https://example.com/podcast", "alice@example.com", "Podcast", 0)
+	if err != nil {
+		t.Fatalf("getSetFeed() error = %v", err)
+	}
+	var fd Feed
+	db.First(&fd, id)
+
+	// 重复抓取不应产生重复的媒体记录
+	for i := 0; i < 2; i++ {
+		if err := saveFeedGroupResult(fd.URL, []*Feed{&fd}, &fetchResult{Feed: feed}); err != nil {
+			t.Fatalf("saveFeedGroupResult() error = %v", err)
+		}
+	}
+
+	var count int64
+	db.Model(&Enclosure{}).Count(&count)
+	if count != 2 {
+		t.Fatalf("enclosures = %d, want 2", count)
+	}
+
+	got, _ := getRecentlyArticles("alice@example.com", false, "")
+	if len(got) != 1 || len(got[0].Enclosures) != 2 {
+		t.Fatalf("articles = %+v", got)
+	}
+	audio, video := got[0].Enclosures[0], got[0].Enclosures[1]
+	if audio.MimeType != "audio/mpeg" || audio.Length != 12345 || audio.Duration != 3723 {
+		t.Fatalf("audio enclosure = %+v", audio)
+	}
+	if !strings.HasPrefix(video.MimeType, "video/") {
+		t.Fatalf("video mime type should be guessed from extension, got %+v", video)
+	}
+
+	if err := updatePlaybackPosition(got[0].Uid, "alice@example.com", 754); err != nil {
+		t.Fatalf("updatePlaybackPosition() error = %v", err)
+	}
+	article, err := getArticle(got[0].Uid, "alice@example.com")
+	if err != nil || article.PlaybackPosition != 754 {
+		t.Fatalf("playback position = %d, err %v", article.PlaybackPosition, err)
+	}
+}
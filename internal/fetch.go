@@ -0,0 +1,622 @@
+package internal
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/mmcdole/gofeed"
+	"github.com/mmcdole/gofeed/atom"
+	"github.com/mmcdole/gofeed/rss"
+)
+
+const (
+	feedUserAgent = "RSSy/1.0 (+https://github.com/abcdlsj/rssy)"
+
+	feedFetchInterval = time.Hour
+	feedMinInterval   = 15 * time.Minute
+	feedMaxInterval   = 24 * time.Hour
+	feedMaxBackoff    = 24 * time.Hour
+)
+
+// feedRefreshIntervalOptions 是 feed 设置里可选的刷新间隔（分钟），0 表示自动
+var feedRefreshIntervalOptions = []int{0, 15, 30, 60, 180, 360, 720, 1440}
+
+var errInvalidRefreshInterval = fmt.Errorf("refresh_interval must be one of %v", feedRefreshIntervalOptions)
+
+func validRefreshInterval(minutes int) bool {
+	for _, option := range feedRefreshIntervalOptions {
+		if minutes == option {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	// 单个 feed 抓取的超时时间（秒）
+	feedFetchTimeout = time.Duration(orenvInt("FETCH_TIMEOUT", 30)) * time.Second
+	// 同时抓取的 feed 数量上限
+	feedFetchConcurrency = orenvInt("FETCH_CONCURRENCY", 8)
+	// 同一个 host 同时抓取的数量上限，避免压垮单个站点
+	feedFetchPerHost = orenvInt("FETCH_PER_HOST", 2)
+	// 每个用户每轮最多占用的抓取次数，避免单个账号占满抓取预算
+	feedFetchUserQuota = orenvInt("FETCH_USER_QUOTA", 100)
+
+	feedHTTPClient = &http.Client{}
+)
+
+type fetchResult struct {
+	Feed         *gofeed.Feed
+	StatusCode   int
+	NotModified  bool
+	ETag         string
+	LastModified string
+	Hub          string // WebSub hub，来自 Link 响应头或 feed 中的 rel="hub"
+	Topic        string // WebSub topic，即 feed 的 rel="self" 链接
+	Pushed       bool   // 内容由 hub 推送而来，不是主动抓取
+}
+
+// fetchFeed 使用上次响应的 ETag / Last-Modified 发起条件请求，
+// 304 时 NotModified 为 true 且 Feed 为空
+func fetchFeed(ctx context.Context, fd *Feed) (*fetchResult, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fd.URL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("could not create request: %v", err)
+	}
+
+	req.Header.Set("User-Agent", feedUserAgent)
+	if fd.ETag != "" {
+		req.Header.Set("If-None-Match", fd.ETag)
+	}
+	if fd.LastModified != "" {
+		req.Header.Set("If-Modified-Since", fd.LastModified)
+	}
+
+	resp, err := feedHTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch feed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	result := &fetchResult{
+		StatusCode:   resp.StatusCode,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	}
+
+	if resp.StatusCode == http.StatusNotModified {
+		// 304 可能不带校验头，沿用上次的值
+		if result.ETag == "" {
+			result.ETag = fd.ETag
+		}
+		if result.LastModified == "" {
+			result.LastModified = fd.LastModified
+		}
+		result.NotModified = true
+		return result, nil
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return result, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+
+	feed, err := newFeedParser().Parse(resp.Body)
+	if err != nil {
+		return result, fmt.Errorf("could not parse feed: %v", err)
+	}
+
+	return newFetchResult(resp, feed), nil
+}
+
+// newFetchResult 由成功的响应和解析出的 feed 构造抓取结果
+func newFetchResult(resp *http.Response, feed *gofeed.Feed) *fetchResult {
+	links := parseLinkHeader(resp.Header.Values("Link"))
+	return &fetchResult{
+		Feed:         feed,
+		StatusCode:   resp.StatusCode,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		Hub:          firstNonEmpty(links["hub"], feed.Custom["hub"]),
+		Topic:        firstNonEmpty(links["self"], feed.Custom["self"]),
+	}
+}
+
+func newFeedParser() *gofeed.Parser {
+	fp := gofeed.NewParser()
+	fp.RSSTranslator = &rssTranslator{}
+	fp.AtomTranslator = &atomTranslator{}
+	return fp
+}
+
+// parseLinkHeader 解析 HTTP Link 响应头，返回 rel 到 URL 的映射，同一个 rel 只取第一个
+func parseLinkHeader(values []string) map[string]string {
+	links := make(map[string]string)
+
+	for _, value := range values {
+		for _, part := range strings.Split(value, ",") {
+			segments := strings.Split(part, ";")
+			target := strings.TrimSpace(segments[0])
+			if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+				continue
+			}
+			target = strings.Trim(target, "<>")
+
+			for _, param := range segments[1:] {
+				key, val, ok := strings.Cut(strings.TrimSpace(param), "=")
+				if !ok || !strings.EqualFold(strings.TrimSpace(key), "rel") {
+					continue
+				}
+				for _, rel := range strings.Fields(strings.Trim(strings.TrimSpace(val), `"`)) {
+					rel = strings.ToLower(rel)
+					if _, exists := links[rel]; !exists {
+						links[rel] = target
+					}
+				}
+			}
+		}
+	}
+
+	return links
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// itemGUID 返回文章在 feed 内的去重键：优先 GUID，其次规范化链接，
+// 都没有时使用标题和内容的哈希
+func itemGUID(item *gofeed.Item) string {
+	if guid := strings.TrimSpace(item.GUID); guid != "" {
+		return guid
+	}
+
+	if link := normalizeItemLink(item.Link); link != "" {
+		return link
+	}
+
+	sum := sha1.Sum([]byte(item.Title + "\n" + item.Content))
+	return "sha1:" + hex.EncodeToString(sum[:])
+}
+
+// normalizeItemLink 去掉 fragment、utm 参数和默认端口，统一 scheme/host 大小写
+func normalizeItemLink(link string) string {
+	link = strings.TrimSpace(link)
+	if link == "" {
+		return ""
+	}
+
+	u, err := url.Parse(link)
+	if err != nil || u.Host == "" {
+		return link
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	if (u.Scheme == "http" && u.Port() == "80") || (u.Scheme == "https" && u.Port() == "443") {
+		u.Host = u.Hostname()
+	}
+	u.Fragment = ""
+
+	query := u.Query()
+	for key := range query {
+		if strings.HasPrefix(strings.ToLower(key), "utm_") {
+			query.Del(key)
+		}
+	}
+	u.RawQuery = query.Encode()
+
+	if len(u.Path) > 1 {
+		u.Path = strings.TrimSuffix(u.Path, "/")
+		u.RawPath = ""
+	}
+
+	return u.String()
+}
+
+const (
+	PublishSourcePublished = "published"
+	PublishSourceUpdated   = "updated"
+	PublishSourceFirstSeen = "first_seen"
+)
+
+// itemPublishTime 按 published -> updated -> 首次抓取时间 的顺序取文章时间，
+// 第二个返回值记录时间来源
+func itemPublishTime(item *gofeed.Item, firstSeen time.Time) (time.Time, string) {
+	if item.PublishedParsed != nil && !item.PublishedParsed.IsZero() {
+		return *item.PublishedParsed, PublishSourcePublished
+	}
+
+	if item.UpdatedParsed != nil && !item.UpdatedParsed.IsZero() {
+		return *item.UpdatedParsed, PublishSourceUpdated
+	}
+
+	return firstSeen, PublishSourceFirstSeen
+}
+
+// rssTranslator 在默认转换的基础上保留 RSS 的 <ttl> 以及 atom:link 中的 hub/self，
+// 通用 Feed 结构中没有这些字段
+type rssTranslator struct {
+	gofeed.DefaultRSSTranslator
+}
+
+func (t *rssTranslator) Translate(feed interface{}) (*gofeed.Feed, error) {
+	result, err := t.DefaultRSSTranslator.Translate(feed)
+	if err != nil {
+		return nil, err
+	}
+
+	rssFeed, ok := feed.(*rss.Feed)
+	if !ok {
+		return result, nil
+	}
+
+	if strings.TrimSpace(rssFeed.TTL) != "" {
+		setFeedCustom(result, "ttl", strings.TrimSpace(rssFeed.TTL))
+	}
+
+	for _, key := range []string{"atom", "atom10", "atom03"} {
+		for _, link := range rssFeed.Extensions[key]["link"] {
+			setFeedLinkRel(result, link.Attrs["rel"], link.Attrs["href"])
+		}
+	}
+
+	return result, nil
+}
+
+// atomTranslator 在默认转换的基础上保留 <link rel="hub"> 和 <link rel="self">
+type atomTranslator struct {
+	gofeed.DefaultAtomTranslator
+}
+
+func (t *atomTranslator) Translate(feed interface{}) (*gofeed.Feed, error) {
+	result, err := t.DefaultAtomTranslator.Translate(feed)
+	if err != nil {
+		return nil, err
+	}
+
+	if atomFeed, ok := feed.(*atom.Feed); ok {
+		for _, link := range atomFeed.Links {
+			setFeedLinkRel(result, link.Rel, link.Href)
+		}
+	}
+
+	return result, nil
+}
+
+func setFeedLinkRel(feed *gofeed.Feed, rel, href string) {
+	rel, href = strings.ToLower(strings.TrimSpace(rel)), strings.TrimSpace(href)
+	if (rel == "hub" || rel == "self") && href != "" && feed.Custom[rel] == "" {
+		setFeedCustom(feed, rel, href)
+	}
+}
+
+func setFeedCustom(feed *gofeed.Feed, key, value string) {
+	if feed.Custom == nil {
+		feed.Custom = make(map[string]string)
+	}
+	feed.Custom[key] = value
+}
+
+// feedRefreshInterval 返回 feed 的刷新间隔：手动设置优先，其次是根据发布频率计算的自动间隔。
+// 手动设置限制在 feedMinInterval 和 feedMaxInterval 之间，兼容校验之前保存的值
+func feedRefreshInterval(fd *Feed) time.Duration {
+	if fd.RefreshInterval > 0 {
+		return min(max(time.Duration(fd.RefreshInterval)*time.Minute, feedMinInterval), feedMaxInterval)
+	}
+
+	if fd.AutoRefreshInterval > 0 {
+		return time.Duration(fd.AutoRefreshInterval) * time.Minute
+	}
+
+	return feedFetchInterval
+}
+
+// adaptiveRefreshInterval 根据最近文章的平均发布间隔估算刷新间隔，
+// 以发布间隔的一半轮询，并且不低于 <ttl> / sy:updatePeriod 给出的间隔
+func adaptiveRefreshInterval(feed *gofeed.Feed) time.Duration {
+	interval := feedFetchInterval
+
+	times := make([]time.Time, 0, len(feed.Items))
+	for _, item := range feed.Items {
+		if item == nil {
+			continue
+		}
+		if publishAt, source := itemPublishTime(item, time.Time{}); source != PublishSourceFirstSeen {
+			times = append(times, publishAt)
+		}
+	}
+
+	if len(times) >= 2 {
+		sort.Slice(times, func(i, j int) bool { return times[i].After(times[j]) })
+		times = times[:min(len(times), 10)]
+
+		span := times[0].Sub(times[len(times)-1])
+		interval = span / time.Duration(len(times)-1) / 2
+	}
+
+	interval = max(interval, feedHintInterval(feed))
+
+	return min(max(interval, feedMinInterval), feedMaxInterval)
+}
+
+// feedHintInterval 解析 RSS <ttl> 和 sy:updatePeriod / sy:updateFrequency
+func feedHintInterval(feed *gofeed.Feed) time.Duration {
+	var hint time.Duration
+
+	if ttl, err := strconv.Atoi(feed.Custom["ttl"]); err == nil && ttl > 0 {
+		hint = time.Duration(ttl) * time.Minute
+	}
+
+	sy := feed.Extensions["sy"]
+	if len(sy["updatePeriod"]) == 0 {
+		return hint
+	}
+
+	var period time.Duration
+	switch strings.ToLower(strings.TrimSpace(sy["updatePeriod"][0].Value)) {
+	case "hourly":
+		period = time.Hour
+	case "daily":
+		period = 24 * time.Hour
+	case "weekly":
+		period = 7 * 24 * time.Hour
+	case "monthly":
+		period = 30 * 24 * time.Hour
+	case "yearly":
+		period = 365 * 24 * time.Hour
+	default:
+		return hint
+	}
+
+	frequency := 1
+	if len(sy["updateFrequency"]) > 0 {
+		if n, err := strconv.Atoi(strings.TrimSpace(sy["updateFrequency"][0].Value)); err == nil && n > 0 {
+			frequency = n
+		}
+	}
+
+	return max(hint, period/time.Duration(frequency))
+}
+
+// feedNextFetchAt 返回 feed 下一次可以被调度抓取的时间，
+// 连续失败时间隔按 2 的幂次增长，最长 feedMaxBackoff
+func feedNextFetchAt(fd *Feed) time.Time {
+	interval := feedRefreshInterval(fd)
+	if fd.ErrorCount > 0 {
+		base := interval
+		for i := 0; i < fd.ErrorCount && interval < feedMaxBackoff; i++ {
+			interval *= 2
+		}
+		interval = max(min(interval, feedMaxBackoff), base)
+	}
+
+	return time.Unix(fd.LastFetchedAt, 0).Add(interval)
+}
+
+type fetchSummary struct {
+	Total     int
+	Succeeded int
+	Failed    int
+	TimedOut  int
+	Skipped   int
+	Duration  time.Duration
+}
+
+func (s fetchSummary) String() string {
+	return fmt.Sprintf("total=%d succeeded=%d failed=%d timed_out=%d skipped=%d duration=%s",
+		s.Total, s.Succeeded, s.Failed, s.TimedOut, s.Skipped, s.Duration.Round(time.Millisecond))
+}
+
+type fetchOutcome int
+
+const (
+	fetchSucceeded fetchOutcome = iota
+	fetchFailed
+	fetchTimedOut
+	fetchSkipped
+)
+
+// hostLimiter 按 host 限制并发，每个 host 一个带缓冲的信号量
+type hostLimiter struct {
+	mu    sync.Mutex
+	limit int
+	sems  map[string]chan struct{}
+}
+
+func newHostLimiter(limit int) *hostLimiter {
+	return &hostLimiter{limit: limit, sems: make(map[string]chan struct{})}
+}
+
+func (l *hostLimiter) acquire(ctx context.Context, host string) bool {
+	l.mu.Lock()
+	sem, ok := l.sems[host]
+	if !ok {
+		sem = make(chan struct{}, l.limit)
+		l.sems[host] = sem
+	}
+	l.mu.Unlock()
+
+	select {
+	case sem <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (l *hostLimiter) release(host string) {
+	l.mu.Lock()
+	sem := l.sems[host]
+	l.mu.Unlock()
+
+	<-sem
+}
+
+func feedHost(feedURL string) string {
+	u, err := url.Parse(feedURL)
+	if err != nil || u.Host == "" {
+		return feedURL
+	}
+	return u.Hostname()
+}
+
+// feedGroup 是订阅了同一个 URL 的所有 feed，每轮只抓取一次
+type feedGroup struct {
+	URL   string
+	Feeds []*Feed
+}
+
+// groupFeedsByURL 按 URL 合并订阅，并按最早到期时间排序，保证久未抓取的 URL 优先占用配额
+func groupFeedsByURL(feeds []Feed) []*feedGroup {
+	groups := make(map[string]*feedGroup)
+	order := make([]*feedGroup, 0, len(feeds))
+	for i := range feeds {
+		fd := &feeds[i]
+		if fd.ID == 0 || fd.URL == "" {
+			continue
+		}
+
+		group, ok := groups[fd.URL]
+		if !ok {
+			group = &feedGroup{URL: fd.URL}
+			groups[fd.URL] = group
+			order = append(order, group)
+		}
+		group.Feeds = append(group.Feeds, fd)
+	}
+
+	sort.SliceStable(order, func(i, j int) bool {
+		return order[i].nextFetchAt().Before(order[j].nextFetchAt())
+	})
+
+	return order
+}
+
+func (g *feedGroup) nextFetchAt() time.Time {
+	next := feedNextFetchAt(g.Feeds[0])
+	for _, fd := range g.Feeds[1:] {
+		if at := feedNextFetchAt(fd); at.Before(next) {
+			next = at
+		}
+	}
+	return next
+}
+
+// dueFeedGroupFilter 返回本轮的调度过滤器：任一订阅者到期即抓取，
+// 抓取计入到期订阅者中剩余配额最多的那个用户
+func dueFeedGroupFilter(now time.Time, quota int) func(*feedGroup) bool {
+	used := make(map[string]int)
+
+	return func(group *feedGroup) bool {
+		if now.Before(group.nextFetchAt()) {
+			return false
+		}
+
+		owner := ""
+		for _, fd := range group.Feeds {
+			if now.Before(feedNextFetchAt(fd)) || used[fd.Email] >= quota {
+				continue
+			}
+			if owner == "" || used[fd.Email] < used[owner] {
+				owner = fd.Email
+			}
+		}
+
+		if owner == "" {
+			return false
+		}
+
+		used[owner]++
+		return true
+	}
+}
+
+// runFetchCycle 使用有界的 worker pool 抓取 feed 分组，
+// shouldFetch 返回 false 的分组计为 skipped
+func runFetchCycle(ctx context.Context, groups []*feedGroup, shouldFetch func(*feedGroup) bool,
+	fetch func(context.Context, *feedGroup) error) fetchSummary {
+	start := time.Now()
+	summary := fetchSummary{Total: len(groups)}
+
+	jobs := make(chan *feedGroup)
+	outcomes := make(chan fetchOutcome, len(groups))
+	limiter := newHostLimiter(feedFetchPerHost)
+
+	var wg sync.WaitGroup
+	for i := 0; i < feedFetchConcurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for group := range jobs {
+				outcomes <- fetchOne(ctx, limiter, group, fetch)
+			}
+		}()
+	}
+
+	for _, group := range groups {
+		if len(group.Feeds) == 0 || !shouldFetch(group) {
+			outcomes <- fetchSkipped
+			continue
+		}
+		jobs <- group
+	}
+	close(jobs)
+	wg.Wait()
+	close(outcomes)
+
+	for outcome := range outcomes {
+		switch outcome {
+		case fetchSucceeded:
+			summary.Succeeded++
+		case fetchFailed:
+			summary.Failed++
+		case fetchTimedOut:
+			summary.TimedOut++
+		case fetchSkipped:
+			summary.Skipped++
+		}
+	}
+	summary.Duration = time.Since(start)
+
+	return summary
+}
+
+func fetchOne(ctx context.Context, limiter *hostLimiter, group *feedGroup,
+	fetch func(context.Context, *feedGroup) error) fetchOutcome {
+	host := feedHost(group.URL)
+	if !limiter.acquire(ctx, host) {
+		return fetchSkipped
+	}
+	defer limiter.release(host)
+
+	fetchCtx, cancel := context.WithTimeout(ctx, feedFetchTimeout)
+	defer cancel()
+
+	err := fetch(fetchCtx, group)
+	if err == nil {
+		return fetchSucceeded
+	}
+
+	if fetchCtx.Err() == context.DeadlineExceeded {
+		log.Warnf("fetch feed timed out: %s", group.URL)
+		return fetchTimedOut
+	}
+
+	log.Errorf("fetch feed %s failed: %v", group.URL, err)
+	return fetchFailed
+}
@@ -0,0 +1,319 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+const testRSS = `<?xml version="1.0"?>
+<rss version="2.0"><channel><title>Test</title>
+<item><title>Hello</title><link>https://example.com/hello</link><pubDate>Mon, 02 Jan 2006 15:04:05 GMT</pubDate></item>
+</channel></rss>`
+
+func TestFetchFeedConditionalRequest(t *testing.T) {
+	const etag = `"v1"`
+	const lastModified = "Mon, 02 Jan 2006 15:04:05 GMT"
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Last-Modified", lastModified)
+		w.Write([]byte(testRSS))
+	}))
+	defer server.Close()
+
+	fd := &Feed{URL: server.URL}
+	result, err := fetchFeed(context.Background(), fd)
+	if err != nil {
+		t.Fatalf("fetchFeed() error = %v", err)
+	}
+	if result.NotModified || result.Feed == nil || len(result.Feed.Items) != 1 {
+		t.Fatalf("first fetch should return the parsed feed, got %+v", result)
+	}
+	if result.ETag != etag || result.LastModified != lastModified {
+		t.Fatalf("validators = %q, %q", result.ETag, result.LastModified)
+	}
+
+	fd.ETag, fd.LastModified = result.ETag, result.LastModified
+	result, err = fetchFeed(context.Background(), fd)
+	if err != nil {
+		t.Fatalf("conditional fetchFeed() error = %v", err)
+	}
+	if !result.NotModified || result.Feed != nil {
+		t.Fatalf("second fetch should be not modified, got %+v", result)
+	}
+	if result.ETag != etag || result.LastModified != lastModified {
+		t.Fatalf("304 should keep previous validators, got %q, %q", result.ETag, result.LastModified)
+	}
+}
+
+func TestRunFetchCycleSummaryAndHostLimit(t *testing.T) {
+	oldTimeout, oldPerHost := feedFetchTimeout, feedFetchPerHost
+	feedFetchTimeout, feedFetchPerHost = 50*time.Millisecond, 1
+	defer func() { feedFetchTimeout, feedFetchPerHost = oldTimeout, oldPerHost }()
+
+	groups := groupFeedsByURL([]Feed{
+		{ID: 1, URL: "https://a.example.com/ok"},
+		{ID: 2, URL: "https://a.example.com/ok2"},
+		{ID: 3, URL: "https://b.example.com/fail"},
+		{ID: 4, URL: "https://c.example.com/slow"},
+		{ID: 5, URL: "https://d.example.com/skip"},
+		{ID: 6, URL: "https://e.example.com/skip"},
+		{ID: 0, URL: "https://f.example.com/invalid"},
+	})
+
+	var mu sync.Mutex
+	running := map[string]int{}
+	maxRunning := map[string]int{}
+
+	summary := runFetchCycle(context.Background(), groups, func(group *feedGroup) bool {
+		return group.Feeds[0].ID < 5
+	}, func(ctx context.Context, group *feedGroup) error {
+		host := feedHost(group.URL)
+		mu.Lock()
+		running[host]++
+		maxRunning[host] = max(maxRunning[host], running[host])
+		mu.Unlock()
+		defer func() {
+			mu.Lock()
+			running[host]--
+			mu.Unlock()
+		}()
+
+		switch group.Feeds[0].ID {
+		case 3:
+			return errors.New("boom")
+		case 4:
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		time.Sleep(5 * time.Millisecond)
+		return nil
+	})
+
+	if summary.Total != 6 || summary.Succeeded != 2 || summary.Failed != 1 ||
+		summary.TimedOut != 1 || summary.Skipped != 2 {
+		t.Fatalf("unexpected summary: %s", summary)
+	}
+	if maxRunning["a.example.com"] > 1 {
+		t.Fatalf("per-host limit exceeded: %d", maxRunning["a.example.com"])
+	}
+}
+
+func TestGroupFeedsByURLAndUserQuota(t *testing.T) {
+	now := time.Now()
+	stale := now.Add(-48 * time.Hour).Unix()
+	fresh := now.Unix()
+
+	feeds := []Feed{
+		{ID: 1, Email: "heavy", URL: "https://example.com/shared", LastFetchedAt: stale},
+		{ID: 2, Email: "light", URL: "https://example.com/shared", LastFetchedAt: stale},
+		{ID: 3, Email: "heavy", URL: "https://example.com/a", LastFetchedAt: stale},
+		{ID: 4, Email: "heavy", URL: "https://example.com/b", LastFetchedAt: stale},
+		{ID: 5, Email: "light", URL: "https://example.com/c", LastFetchedAt: stale},
+		{ID: 6, Email: "light", URL: "https://example.com/fresh", LastFetchedAt: fresh},
+	}
+
+	groups := groupFeedsByURL(feeds)
+	if len(groups) != 5 {
+		t.Fatalf("got %d groups, want 5", len(groups))
+	}
+	if groups[len(groups)-1].URL != "https://example.com/fresh" {
+		t.Fatalf("groups should be ordered by due time, last is %s", groups[len(groups)-1].URL)
+	}
+
+	fetched := map[string]bool{}
+	filter := dueFeedGroupFilter(now, 2)
+	for _, group := range groups {
+		fetched[group.URL] = filter(group)
+	}
+
+	want := map[string]bool{
+		"https://example.com/shared": true,
+		"https://example.com/a":      true,
+		"https://example.com/b":      false, // heavy 的配额已用完
+		"https://example.com/c":      true,
+		"https://example.com/fresh":  false, // 还未到期
+	}
+	for url, shouldFetch := range want {
+		if fetched[url] != shouldFetch {
+			t.Fatalf("fetched[%s] = %t, want %t", url, fetched[url], shouldFetch)
+		}
+	}
+}
+
+func TestFeedNextFetchAtBacksOff(t *testing.T) {
+	last := time.Unix(1700000000, 0)
+	cases := []struct {
+		errorCount int
+		want       time.Duration
+	}{
+		{0, feedFetchInterval},
+		{1, 2 * feedFetchInterval},
+		{3, 8 * feedFetchInterval},
+		{10, feedMaxBackoff},
+	}
+
+	for _, tc := range cases {
+		got := feedNextFetchAt(&Feed{LastFetchedAt: last.Unix(), ErrorCount: tc.errorCount}).Sub(last)
+		if got != tc.want {
+			t.Fatalf("errorCount=%d: backoff = %s, want %s", tc.errorCount, got, tc.want)
+		}
+	}
+}
+
+func TestFeedRefreshIntervalClamp(t *testing.T) {
+	// 校验之前保存的手动间隔仍然限制在合理范围内
+	for minutes, want := range map[int]time.Duration{1: feedMinInterval, 30: 30 * time.Minute, 100000: feedMaxInterval} {
+		if got := feedRefreshInterval(&Feed{RefreshInterval: minutes}); got != want {
+			t.Fatalf("feedRefreshInterval(%d) = %s, want %s", minutes, got, want)
+		}
+	}
+}
+
+func TestItemGUID(t *testing.T) {
+	cases := []struct {
+		item *gofeed.Item
+		want string
+	}{
+		{&gofeed.Item{GUID: " tag:example.com,2024:1 ", Link: "https://example.com/a"}, "tag:example.com,2024:1"},
+		{&gofeed.Item{Link: "HTTPS://Example.com:443/post/?utm_source=rss&id=2#comments"}, "https://example.com/post?id=2"},
+		{&gofeed.Item{Link: "https://example.com/"}, "https://example.com/"},
+	}
+
+	for _, tc := range cases {
+		if got := itemGUID(tc.item); got != tc.want {
+			t.Fatalf("itemGUID(%+v) = %q, want %q", tc.item, got, tc.want)
+		}
+	}
+
+	a := itemGUID(&gofeed.Item{Title: "Weekly links", Content: "one"})
+	b := itemGUID(&gofeed.Item{Title: "Weekly links", Content: "two"})
+	if a == b || !strings.HasPrefix(a, "sha1:") {
+		t.Fatalf("items without guid and link should hash title and content, got %q and %q", a, b)
+	}
+}
+
+func TestItemPublishTimeFallback(t *testing.T) {
+	firstSeen := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+	updated := time.Date(2024, 4, 2, 10, 0, 0, 0, time.UTC)
+
+	fixtures := []struct {
+		name       string
+		feed       string
+		wantTime   time.Time
+		wantSource string
+	}{
+		{
+			name: "undated rss",
+			feed: `<?xml version="1.0"?><rss version="2.0"><channel><title>RSS</title>
+<item><title>No date</title><link>https://example.com/rss/1</link></item>
+</channel></rss>`,
+			wantTime:   firstSeen,
+			wantSource: PublishSourceFirstSeen,
+		},
+		{
+			name: "undated atom",
+			feed: `<?xml version="1.0" encoding="utf-8"?><feed xmlns="http://www.w3.org/2005/Atom"><title>Atom</title>
+<entry><title>No date</title><id>urn:uuid:1</id><link href="https://example.com/atom/1"/></entry>
+</feed>`,
+			wantTime:   firstSeen,
+			wantSource: PublishSourceFirstSeen,
+		},
+		{
+			name: "undated json feed",
+			feed: `{"version":"https://jsonfeed.org/version/1.1","title":"JSON",
+"items":[{"id":"1","url":"https://example.com/json/1","title":"No date"}]}`,
+			wantTime:   firstSeen,
+			wantSource: PublishSourceFirstSeen,
+		},
+		{
+			name: "json feed with only date_modified",
+			feed: `{"version":"https://jsonfeed.org/version/1.1","title":"JSON",
+"items":[{"id":"2","url":"https://example.com/json/2","title":"Updated","date_modified":"2024-04-02T10:00:00Z"}]}`,
+			wantTime:   updated,
+			wantSource: PublishSourceUpdated,
+		},
+		{
+			name:       "rss with pubDate",
+			feed:       testRSS,
+			wantTime:   time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC),
+			wantSource: PublishSourcePublished,
+		},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			feed, err := gofeed.NewParser().ParseString(fixture.feed)
+			if err != nil {
+				t.Fatalf("parse fixture: %v", err)
+			}
+			if len(feed.Items) != 1 {
+				t.Fatalf("fixture has %d items", len(feed.Items))
+			}
+
+			got, source := itemPublishTime(feed.Items[0], firstSeen)
+			if !got.Equal(fixture.wantTime) || source != fixture.wantSource {
+				t.Fatalf("itemPublishTime() = %s, %q; want %s, %q", got, source, fixture.wantTime, fixture.wantSource)
+			}
+		})
+	}
+}
+
+func TestAdaptiveRefreshInterval(t *testing.T) {
+	itemsEvery := func(gap time.Duration, n int) []*gofeed.Item {
+		now := time.Now()
+		items := make([]*gofeed.Item, 0, n)
+		for i := 0; i < n; i++ {
+			published := now.Add(-time.Duration(i) * gap)
+			items = append(items, &gofeed.Item{PublishedParsed: &published})
+		}
+		return items
+	}
+
+	news := &gofeed.Feed{Items: itemsEvery(5*time.Minute, 20)}
+	if got := adaptiveRefreshInterval(news); got != feedMinInterval {
+		t.Fatalf("high-volume feed interval = %s, want %s", got, feedMinInterval)
+	}
+
+	monthly := &gofeed.Feed{Items: itemsEvery(30*24*time.Hour, 5)}
+	if got := adaptiveRefreshInterval(monthly); got != feedMaxInterval {
+		t.Fatalf("monthly feed interval = %s, want %s", got, feedMaxInterval)
+	}
+
+	hourly := &gofeed.Feed{Items: itemsEvery(4*time.Hour, 5)}
+	if got := adaptiveRefreshInterval(hourly); got != 2*time.Hour {
+		t.Fatalf("4-hourly feed interval = %s, want 2h", got)
+	}
+
+	withTTL := &gofeed.Feed{Items: itemsEvery(5*time.Minute, 5), Custom: map[string]string{"ttl": "180"}}
+	if got := adaptiveRefreshInterval(withTTL); got != 3*time.Hour {
+		t.Fatalf("ttl should be respected, interval = %s", got)
+	}
+}
+
+func TestFeedHintIntervalFromRSS(t *testing.T) {
+	fp := newFeedParser()
+	feed, err := fp.ParseString(`<?xml version="1.0"?>
+<rss version="2.0" xmlns:sy="http://purl.org/rss/1.0/modules/syndication/"><channel><title>T</title>
+<ttl>60</ttl><sy:updatePeriod>daily</sy:updatePeriod><sy:updateFrequency>4</sy:updateFrequency>
+</channel></rss>`)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+
+	if got := feedHintInterval(feed); got != 6*time.Hour {
+		t.Fatalf("feedHintInterval() = %s, want 6h", got)
+	}
+}
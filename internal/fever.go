@@ -0,0 +1,347 @@
+package internal
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/log"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Fever API 的兼容实现，api_key 是 md5("email:password")，password 在 /preference 中设置。
+// 分组对应 Category，条目 id 使用 Article.ItemID
+const (
+	feverAPIVersion = 3
+	feverPageSize   = 50
+)
+
+func registerFeverRoutes(r *gin.Engine) {
+	for _, path := range []string{"/fever", "/fever/"} {
+		r.GET(path, feverHandler)
+		r.POST(path, feverHandler)
+	}
+}
+
+func feverAPIKey(email, password string) string {
+	sum := md5.Sum([]byte(email + ":" + password))
+	return hex.EncodeToString(sum[:])
+}
+
+// setFeverPassword 保存 Fever 密码对应 api_key 的哈希，密码为空时停用
+func setFeverPassword(email, password string) error {
+	hash := ""
+	if password != "" {
+		hash = hashAPIToken(feverAPIKey(email, password))
+	}
+
+	err := globalDB.Model(&UserPreference{}).Where("email = ?", email).Update("fever_key_hash", hash).Error
+	if err != nil {
+		return fmt.Errorf("could not update fever password: %v", err)
+	}
+
+	GlobalMemoryCache.Delete(SceneUserPref, email)
+	return nil
+}
+
+func authenticateFeverKey(key string) (string, bool) {
+	if key == "" {
+		return "", false
+	}
+
+	var pref UserPreference
+	if err := globalDB.Select("email").Where("fever_key_hash = ?", hashAPIToken(strings.ToLower(key))).First(&pref).Error; err != nil {
+		return "", false
+	}
+	if _, err := getActiveUser(pref.Email); err != nil {
+		return "", false
+	}
+	return pref.Email, true
+}
+
+// feverWants 判断请求是否带了某个参数，Fever 的参数大多没有值，例如 ?api&items
+func feverWants(c *gin.Context, name string) bool {
+	if _, ok := c.GetQuery(name); ok {
+		return true
+	}
+	_, ok := c.GetPostForm(name)
+	return ok
+}
+
+func feverHandler(c *gin.Context) {
+	resp := gin.H{"api_version": feverAPIVersion, "auth": 0}
+
+	email, ok := authenticateFeverKey(requestParam(c, "api_key"))
+	if !ok {
+		c.JSON(http.StatusOK, resp)
+		return
+	}
+	resp["auth"] = 1
+
+	fail := func(status int, err error) {
+		log.Errorf("fever api: %v", err)
+		resp["error"] = err.Error()
+		c.JSON(status, resp)
+	}
+
+	if err := assignArticleItemIDs(email); err != nil {
+		fail(http.StatusInternalServerError, err)
+		return
+	}
+
+	var lastRefreshed int64
+	globalDB.Model(&Feed{}).Select("COALESCE(MAX(last_fetched_at), 0)").Where("email = ?", email).Scan(&lastRefreshed)
+	resp["last_refreshed_on_time"] = lastRefreshed
+
+	// 先执行标记，同一个请求中返回的列表是标记之后的状态，并附带受影响的 id 列表
+	var marked string
+	if mark := requestParam(c, "mark"); mark != "" {
+		if !userCanWrite(email) {
+			fail(http.StatusForbidden, errors.New("account is read-only"))
+			return
+		}
+		as := requestParam(c, "as")
+		if err := feverMark(email, mark, as, requestParam(c, "id"), requestParam(c, "before")); err != nil {
+			fail(http.StatusBadRequest, err)
+			return
+		}
+		marked = "unread_item_ids"
+		if as == "saved" || as == "unsaved" {
+			marked = "saved_item_ids"
+		}
+	}
+
+	if feverWants(c, "groups") || feverWants(c, "feeds") {
+		groups, feedsGroups := feverGroups(email)
+		if feverWants(c, "groups") {
+			resp["groups"] = groups
+		}
+		if feverWants(c, "feeds") {
+			resp["feeds"] = feverFeeds(email)
+		}
+		resp["feeds_groups"] = feedsGroups
+	}
+
+	// 没有保存站点图标和 Sparks，返回空列表让客户端正常同步
+	if feverWants(c, "favicons") {
+		resp["favicons"] = []gin.H{}
+	}
+	if feverWants(c, "links") {
+		resp["links"] = []gin.H{}
+	}
+
+	if feverWants(c, "items") {
+		items, total, err := feverItems(c, email)
+		if err != nil {
+			fail(http.StatusBadRequest, err)
+			return
+		}
+		resp["items"], resp["total_items"] = items, total
+	}
+
+	for name, column := range map[string]string{"unread_item_ids": "read", "saved_item_ids": "favorite"} {
+		if name != marked && !feverWants(c, name) {
+			continue
+		}
+		ids, err := feverItemIDs(email, column)
+		if err != nil {
+			fail(http.StatusInternalServerError, err)
+			return
+		}
+		resp[name] = ids
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+func feverGroups(email string) ([]gin.H, []gin.H) {
+	feedIDs := make(map[string][]string)
+	for _, feed := range getFeeds(email) {
+		if feed.Categories != "" {
+			feedIDs[feed.Categories] = append(feedIDs[feed.Categories], strconv.FormatInt(feed.ID, 10))
+		}
+	}
+
+	groups, feedsGroups := []gin.H{}, []gin.H{}
+	for _, cat := range getCategories(email) {
+		groups = append(groups, gin.H{"id": cat.ID, "title": cat.Name})
+		if ids := feedIDs[cat.Name]; len(ids) > 0 {
+			feedsGroups = append(feedsGroups, gin.H{"group_id": cat.ID, "feed_ids": strings.Join(ids, ",")})
+		}
+	}
+	return groups, feedsGroups
+}
+
+func feverFeeds(email string) []gin.H {
+	feeds := []gin.H{}
+	for _, feed := range getFeeds(email) {
+		feeds = append(feeds, gin.H{
+			"id":                   feed.ID,
+			"favicon_id":           0,
+			"title":                feed.Title,
+			"url":                  feed.URL,
+			"site_url":             linkOrigin(feed.URL),
+			"is_spark":             0,
+			"last_updated_on_time": feed.LastSuccessAt,
+		})
+	}
+	return feeds
+}
+
+// feverItems 按 with_ids、since_id、max_id 返回最多 50 篇文章
+func feverItems(c *gin.Context, email string) ([]gin.H, int64, error) {
+	base := func() *gorm.DB {
+		return globalDB.Model(&Article{}).Where("email = ? AND deleted = ?", email, false)
+	}
+
+	var total int64
+	if err := base().Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("could not count articles: %v", err)
+	}
+
+	query := base().Order("item_id asc")
+	switch {
+	case requestParam(c, "with_ids") != "":
+		var ids []int64
+		for _, raw := range strings.Split(requestParam(c, "with_ids"), ",") {
+			id, err := strconv.ParseInt(strings.TrimSpace(raw), 10, 64)
+			if err != nil {
+				return nil, 0, fmt.Errorf("invalid item id %q", raw)
+			}
+			ids = append(ids, id)
+		}
+		query = query.Where("item_id IN ?", ids)
+	case requestParam(c, "max_id") != "":
+		maxID, err := strconv.ParseInt(requestParam(c, "max_id"), 10, 64)
+		if err != nil {
+			return nil, 0, fmt.Errorf("invalid max_id")
+		}
+		query = base().Where("item_id < ?", maxID).Order("item_id desc")
+	case requestParam(c, "since_id") != "":
+		sinceID, err := strconv.ParseInt(requestParam(c, "since_id"), 10, 64)
+		if err != nil {
+			return nil, 0, fmt.Errorf("invalid since_id")
+		}
+		query = query.Where("item_id > ?", sinceID)
+	}
+
+	var articles []Article
+	if err := query.Limit(feverPageSize).Find(&articles).Error; err != nil {
+		return nil, 0, fmt.Errorf("could not get articles: %v", err)
+	}
+	loadArticleContent(articles)
+
+	items := make([]gin.H, 0, len(articles))
+	for _, article := range articles {
+		content := article.Content
+		if article.FullContent != "" {
+			content = article.FullContent
+		}
+		items = append(items, gin.H{
+			"id":              article.ItemID,
+			"feed_id":         article.FeedID,
+			"title":           article.Title,
+			"author":          "",
+			"html":            sanitizeHTML(content, article.Link),
+			"url":             article.Link,
+			"is_saved":        feverBool(article.Favorite),
+			"is_read":         feverBool(article.Read),
+			"created_on_time": article.PublishAt,
+		})
+	}
+	return items, total, nil
+}
+
+// feverItemIDs 返回逗号分隔的未读（column 为 read）或收藏（column 为 favorite）文章 id
+func feverItemIDs(email, column string) (string, error) {
+	var ids []int64
+	err := globalDB.Model(&Article{}).Where("email = ? AND deleted = ?", email, false).
+		Where(column+" = ?", column == "favorite").Order("item_id asc").Pluck("item_id", &ids).Error
+	if err != nil {
+		return "", fmt.Errorf("could not get item ids: %v", err)
+	}
+
+	parts := make([]string, 0, len(ids))
+	for _, id := range ids {
+		parts = append(parts, strconv.FormatInt(id, 10))
+	}
+	return strings.Join(parts, ","), nil
+}
+
+// feverMark 处理 mark=item|feed|group，分组 0 表示全部文章，before 之后发布的文章不受影响
+func feverMark(email, mark, as, rawID, rawBefore string) error {
+	id, err := strconv.ParseInt(rawID, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid id %q", rawID)
+	}
+	query := globalDB.Model(&Article{}).Where("email = ?", email)
+
+	if mark == "item" {
+		updates := map[string]map[string]interface{}{
+			"read":    {"read": true},
+			"unread":  {"read": false},
+			"saved":   {"favorite": true},
+			"unsaved": {"favorite": false},
+		}
+		update, ok := updates[as]
+		if !ok {
+			return fmt.Errorf("unknown mark %q", as)
+		}
+		if err := query.Where("item_id = ?", id).Updates(update).Error; err != nil {
+			return fmt.Errorf("could not mark item: %v", err)
+		}
+		return nil
+	}
+
+	if as != "read" {
+		return fmt.Errorf("%s can only be marked as read", mark)
+	}
+	switch mark {
+	case "feed":
+		query = query.Where("feed_id = ?", id)
+	case "group":
+		if id != 0 {
+			feedIDs, err := feverGroupFeedIDs(email, id)
+			if err != nil {
+				return err
+			}
+			query = query.Where("feed_id IN ?", feedIDs)
+		}
+	default:
+		return fmt.Errorf("unknown mark %q", mark)
+	}
+	if before, err := strconv.ParseInt(rawBefore, 10, 64); err == nil && before > 0 {
+		query = query.Where("publish_at <= ?", before)
+	}
+
+	if err := query.Where("read = ?", false).Update("read", true).Error; err != nil {
+		return fmt.Errorf("could not mark %s as read: %v", mark, err)
+	}
+	return nil
+}
+
+func feverGroupFeedIDs(email string, groupID int64) ([]int64, error) {
+	for _, cat := range getCategories(email) {
+		if cat.ID != groupID {
+			continue
+		}
+		feedIDs, err := getCategoryFeedIDs(email, cat.Name)
+		if err != nil {
+			return nil, err
+		}
+		return append(feedIDs, 0), nil
+	}
+	return nil, fmt.Errorf("group %d not found", groupID)
+}
+
+func feverBool(v bool) int {
+	if v {
+		return 1
+	}
+	return 0
+}
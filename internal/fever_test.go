@@ -0,0 +1,208 @@
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestFeverAPI(t *testing.T) {
+	db := useTestDB(t)
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+	registerFeverRoutes(r)
+
+	email := "alice@example.com"
+	if err := addUser(email, userRoleMember); err != nil {
+		t.Fatalf("addUser() error = %v", err)
+	}
+	tech, _ := getSetFeed("https://example.com/feed", email, "Example", 0)
+	other, _ := getSetFeed("https://other.example.org/feed", email, "Other", 0)
+	if err := createCategory("Tech", "#007bff", email); err != nil {
+		t.Fatalf("createCategory() error = %v", err)
+	}
+	if err := updateFeedCategory(email, strconv.FormatInt(tech, 10), "Tech"); err != nil {
+		t.Fatalf("updateFeedCategory() error = %v", err)
+	}
+	// 标题保存在 entry 上，entry id 和 uid 一一对应
+	createArticle := func(article Article, title string) {
+		t.Helper()
+		entry := Entry{GUID: article.GUID, Title: title}
+		if err := db.Create(&entry).Error; err != nil {
+			t.Fatalf("create entry: %v", err)
+		}
+		article.EntryID = entry.ID
+		if err := db.Create(&article).Error; err != nil {
+			t.Fatalf("create article: %v", err)
+		}
+	}
+	createArticle(Article{Uid: "a1", Email: email, FeedID: tech, GUID: "a1", CreateAt: 1, PublishAt: 100}, "First")
+	createArticle(Article{Uid: "a2", Email: email, FeedID: tech, GUID: "a2", CreateAt: 2, PublishAt: 200}, "Second")
+	createArticle(Article{Uid: "a3", Email: email, FeedID: other, GUID: "a3", CreateAt: 3, PublishAt: 300}, "Third")
+	createArticle(Article{Uid: "b1", Email: "bob@example.com", FeedID: 99, GUID: "b1", CreateAt: 1}, "Bob")
+
+	if _, err := getUserPreference(email); err != nil {
+		t.Fatalf("getUserPreference() error = %v", err)
+	}
+	if err := setFeverPassword(email, "secret"); err != nil {
+		t.Fatalf("setFeverPassword() error = %v", err)
+	}
+	key := feverAPIKey(email, "secret")
+
+	call := func(query string, form url.Values) map[string]json.RawMessage {
+		t.Helper()
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/fever/?api&"+query, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s = %d %s", query, w.Code, w.Body.String())
+		}
+
+		var resp map[string]json.RawMessage
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("%s: invalid json %s", query, w.Body.String())
+		}
+		return resp
+	}
+	auth := url.Values{"api_key": {key}}
+
+	if resp := call("items", url.Values{"api_key": {feverAPIKey(email, "wrong")}}); string(resp["auth"]) != "0" || resp["items"] != nil {
+		t.Fatalf("wrong key should not authenticate: %v", resp)
+	}
+
+	resp := call("groups&feeds", auth)
+	if string(resp["auth"]) != "1" || !strings.Contains(string(resp["feeds_groups"]), `"feed_ids":"`+strconv.FormatInt(tech, 10)+`"`) {
+		t.Fatalf("groups response = %s %s", resp["auth"], resp["feeds_groups"])
+	}
+	var groups []struct {
+		ID    int64  `json:"id"`
+		Title string `json:"title"`
+	}
+	json.Unmarshal(resp["groups"], &groups)
+	var techGroup int64
+	for _, group := range groups {
+		if group.Title == "Tech" {
+			techGroup = group.ID
+		}
+	}
+	if techGroup == 0 || !strings.Contains(string(resp["feeds"]), `"site_url":"https://other.example.org"`) {
+		t.Fatalf("groups = %+v, feeds = %s", groups, resp["feeds"])
+	}
+
+	type item struct {
+		ID     int64  `json:"id"`
+		Title  string `json:"title"`
+		IsRead int    `json:"is_read"`
+	}
+	items := func(query string) []item {
+		t.Helper()
+		var list []item
+		json.Unmarshal(call(query, auth)["items"], &list)
+		return list
+	}
+
+	// id 按入库顺序分配，并且只包含当前用户的文章
+	all := items("items")
+	if len(all) != 3 || all[0].Title != "First" || all[0].ID >= all[1].ID || all[1].ID >= all[2].ID {
+		t.Fatalf("items = %+v", all)
+	}
+	if got := items("items&since_id=" + strconv.FormatInt(all[0].ID, 10)); len(got) != 2 || got[0].Title != "Second" {
+		t.Fatalf("since_id items = %+v", got)
+	}
+	if got := items("items&max_id=" + strconv.FormatInt(all[2].ID, 10)); len(got) != 2 || got[0].Title != "Second" {
+		t.Fatalf("max_id items = %+v", got)
+	}
+	if got := items("items&with_ids=" + strconv.FormatInt(all[2].ID, 10)); len(got) != 1 || got[0].Title != "Third" {
+		t.Fatalf("with_ids items = %+v", got)
+	}
+
+	// 新文章得到更大的 id，已有的 id 不变
+	createArticle(Article{Uid: "a0", Email: email, FeedID: other, GUID: "a0", CreateAt: 0}, "Late")
+	late := items("items&since_id=" + strconv.FormatInt(all[2].ID, 10))
+	if len(late) != 1 || late[0].Title != "Late" {
+		t.Fatalf("new article items = %+v", late)
+	}
+	if got := items("items"); got[0].ID != all[0].ID {
+		t.Fatalf("item ids changed: %+v", got)
+	}
+
+	// 最新的文章被删除后，id 也不会分配给之后的文章
+	db.Where("uid = ?", "a0").Delete(&Article{})
+	createArticle(Article{Uid: "a4", Email: email, FeedID: other, GUID: "a4", CreateAt: 4}, "Later")
+	if got := items("items&since_id=" + strconv.FormatInt(late[0].ID, 10)); len(got) != 1 || got[0].Title != "Later" {
+		t.Fatalf("ids should not be reused after delete, items = %+v", got)
+	}
+
+	form := url.Values{"api_key": {key}, "mark": {"item"}, "as": {"saved"}, "id": {strconv.FormatInt(all[1].ID, 10)}}
+	if ids := string(call("", form)["saved_item_ids"]); ids != `"`+strconv.FormatInt(all[1].ID, 10)+`"` {
+		t.Fatalf("saved_item_ids = %s", ids)
+	}
+
+	// 分组标记已读只影响 before 之前发布的文章
+	form = url.Values{"api_key": {key}, "mark": {"group"}, "as": {"read"}, "id": {strconv.FormatInt(techGroup, 10)}, "before": {"150"}}
+	resp = call("", form)
+	var unread string
+	json.Unmarshal(resp["unread_item_ids"], &unread)
+	if strings.Contains(","+unread+",", ","+strconv.FormatInt(all[0].ID, 10)+",") || !strings.Contains(unread, strconv.FormatInt(all[1].ID, 10)) {
+		t.Fatalf("unread_item_ids after group mark = %q", unread)
+	}
+
+	form = url.Values{"api_key": {key}, "mark": {"group"}, "as": {"read"}, "id": {"0"}}
+	json.Unmarshal(call("unread_item_ids", form)["unread_item_ids"], &unread)
+	if unread != "" {
+		t.Fatalf("all articles should be read, unread = %q", unread)
+	}
+
+	var bob Article
+	db.Where("uid = ?", "b1").First(&bob)
+	if bob.Read || bob.ItemID != 0 {
+		t.Fatalf("other users' articles should not change: %+v", bob)
+	}
+
+	if err := setFeverPassword(email, ""); err != nil {
+		t.Fatalf("setFeverPassword() error = %v", err)
+	}
+	if resp := call("", auth); string(resp["auth"]) != "0" {
+		t.Fatalf("disabled key should not authenticate")
+	}
+}
+
+func TestMigrateArticleItemIDs(t *testing.T) {
+	db := useTestDB(t)
+
+	getUserPreference("alice@example.com")
+	getUserPreference("bob@example.com")
+	db.Create(&[]Article{
+		{Uid: "a1", Email: "alice@example.com", GUID: "a1", ItemID: 3},
+		{Uid: "a2", Email: "alice@example.com", GUID: "a2", ItemID: 7},
+	})
+
+	if err := migrateArticleItemIDs(db); err != nil {
+		t.Fatalf("migrateArticleItemIDs() error = %v", err)
+	}
+	for email, want := range map[string]int64{"alice@example.com": 7, "bob@example.com": 0} {
+		var last int64
+		if db.Model(&UserPreference{}).Select("last_item_id").Where("email = ?", email).Scan(&last); last != want {
+			t.Fatalf("%s last_item_id = %d, want %d", email, last, want)
+		}
+	}
+
+	// 缓存中的设置可能是更早读取的，保存设置不能把计数器写回去
+	pref, _ := getUserPreference("alice@example.com")
+	pref.LastItemID = 0
+	if err := updateUserPreference("alice@example.com", pref); err != nil {
+		t.Fatalf("updateUserPreference() error = %v", err)
+	}
+	var last int64
+	if db.Model(&UserPreference{}).Select("last_item_id").Where("email = ?", "alice@example.com").Scan(&last); last != 7 {
+		t.Fatalf("saving preferences reset last_item_id to %d", last)
+	}
+}
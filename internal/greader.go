@@ -0,0 +1,527 @@
+package internal
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Google Reader API 的兼容实现，供 Reeder、FeedMe、ReadYou 等客户端使用。
+// 登录密码是 /preference 中创建的 API 令牌，条目 id 使用文章对应的 entry_id
+const (
+	greaderItemPrefix  = "tag:google.com,2005:reader/item/"
+	greaderLabelPrefix = "user/-/label/"
+	greaderFeedPrefix  = "feed/"
+	greaderReadingList = "user/-/state/com.google/reading-list"
+	greaderRead        = "user/-/state/com.google/read"
+	greaderStarred     = "user/-/state/com.google/starred"
+	greaderKeptUnread  = "user/-/state/com.google/kept-unread"
+
+	greaderDefaultCount = 20
+	greaderMaxItems     = 1000
+	greaderMaxIDs       = 10000
+)
+
+// 客户端可能用真实的用户 id 代替 -
+var greaderUserPattern = regexp.MustCompile(`^user/[^/]+/`)
+
+func registerGReaderRoutes(r *gin.Engine) {
+	r.GET("/accounts/ClientLogin", greaderLogin)
+	r.POST("/accounts/ClientLogin", greaderLogin)
+
+	api := r.Group("/reader/api/0", greaderAuth)
+
+	api.GET("/token", func(c *gin.Context) {
+		c.String(http.StatusOK, greaderCSRFToken(c.MustGet("token").(*APIToken)))
+	})
+
+	api.GET("/user-info", func(c *gin.Context) {
+		email := c.GetString("email")
+		c.JSON(http.StatusOK, gin.H{
+			"userId":        email,
+			"userName":      email,
+			"userProfileId": email,
+			"userEmail":     email,
+		})
+	})
+
+	api.GET("/subscription/list", func(c *gin.Context) {
+		subscriptions := []gin.H{}
+		for _, feed := range getFeeds(c.GetString("email")) {
+			categories := []gin.H{}
+			if feed.Categories != "" {
+				categories = append(categories, gin.H{"id": greaderLabelPrefix + feed.Categories, "label": feed.Categories})
+			}
+			subscriptions = append(subscriptions, gin.H{
+				"id":         greaderFeedPrefix + strconv.FormatInt(feed.ID, 10),
+				"title":      feed.Title,
+				"categories": categories,
+				"url":        feed.URL,
+				"htmlUrl":    linkOrigin(feed.URL),
+				"iconUrl":    "",
+			})
+		}
+		c.JSON(http.StatusOK, gin.H{"subscriptions": subscriptions})
+	})
+
+	api.GET("/tag/list", func(c *gin.Context) {
+		tags := []gin.H{{"id": greaderStarred}}
+		for _, cat := range getCategories(c.GetString("email")) {
+			tags = append(tags, gin.H{"id": greaderLabelPrefix + cat.Name, "type": "folder"})
+		}
+		c.JSON(http.StatusOK, gin.H{"tags": tags})
+	})
+
+	api.GET("/unread-count", func(c *gin.Context) {
+		counts, err := greaderUnreadCounts(c.GetString("email"))
+		if err != nil {
+			c.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"max": greaderMaxIDs, "unreadcounts": counts})
+	})
+
+	api.GET("/stream/items/ids", func(c *gin.Context) {
+		articles, continuation, err := greaderStreamArticles(c, requestParam(c, "s"), greaderMaxIDs)
+		if err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+
+		refs := make([]gin.H, 0, len(articles))
+		for _, article := range articles {
+			refs = append(refs, gin.H{
+				"id":              strconv.FormatInt(article.EntryID, 10),
+				"directStreamIds": []string{greaderFeedPrefix + strconv.FormatInt(article.FeedID, 10)},
+				"timestampUsec":   strconv.FormatInt(article.PublishAt*1e6, 10),
+			})
+		}
+
+		resp := gin.H{"itemRefs": refs}
+		if continuation != "" {
+			resp["continuation"] = continuation
+		}
+		c.JSON(http.StatusOK, resp)
+	})
+
+	streamContents := func(c *gin.Context) {
+		stream := strings.TrimPrefix(c.Param("stream"), "/")
+		if stream == "" {
+			stream = greaderReadingList
+		}
+
+		articles, continuation, err := greaderStreamArticles(c, stream, greaderMaxItems)
+		if err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+		loadArticleContent(articles)
+
+		resp := gin.H{
+			"id":      stream,
+			"updated": time.Now().Unix(),
+			"items":   greaderItems(articles),
+		}
+		if continuation != "" {
+			resp["continuation"] = continuation
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+	api.GET("/stream/contents/*stream", streamContents)
+	api.POST("/stream/contents/*stream", streamContents)
+
+	itemContents := func(c *gin.Context) {
+		ids, err := greaderItemIDs(c)
+		if err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+
+		var articles []Article
+		err = globalDB.Where("email = ? AND deleted = ? AND entry_id IN ?", c.GetString("email"), false, ids).
+			Order("publish_at desc").Find(&articles).Error
+		if err != nil {
+			c.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+		loadArticleContent(articles)
+
+		c.JSON(http.StatusOK, gin.H{
+			"id":      greaderReadingList,
+			"updated": time.Now().Unix(),
+			"items":   greaderItems(articles),
+		})
+	}
+	api.GET("/stream/items/contents", itemContents)
+	api.POST("/stream/items/contents", itemContents)
+
+	api.POST("/edit-tag", greaderWrite, func(c *gin.Context) {
+		ids, err := greaderItemIDs(c)
+		if err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+
+		if err := greaderEditTags(c.GetString("email"), ids, c.PostFormArray("a"), c.PostFormArray("r")); err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+		c.String(http.StatusOK, "OK")
+	})
+
+	api.POST("/mark-all-as-read", greaderWrite, func(c *gin.Context) {
+		email := c.GetString("email")
+
+		query, err := greaderStreamQuery(email, requestParam(c, "s"))
+		if err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+		// ts 是微秒，只标记这之前发布的文章，避免客户端同步之后的新文章被误标
+		if ts, err := strconv.ParseInt(requestParam(c, "ts"), 10, 64); err == nil && ts > 0 {
+			query = query.Where("publish_at <= ?", ts/1e6)
+		}
+
+		if err := query.Where("read = ?", false).Update("read", true).Error; err != nil {
+			c.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+		c.String(http.StatusOK, "OK")
+	})
+}
+
+// greaderLogin 实现 ClientLogin：Email 是用户邮箱，Passwd 是该用户的 API 令牌
+func greaderLogin(c *gin.Context) {
+	email, password := requestParam(c, "Email"), requestParam(c, "Passwd")
+
+	record, err := authenticateAPIToken(password)
+	if err != nil || !strings.EqualFold(record.Email, email) {
+		c.String(http.StatusUnauthorized, "Error=BadAuthentication\n")
+		return
+	}
+
+	if c.Query("output") == "json" {
+		c.JSON(http.StatusOK, gin.H{"SID": password, "LSID": "null", "Auth": password})
+		return
+	}
+	c.String(http.StatusOK, "SID=%s\nLSID=null\nAuth=%s\n", password, password)
+}
+
+func greaderAuth(c *gin.Context) {
+	scheme, value, _ := strings.Cut(c.GetHeader("Authorization"), " ")
+
+	var token string
+	switch {
+	case strings.EqualFold(scheme, "GoogleLogin"):
+		token = strings.TrimPrefix(strings.TrimSpace(value), "auth=")
+	case strings.EqualFold(scheme, "Bearer"):
+		token = strings.TrimSpace(value)
+	}
+
+	record, err := authenticateAPIToken(token)
+	if err != nil {
+		c.String(http.StatusUnauthorized, "Unauthorized")
+		c.Abort()
+		return
+	}
+
+	c.Set("email", record.Email)
+	c.Set("token", record)
+	c.Next()
+}
+
+// greaderWrite 修改数据的接口需要可写的令牌，客户端带了 T 时还要和 /token 返回的一致
+func greaderWrite(c *gin.Context) {
+	record := c.MustGet("token").(*APIToken)
+	if record.Scope != apiScopeWrite || !userCanWrite(record.Email) {
+		c.String(http.StatusForbidden, "token or account is read-only")
+		c.Abort()
+		return
+	}
+
+	if t := requestParam(c, "T"); t != "" && !hmac.Equal([]byte(t), []byte(greaderCSRFToken(record))) {
+		c.Header("X-Reader-Google-Bad-Token", "true")
+		c.String(http.StatusUnauthorized, "Unauthorized")
+		c.Abort()
+		return
+	}
+	c.Next()
+}
+
+func greaderCSRFToken(record *APIToken) string {
+	mac := hmac.New(sha256.New, CipherKey)
+	mac.Write([]byte(record.TokenHash))
+	return hex.EncodeToString(mac.Sum(nil))[:57]
+}
+
+func greaderItemID(entryID int64) string {
+	return fmt.Sprintf("%s%016x", greaderItemPrefix, entryID)
+}
+
+// parseGReaderItemID 支持长格式（十六进制）和短格式（十进制）两种 id
+func parseGReaderItemID(raw string) (int64, error) {
+	if id, ok := strings.CutPrefix(raw, greaderItemPrefix); ok {
+		n, err := strconv.ParseUint(id, 16, 64)
+		return int64(n), err
+	}
+	return strconv.ParseInt(raw, 10, 64)
+}
+
+func greaderItemIDs(c *gin.Context) ([]int64, error) {
+	raw := requestParams(c, "i")
+	if len(raw) == 0 {
+		return nil, fmt.Errorf("missing item ids")
+	}
+
+	ids := make([]int64, 0, len(raw))
+	for _, value := range raw {
+		id, err := parseGReaderItemID(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid item id %q", value)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func normalizeGReaderStream(stream string) string {
+	return greaderUserPattern.ReplaceAllString(stream, "user/-/")
+}
+
+// greaderStreamCondition 把 stream id 转成 articles 表上的查询条件
+func greaderStreamCondition(email, stream string) (string, []interface{}, error) {
+	stream = normalizeGReaderStream(stream)
+
+	switch {
+	case stream == "" || stream == greaderReadingList:
+		return "1 = 1", nil, nil
+	case stream == greaderRead:
+		return "read = ?", []interface{}{true}, nil
+	case stream == greaderKeptUnread:
+		return "read = ?", []interface{}{false}, nil
+	case stream == greaderStarred:
+		return "favorite = ?", []interface{}{true}, nil
+	case strings.HasPrefix(stream, greaderLabelPrefix):
+		feedIDs, err := getCategoryFeedIDs(email, strings.TrimPrefix(stream, greaderLabelPrefix))
+		if err != nil {
+			return "", nil, err
+		}
+		return "feed_id IN ?", []interface{}{append(feedIDs, 0)}, nil
+	case strings.HasPrefix(stream, greaderFeedPrefix):
+		// 订阅的 id 是 feed/<id>，也兼容用订阅地址的 feed/<url>
+		ref := strings.TrimPrefix(stream, greaderFeedPrefix)
+		if id, err := strconv.ParseInt(ref, 10, 64); err == nil {
+			return "feed_id = ?", []interface{}{id}, nil
+		}
+		var feed Feed
+		if err := globalDB.Where("email = ? AND url = ?", email, ref).First(&feed).Error; err != nil {
+			return "", nil, fmt.Errorf("unknown feed %q", ref)
+		}
+		return "feed_id = ?", []interface{}{feed.ID}, nil
+	}
+	return "", nil, fmt.Errorf("unknown stream %q", stream)
+}
+
+func greaderStreamQuery(email, stream string) (*gorm.DB, error) {
+	condition, args, err := greaderStreamCondition(email, stream)
+	if err != nil {
+		return nil, err
+	}
+	return globalDB.Model(&Article{}).Where("email = ? AND deleted = ?", email, false).Where(condition, args...), nil
+}
+
+// greaderStreamArticles 按 stream 和 xt/it/ot/nt/n/r/c 参数列出文章，continuation 是下一页的偏移
+func greaderStreamArticles(c *gin.Context, stream string, maxCount int) ([]Article, string, error) {
+	email := c.GetString("email")
+
+	query, err := greaderStreamQuery(email, stream)
+	if err != nil {
+		return nil, "", err
+	}
+	for _, exclude := range requestParams(c, "xt") {
+		condition, args, err := greaderStreamCondition(email, exclude)
+		if err != nil {
+			return nil, "", err
+		}
+		query = query.Not(condition, args...)
+	}
+	for _, include := range requestParams(c, "it") {
+		condition, args, err := greaderStreamCondition(email, include)
+		if err != nil {
+			return nil, "", err
+		}
+		query = query.Where(condition, args...)
+	}
+
+	// ot 之后、nt 之前，单位秒
+	if ot, err := strconv.ParseInt(requestParam(c, "ot"), 10, 64); err == nil && ot > 0 {
+		query = query.Where("publish_at >= ?", ot)
+	}
+	if nt, err := strconv.ParseInt(requestParam(c, "nt"), 10, 64); err == nil && nt > 0 {
+		query = query.Where("publish_at <= ?", nt)
+	}
+
+	count, err := strconv.Atoi(requestParam(c, "n"))
+	if err != nil || count <= 0 {
+		count = greaderDefaultCount
+	}
+	count = min(count, maxCount)
+	offset, _ := strconv.Atoi(requestParam(c, "c"))
+	offset = max(offset, 0)
+
+	order := "publish_at desc, entry_id desc"
+	if requestParam(c, "r") == "o" {
+		order = "publish_at asc, entry_id asc"
+	}
+
+	var articles []Article
+	if err := query.Order(order).Offset(offset).Limit(count + 1).Find(&articles).Error; err != nil {
+		return nil, "", fmt.Errorf("could not get articles: %v", err)
+	}
+
+	continuation := ""
+	if len(articles) > count {
+		articles = articles[:count]
+		continuation = strconv.Itoa(offset + count)
+	}
+	return articles, continuation, nil
+}
+
+func greaderItems(articles []Article) []gin.H {
+	items := make([]gin.H, 0, len(articles))
+	for _, article := range articles {
+		feedStream := greaderFeedPrefix + strconv.FormatInt(article.FeedID, 10)
+
+		categories := []string{greaderReadingList, feedStream}
+		if article.Read {
+			categories = append(categories, greaderRead)
+		}
+		if article.Favorite {
+			categories = append(categories, greaderStarred)
+		}
+		if category := getFeedMetaWithCache(article.FeedID).Categories; category != "" {
+			categories = append(categories, greaderLabelPrefix+category)
+		}
+
+		content := article.Content
+		if article.FullContent != "" {
+			content = article.FullContent
+		}
+
+		enclosures := []gin.H{}
+		for _, enclosure := range article.Enclosures {
+			enclosures = append(enclosures, gin.H{"href": enclosure.URL, "type": enclosure.MimeType, "length": enclosure.Length})
+		}
+
+		items = append(items, gin.H{
+			"id":            greaderItemID(article.EntryID),
+			"crawlTimeMsec": strconv.FormatInt(article.CreateAt*1e3, 10),
+			"timestampUsec": strconv.FormatInt(article.PublishAt*1e6, 10),
+			"published":     article.PublishAt,
+			"updated":       article.PublishAt,
+			"title":         article.Title,
+			"canonical":     []gin.H{{"href": article.Link}},
+			"alternate":     []gin.H{{"href": article.Link, "type": "text/html"}},
+			"summary":       gin.H{"direction": "ltr", "content": sanitizeHTML(content, article.Link)},
+			"author":        "",
+			"categories":    categories,
+			"enclosure":     enclosures,
+			"origin": gin.H{
+				"streamId": feedStream,
+				"title":    article.Name,
+				"htmlUrl":  linkOrigin(article.Link),
+			},
+		})
+	}
+	return items
+}
+
+// greaderEditTags 把 edit-tag 的标签映射到已读和收藏状态，在一个事务里完成
+func greaderEditTags(email string, ids []int64, add, remove []string) error {
+	updates := make(map[string]interface{})
+	for _, tag := range add {
+		switch normalizeGReaderStream(tag) {
+		case greaderRead:
+			updates["read"] = true
+		case greaderKeptUnread:
+			updates["read"] = false
+		case greaderStarred:
+			updates["favorite"] = true
+		}
+	}
+	for _, tag := range remove {
+		switch normalizeGReaderStream(tag) {
+		case greaderRead:
+			updates["read"] = false
+		case greaderStarred:
+			updates["favorite"] = false
+		}
+	}
+	if len(updates) == 0 {
+		return nil
+	}
+
+	return globalDB.Transaction(func(tx *gorm.DB) error {
+		for start := 0; start < len(ids); start += bulkChunkSize {
+			end := min(start+bulkChunkSize, len(ids))
+			err := tx.Model(&Article{}).Where("email = ? AND entry_id IN ?", email, ids[start:end]).Updates(updates).Error
+			if err != nil {
+				return fmt.Errorf("could not update articles: %v", err)
+			}
+		}
+		return nil
+	})
+}
+
+func greaderUnreadCounts(email string) ([]gin.H, error) {
+	var rows []struct {
+		FeedID int64
+		Count  int64
+		Newest int64
+	}
+	err := globalDB.Model(&Article{}).Select("feed_id, count(*) AS count, max(publish_at) AS newest").
+		Where("email = ? AND read = ? AND deleted = ?", email, false, false).
+		Group("feed_id").Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("could not count unread articles: %v", err)
+	}
+
+	counts := []gin.H{}
+	var total, newest int64
+	labels := make(map[string][2]int64)
+	for _, row := range rows {
+		counts = append(counts, gin.H{
+			"id":                      greaderFeedPrefix + strconv.FormatInt(row.FeedID, 10),
+			"count":                   row.Count,
+			"newestItemTimestampUsec": strconv.FormatInt(row.Newest*1e6, 10),
+		})
+		total, newest = total+row.Count, max(newest, row.Newest)
+
+		if category := getFeedMetaWithCache(row.FeedID).Categories; category != "" {
+			label := labels[category]
+			labels[category] = [2]int64{label[0] + row.Count, max(label[1], row.Newest)}
+		}
+	}
+	for category, label := range labels {
+		counts = append(counts, gin.H{
+			"id":                      greaderLabelPrefix + category,
+			"count":                   label[0],
+			"newestItemTimestampUsec": strconv.FormatInt(label[1]*1e6, 10),
+		})
+	}
+	counts = append(counts, gin.H{
+		"id":                      greaderReadingList,
+		"count":                   total,
+		"newestItemTimestampUsec": strconv.FormatInt(newest*1e6, 10),
+	})
+	return counts, nil
+}
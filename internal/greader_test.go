@@ -0,0 +1,180 @@
+package internal
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// greaderExchange 是 testdata/greader 中录制的一次请求和对响应的断言
+type greaderExchange struct {
+	name    string
+	request string
+	body    string
+	expects []string
+}
+
+// loadGReaderExchanges 解析 .http 文件：### 开始一段请求，空行后是请求体，>>> 开头的行是断言
+func loadGReaderExchanges(t *testing.T, path string, vars map[string]string) []greaderExchange {
+	t.Helper()
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read %s: %v", path, err)
+	}
+	text := string(raw)
+	for key, value := range vars {
+		text = strings.ReplaceAll(text, "{{"+key+"}}", value)
+	}
+
+	var exchanges []greaderExchange
+	for _, section := range strings.Split(text, "\n### ")[1:] {
+		name, rest, _ := strings.Cut(section, "\n")
+		exchange := greaderExchange{name: strings.TrimSpace(name)}
+
+		var lines []string
+		for _, line := range strings.Split(rest, "\n") {
+			if expect, ok := strings.CutPrefix(line, ">>> "); ok {
+				exchange.expects = append(exchange.expects, expect)
+				continue
+			}
+			lines = append(lines, line)
+		}
+		head, body, _ := strings.Cut(strings.TrimSpace(strings.Join(lines, "\n")), "\n\n")
+		exchange.request, exchange.body = head, strings.TrimSpace(body)
+		exchanges = append(exchanges, exchange)
+	}
+	return exchanges
+}
+
+func replayGReaderExchange(t *testing.T, r http.Handler, exchange greaderExchange) {
+	t.Helper()
+
+	req, err := http.ReadRequest(bufio.NewReader(strings.NewReader(exchange.request + "\r\n\r\n")))
+	if err != nil {
+		t.Fatalf("%s: parse request: %v", exchange.name, err)
+	}
+	recorded := req.Header
+	req = httptest.NewRequest(req.Method, req.RequestURI, strings.NewReader(exchange.body))
+	req.Header = recorded
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	for _, expect := range exchange.expects {
+		kind, value, _ := strings.Cut(expect, " ")
+		switch kind {
+		case "status":
+			if strconv.Itoa(w.Code) != value {
+				t.Fatalf("%s: status = %d %s, want %s", exchange.name, w.Code, w.Body.String(), value)
+			}
+		case "contains":
+			if !strings.Contains(w.Body.String(), value) {
+				t.Fatalf("%s: body %s should contain %s", exchange.name, w.Body.String(), value)
+			}
+		case "not-contains":
+			if strings.Contains(w.Body.String(), value) {
+				t.Fatalf("%s: body %s should not contain %s", exchange.name, w.Body.String(), value)
+			}
+		case "header":
+			key, want, _ := strings.Cut(value, ": ")
+			if got := w.Header().Get(key); got != want {
+				t.Fatalf("%s: header %s = %q, want %q", exchange.name, key, got, want)
+			}
+		default:
+			t.Fatalf("%s: unknown expectation %q", exchange.name, expect)
+		}
+	}
+}
+
+func TestGReaderReplay(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	files, err := filepath.Glob(filepath.Join("testdata", "greader", "*.http"))
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no recorded greader requests: %v", err)
+	}
+
+	for _, file := range files {
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			db := useTestDB(t)
+			r := gin.New()
+			registerGReaderRoutes(r)
+
+			email := "alice@example.com"
+			if err := addUser(email, userRoleMember); err != nil {
+				t.Fatalf("addUser() error = %v", err)
+			}
+			tech, _ := getSetFeed("https://example.com/feed", email, "Example", 0)
+			other, _ := getSetFeed("https://other.example.org/feed", email, "Other", 0)
+			if err := createCategory("Tech", "#007bff", email); err != nil {
+				t.Fatalf("createCategory() error = %v", err)
+			}
+			if err := updateFeedCategory(email, strconv.FormatInt(tech, 10), "Tech"); err != nil {
+				t.Fatalf("updateFeedCategory() error = %v", err)
+			}
+			GlobalMemoryCache.Delete(SceneFeedMeta, other)
+
+			entries := []Entry{
+				{ID: 101, GUID: "a1", Title: "First", Link: "https://example.com/1", Content: `<p>first</p><script>alert(1)</script>`},
+				{ID: 102, GUID: "a2", Title: "Second", Link: "https://example.com/2", Content: `<p>second</p>`},
+				{ID: 103, GUID: "a3", Title: "Third", Link: "https://other.example.org/3", Content: `<p>third</p>`},
+			}
+			articles := []Article{
+				{Uid: "a1", Email: email, FeedID: tech, GUID: "a1", EntryID: 101, PublishAt: 200},
+				{Uid: "a2", Email: email, FeedID: tech, GUID: "a2", EntryID: 102, PublishAt: 300},
+				{Uid: "a3", Email: email, FeedID: other, GUID: "a3", EntryID: 103, PublishAt: 100},
+			}
+			if err := db.Create(&entries).Error; err != nil {
+				t.Fatalf("create entries: %v", err)
+			}
+			if err := db.Create(&articles).Error; err != nil {
+				t.Fatalf("create articles: %v", err)
+			}
+
+			token, _ := createAPIToken(email, "reader", apiScopeWrite)
+			readToken, _ := createAPIToken(email, "reader (read only)", apiScopeRead)
+			record, err := authenticateAPIToken(token)
+			if err != nil {
+				t.Fatalf("authenticateAPIToken() error = %v", err)
+			}
+
+			vars := map[string]string{
+				"EMAIL":      email,
+				"TOKEN":      token,
+				"READ_TOKEN": readToken,
+				"CSRF":       greaderCSRFToken(record),
+				"FEED":       strconv.FormatInt(tech, 10),
+				"ITEM1":      "101",
+				"ITEM2":      "102",
+				"ITEM3":      "103",
+				"LONG_ITEM2": greaderItemID(102),
+			}
+			for _, exchange := range loadGReaderExchanges(t, file, vars) {
+				replayGReaderExchange(t, r, exchange)
+			}
+		})
+	}
+}
+
+func TestParseGReaderItemID(t *testing.T) {
+	for raw, want := range map[string]int64{
+		"102": 102,
+		"tag:google.com,2005:reader/item/0000000000000066": 102,
+		greaderItemID(1 << 40):                             1 << 40,
+	} {
+		if got, err := parseGReaderItemID(raw); err != nil || got != want {
+			t.Fatalf("parseGReaderItemID(%q) = %d, %v, want %d", raw, got, err, want)
+		}
+	}
+	if _, err := parseGReaderItemID("tag:google.com,2005:reader/item/xyz"); err == nil {
+		t.Fatalf("invalid id should fail")
+	}
+}
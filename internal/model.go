@@ -1,9 +1,12 @@
 package internal
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/charmbracelet/log"
@@ -12,6 +15,7 @@ import (
 	"gorm.io/driver/postgres"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 var (
@@ -42,11 +46,36 @@ func init() {
 	}
 
 	if autoMigrate {
-		err = db.AutoMigrate(&Article{}, &Feed{}, &UserPreference{}, &AISummary{}, &Category{})
+		// 唯一索引创建前需要先为历史文章补齐 guid
+		if err := migrateArticleGUID(db); err != nil {
+			log.Fatal(err)
+		}
+
+		err = db.AutoMigrate(&Article{}, &Feed{}, &Source{}, &Entry{}, &Enclosure{}, &SavedSearch{}, &Rule{}, &BulkAction{}, &APIToken{}, &UserPreference{}, &AISummary{}, &Category{}, &User{}, &Invite{})
 		if err != nil {
 			log.Fatal(err)
 		}
 
+		if err := migrateUsers(db); err != nil {
+			log.Fatal(err)
+		}
+
+		if err := migrateArticleItemIDs(db); err != nil {
+			log.Fatal(err)
+		}
+
+		if err := migrateSharedStorage(db); err != nil {
+			log.Fatal(err)
+		}
+
+		if err := migrateSanitizedContent(db); err != nil {
+			log.Fatal(err)
+		}
+
+		if err := migrateSearchIndex(db); err != nil {
+			log.Fatal(err)
+		}
+
 		existingCount := int64(0)
 		db.Model(&Category{}).Count(&existingCount)
 
@@ -72,33 +101,306 @@ func init() {
 	globalDB = db
 }
 
+var articleGUIDConflictColumns = []clause.Column{{Name: "email"}, {Name: "feed_id"}, {Name: "guid"}}
+
+// migrateArticleGUID 为没有 guid 的历史文章回填 guid：
+// 优先使用规范化后的链接，同一 feed 下链接重复时退回到 uid，保证唯一索引可以建立
+func migrateArticleGUID(db *gorm.DB) error {
+	if !db.Migrator().HasTable(&Article{}) {
+		return nil
+	}
+
+	if !db.Migrator().HasColumn(&Article{}, "guid") {
+		if err := db.Migrator().AddColumn(&Article{}, "GUID"); err != nil {
+			return fmt.Errorf("could not add guid column: %v", err)
+		}
+	}
+
+	// link 列在 migrateSharedStorage 中删除，此时所有文章都已经有 guid
+	if !db.Migrator().HasColumn(&Article{}, "link") {
+		return nil
+	}
+
+	var used []Article
+	if err := db.Select("email", "feed_id", "guid").Where("guid <> ''").Find(&used).Error; err != nil {
+		return fmt.Errorf("could not load article guids: %v", err)
+	}
+
+	seen := make(map[string]struct{}, len(used))
+	for _, article := range used {
+		seen[fmt.Sprintf("%s|%d|%s", article.Email, article.FeedID, article.GUID)] = struct{}{}
+	}
+
+	for batch := 1; ; batch++ {
+		var rows []Article
+		if err := db.Select("uid", "email", "feed_id", "link").
+			Where("guid IS NULL OR guid = ''").Limit(500).Find(&rows).Error; err != nil {
+			return fmt.Errorf("could not load articles without guid: %v", err)
+		}
+		if len(rows) == 0 {
+			return nil
+		}
+
+		for _, row := range rows {
+			guid := normalizeItemLink(row.Link)
+			key := fmt.Sprintf("%s|%d|%s", row.Email, row.FeedID, guid)
+			if _, dup := seen[key]; dup || guid == "" {
+				guid = "uid:" + row.Uid
+				key = fmt.Sprintf("%s|%d|%s", row.Email, row.FeedID, guid)
+			}
+			seen[key] = struct{}{}
+
+			if err := db.Model(&Article{}).Where("uid = ?", row.Uid).Update("guid", guid).Error; err != nil {
+				return fmt.Errorf("could not backfill article guid: %v", err)
+			}
+		}
+		log.Infof("backfilled guid for article batch %d", batch)
+	}
+}
+
+var entryGUIDConflictColumns = []clause.Column{{Name: "source_id"}, {Name: "guid"}}
+
+// migrateSharedStorage 把旧的按用户保存的正文迁移到全局 entries 表：先为每个订阅关联 source，
+// 再把文章正文按 source + guid 合并成 entry，最后删除 articles 上的正文、标题、链接和订阅名列
+func migrateSharedStorage(db *gorm.DB) error {
+	var feeds []Feed
+	if err := db.Select("id", "url", "title").Where("source_id IS NULL OR source_id = 0").Find(&feeds).Error; err != nil {
+		return fmt.Errorf("could not load feeds without source: %v", err)
+	}
+	for _, fd := range feeds {
+		sourceID, err := ensureSource(db, fd.URL, fd.Title)
+		if err != nil {
+			return err
+		}
+		if err := db.Model(&Feed{}).Where("id = ?", fd.ID).Update("source_id", sourceID).Error; err != nil {
+			return fmt.Errorf("could not set feed source: %v", err)
+		}
+	}
+
+	if db.Migrator().HasColumn(&Article{}, "content") {
+		if err := migrateLegacyArticleContent(db); err != nil {
+			return err
+		}
+	}
+
+	// Content 字段已被 gorm 忽略，标题等字段只读且不参与迁移，Migrator().DropColumn 无法处理，这里直接执行 SQL
+	for _, column := range []string{"content", "title", "link", "name"} {
+		if !db.Migrator().HasColumn(&Article{}, column) {
+			continue
+		}
+		if err := db.Exec("ALTER TABLE articles DROP COLUMN " + column).Error; err != nil {
+			return fmt.Errorf("could not drop article %s column: %v", column, err)
+		}
+	}
+
+	return nil
+}
+
+// migrateLegacyArticleContent 把旧文章行上的正文、标题和链接按 source + guid 合并成 entry
+func migrateLegacyArticleContent(db *gorm.DB) error {
+	type legacyArticle struct {
+		Uid           string
+		GUID          string `gorm:"column:guid"`
+		Title         string
+		Link          string
+		Content       string
+		PublishAt     int64
+		PublishSource string
+		SourceID      int64
+	}
+
+	for batch := 1; ; batch++ {
+		var rows []legacyArticle
+		err := db.Table("articles").
+			Select("articles.uid, articles.guid, articles.title, articles.link, articles.content, " +
+				"articles.publish_at, articles.publish_source, feeds.source_id").
+			Joins("JOIN feeds ON feeds.id = articles.feed_id").
+			Where("articles.entry_id IS NULL OR articles.entry_id = 0").
+			Limit(500).Scan(&rows).Error
+		if err != nil {
+			return fmt.Errorf("could not load legacy articles: %v", err)
+		}
+		if len(rows) == 0 {
+			return nil
+		}
+
+		now := time.Now().Unix()
+		for _, row := range rows {
+			// 同一 source 下第一个迁移的用户的正文会被保留
+			entry := Entry{
+				SourceID:      row.SourceID,
+				GUID:          row.GUID,
+				Title:         row.Title,
+				Link:          row.Link,
+				Content:       row.Content,
+				TextContent:   htmlToText(row.Content),
+				PublishAt:     row.PublishAt,
+				PublishSource: row.PublishSource,
+				CreateAt:      now,
+				UpdateAt:      now,
+			}
+			if err := db.Where("source_id = ? AND guid = ?", row.SourceID, row.GUID).FirstOrCreate(&entry).Error; err != nil {
+				return fmt.Errorf("could not create entry: %v", err)
+			}
+			if err := db.Model(&Article{}).Where("uid = ?", row.Uid).Update("entry_id", entry.ID).Error; err != nil {
+				return fmt.Errorf("could not set article entry: %v", err)
+			}
+		}
+		log.Infof("migrated article content batch %d", batch)
+	}
+}
+
+// migrateSanitizedContent 用当前的白名单重新清洗旧版本的条目内容，sanitizerVersion 变化时会再次执行
+func migrateSanitizedContent(db *gorm.DB) error {
+	lastID := int64(0)
+	for batch := 1; ; batch++ {
+		var entries []Entry
+		err := db.Select("id", "link", "content", "full_content").
+			Where("id > ? AND (sanitized IS NULL OR sanitized < ?)", lastID, sanitizerVersion).
+			Order("id asc").Limit(500).Find(&entries).Error
+		if err != nil {
+			return fmt.Errorf("could not load entries to sanitize: %v", err)
+		}
+		if len(entries) == 0 {
+			return nil
+		}
+
+		for _, entry := range entries {
+			content := sanitizeHTML(entry.Content, entry.Link)
+			err := db.Model(&Entry{}).Where("id = ?", entry.ID).Updates(map[string]interface{}{
+				"content":      content,
+				"text_content": htmlToText(content),
+				"full_content": sanitizeHTML(entry.FullContent, entry.Link),
+				"sanitized":    sanitizerVersion,
+			}).Error
+			if err != nil {
+				return fmt.Errorf("could not sanitize entry %d: %v", entry.ID, err)
+			}
+			lastID = entry.ID
+		}
+		log.Infof("sanitized entry batch %d", batch)
+	}
+}
+
+// ensureSource 返回 URL 对应的全局 source，不存在时创建
+func ensureSource(db *gorm.DB, url, title string) (int64, error) {
+	now := time.Now().Unix()
+	source := Source{URL: url, Title: title, CreateAt: now, UpdateAt: now}
+
+	if err := db.Where("url = ?", url).FirstOrCreate(&source).Error; err != nil {
+		return 0, fmt.Errorf("could not get source: %v", err)
+	}
+
+	return source.ID, nil
+}
+
+const (
+	// 列表每页的文章数
+	articlePageSize = 50
+	// 正文少于这个长度时列表页不显示阅读入口
+	readableContentMinLength = 30
+)
+
+// 列表页需要的列，不包含正文
+var articleListColumns = []string{"uid", "feed_id", "read", "favorite", "highlight", "publish_at", "entry_id", "item_id"}
+
 type Article struct {
-	Uid       string `json:"uid" gorm:"column:uid"`
-	Name      string `json:"name" gorm:"column:name"`
-	FeedID    int64  `json:"feed_id" gorm:"column:feed_id"`
-	Email     string `json:"email" gorm:"column:email"`
-	Title     string `json:"title" gorm:"column:title"`
-	Link      string `json:"link" gorm:"column:link"`
-	Read      bool   `json:"read" gorm:"column:read"`
-	Deleted   bool   `json:"deleted" gorm:"column:deleted"`
-	Favorite  bool   `json:"favorite" gorm:"column:favorite;default:false"`
-	CreateAt  int64  `json:"create_at" gorm:"column:create_at"`
-	PublishAt int64  `json:"publish_at" gorm:"column:publish_at"`
-	Content   string `json:"content" gorm:"column:content"`
+	Uid           string      `json:"uid" gorm:"column:uid;index:idx_articles_email_publish,priority:3"`
+	Name          string      `json:"name" gorm:"column:name;->;-:migration"` // 订阅名、标题和链接只读，来自 feeds 和 entries
+	FeedID        int64       `json:"feed_id" gorm:"column:feed_id;uniqueIndex:idx_articles_email_feed_guid,priority:2"`
+	Email         string      `json:"email" gorm:"column:email;uniqueIndex:idx_articles_email_feed_guid,priority:1;index:idx_articles_email_publish,priority:1"`
+	GUID          string      `json:"guid" gorm:"column:guid;uniqueIndex:idx_articles_email_feed_guid,priority:3"`
+	Title         string      `json:"title" gorm:"column:title;->;-:migration"`
+	Link          string      `json:"link" gorm:"column:link;->;-:migration"`
+	Read          bool        `json:"read" gorm:"column:read"`
+	Deleted       bool        `json:"deleted" gorm:"column:deleted"`
+	Favorite      bool        `json:"favorite" gorm:"column:favorite;default:false"`
+	Highlight     bool        `json:"highlight" gorm:"column:highlight;default:false"` // 由过滤规则标记
+	CreateAt      int64       `json:"create_at" gorm:"column:create_at"`
+	PublishAt     int64       `json:"publish_at" gorm:"column:publish_at;index:idx_articles_email_publish,priority:2"`
+	PublishSource string      `json:"publish_source" gorm:"column:publish_source;type:text"` // published / updated / first_seen
+	EntryID       int64       `json:"entry_id" gorm:"column:entry_id;index"`
+	Content       string      `json:"content" gorm:"-"` // 正文保存在 entries 表，由 loadArticleContent 填充
+	FullContent   string      `json:"full_content" gorm:"-"`
+	Enclosures    []Enclosure `json:"enclosures" gorm:"-"`
+	// 列表页只需要知道有没有可读的正文，由 loadArticleListFlags 填充
+	HasContent     bool `json:"-" gorm:"-"`
+	HasFullContent bool `json:"-" gorm:"-"`
+	// 播客/视频的播放进度（秒），每个用户独立保存
+	PlaybackPosition int `json:"playback_position" gorm:"column:playback_position;default:0"`
+	// 每个用户内递增的数字 id，供只支持整数 id 的客户端（Fever）使用，由 assignArticleItemIDs 分配
+	ItemID int64 `json:"item_id" gorm:"column:item_id;default:0;index"`
+}
+
+// Source 是全局的订阅源，同一个 URL 只保存一份，Feed 是用户对它的订阅
+type Source struct {
+	ID       int64  `json:"id" gorm:"primaryKey;column:id"`
+	URL      string `json:"url" gorm:"column:url;uniqueIndex"`
+	Title    string `json:"title" gorm:"column:title"`
+	CreateAt int64  `json:"create_at" gorm:"column:create_at"`
+	UpdateAt int64  `json:"update_at" gorm:"column:update_at"`
+	// 最近一次主动抓取到内容的时间，seen_at 早于它的 entry 已经不在 feed 中
+	FetchedAt int64 `json:"fetched_at" gorm:"column:fetched_at;default:0"`
+
+	// WebSub 订阅状态，按 source 共享
+	Hub               string `json:"hub" gorm:"column:hub;type:text"`
+	Topic             string `json:"topic" gorm:"column:topic;type:text"`
+	WebSubSecret      string `json:"-" gorm:"column:websub_secret;type:text"`
+	WebSubState       string `json:"websub_state" gorm:"column:websub_state;type:text"` // pending / subscribed / denied
+	WebSubRequestedAt int64  `json:"websub_requested_at" gorm:"column:websub_requested_at;default:0"`
+	WebSubExpiresAt   int64  `json:"websub_expires_at" gorm:"column:websub_expires_at;default:0"`
+}
+
+// Enclosure 是条目附带的音频/视频等媒体文件，和 entry 一样全局共享
+type Enclosure struct {
+	ID       int64  `json:"id" gorm:"primaryKey;column:id"`
+	EntryID  int64  `json:"entry_id" gorm:"column:entry_id;uniqueIndex:idx_enclosures_entry_url,priority:1"`
+	URL      string `json:"url" gorm:"column:url;uniqueIndex:idx_enclosures_entry_url,priority:2"`
+	MimeType string `json:"mime_type" gorm:"column:mime_type;type:text"`
+	Length   int64  `json:"length" gorm:"column:length;default:0"`     // 字节
+	Duration int    `json:"duration" gorm:"column:duration;default:0"` // 秒，来自 itunes:duration
+}
+
+// Entry 是全局的文章条目，按 source + guid 去重，正文只存一份；Article 只保存用户自己的状态
+type Entry struct {
+	ID            int64  `json:"id" gorm:"primaryKey;column:id"`
+	SourceID      int64  `json:"source_id" gorm:"column:source_id;uniqueIndex:idx_entries_source_guid,priority:1"`
+	GUID          string `json:"guid" gorm:"column:guid;uniqueIndex:idx_entries_source_guid,priority:2"`
+	Title         string `json:"title" gorm:"column:title"`
+	Link          string `json:"link" gorm:"column:link"`
+	Content       string `json:"content" gorm:"column:content;type:text"`
+	TextContent   string `json:"-" gorm:"column:text_content;type:text"`            // 正文的纯文本，用于全文搜索
+	FullContent   string `json:"full_content" gorm:"column:full_content;type:text"` // 开启 readability 时从文章页面提取的正文
+	FullContentAt int64  `json:"full_content_at" gorm:"column:full_content_at;default:0"`
+	Sanitized     int    `json:"sanitized" gorm:"column:sanitized;default:0"` // 清洗时使用的 sanitizerVersion
+	PublishAt     int64  `json:"publish_at" gorm:"column:publish_at"`
+	PublishSource string `json:"publish_source" gorm:"column:publish_source;type:text"`
+	SeenAt        int64  `json:"seen_at" gorm:"column:seen_at;default:0"` // 最近一次出现在 feed 中的时间
+	CreateAt      int64  `json:"create_at" gorm:"column:create_at"`
+	UpdateAt      int64  `json:"update_at" gorm:"column:update_at"`
 }
 
 type Feed struct {
-	ID                int64  `json:"id" gorm:"column:id"`
-	URL               string `json:"url" gorm:"column:url"`
-	Title             string `json:"title" gorm:"column:title"`
-	CreateAt          int64  `json:"create_at" gorm:"column:create_at"`
-	Priority          int    `json:"priority" gorm:"column:priority"`
-	LastFetchedAt     int64  `json:"last_fetched_at" gorm:"column:last_fetched_at"`
-	Email             string `json:"email" gorm:"column:email"`
-	HideUnread        bool   `json:"hide_unread" gorm:"column:hide_unread"`
-	EnableReadability bool   `json:"enable_readability" gorm:"column:enable_readability"`
-	Highlight         bool   `json:"highlight" gorm:"column:highlight"`
-	Categories        string `json:"categories" gorm:"column:categories;type:text"`
+	ID                  int64  `json:"id" gorm:"column:id"`
+	URL                 string `json:"url" gorm:"column:url"`
+	Title               string `json:"title" gorm:"column:title"`
+	CreateAt            int64  `json:"create_at" gorm:"column:create_at"`
+	Priority            int    `json:"priority" gorm:"column:priority"`
+	LastFetchedAt       int64  `json:"last_fetched_at" gorm:"column:last_fetched_at"`
+	Email               string `json:"email" gorm:"column:email"`
+	HideUnread          bool   `json:"hide_unread" gorm:"column:hide_unread"`
+	EnableReadability   bool   `json:"enable_readability" gorm:"column:enable_readability"`
+	Highlight           bool   `json:"highlight" gorm:"column:highlight"`
+	Categories          string `json:"categories" gorm:"column:categories;type:text"`
+	SourceID            int64  `json:"source_id" gorm:"column:source_id;index"`
+	ETag                string `json:"etag" gorm:"column:etag;type:text"`
+	LastModified        string `json:"last_modified" gorm:"column:last_modified;type:text"`
+	LastError           string `json:"last_error" gorm:"column:last_error;type:text"`
+	ErrorCount          int    `json:"error_count" gorm:"column:error_count;default:0"`
+	LastStatus          int    `json:"last_status" gorm:"column:last_status;default:0"`
+	LastSuccessAt       int64  `json:"last_success_at" gorm:"column:last_success_at;default:0"`
+	RefreshInterval     int    `json:"refresh_interval" gorm:"column:refresh_interval;default:0"` // 分钟，0 表示自动
+	AutoRefreshInterval int    `json:"auto_refresh_interval" gorm:"column:auto_refresh_interval;default:0"`
 }
 
 type Category struct {
@@ -110,6 +412,59 @@ type Category struct {
 	UpdateAt int64  `json:"update_at" gorm:"column:update_at"`
 }
 
+// Rule 是用户的过滤规则，在文章写入前执行。所有填写的条件都满足时执行动作
+type Rule struct {
+	ID             int64  `json:"-" gorm:"primaryKey;column:id"`
+	Email          string `json:"-" gorm:"column:email;index"`
+	Name           string `json:"name" gorm:"column:name"`
+	Enabled        bool   `json:"enabled" gorm:"column:enabled"`
+	FeedID         int64  `json:"-" gorm:"column:feed_id;default:0"`                           // 0 表示所有订阅
+	FeedURL        string `json:"feed_url,omitempty" gorm:"-"`                                 // 导出时代替 feed_id
+	TitlePattern   string `json:"title_pattern,omitempty" gorm:"column:title_pattern"`         // 子串，或 /正则/i
+	ContentPattern string `json:"content_pattern,omitempty" gorm:"column:content_pattern"`     // 同上，匹配正文纯文本
+	ShorterThan    int    `json:"shorter_than,omitempty" gorm:"column:shorter_than;default:0"` // 正文少于多少个字
+	MarkRead       bool   `json:"mark_read" gorm:"column:mark_read"`
+	Favorite       bool   `json:"favorite" gorm:"column:favorite"`
+	Highlight      bool   `json:"highlight" gorm:"column:highlight"`
+	Drop           bool   `json:"drop" gorm:"column:drop_item"`
+	CreateAt       int64  `json:"-" gorm:"column:create_at"`
+	UpdateAt       int64  `json:"-" gorm:"column:update_at"`
+}
+
+// BulkAction 记录用户最近一次批量操作实际改动的文章，用于撤销
+type BulkAction struct {
+	ID       int64  `json:"id" gorm:"primaryKey;column:id"`
+	Email    string `json:"email" gorm:"column:email;index"`
+	Action   string `json:"action" gorm:"column:action"`
+	Uids     string `json:"-" gorm:"column:uids;type:text"` // JSON 数组
+	Count    int    `json:"count" gorm:"column:count"`
+	CreateAt int64  `json:"create_at" gorm:"column:create_at"`
+}
+
+// APIToken 是给脚本和客户端使用的个人令牌，只保存哈希
+type APIToken struct {
+	ID         int64  `json:"id" gorm:"primaryKey;column:id"`
+	Email      string `json:"-" gorm:"column:email;index"`
+	Name       string `json:"name" gorm:"column:name"`
+	Scope      string `json:"scope" gorm:"column:scope"` // read / write
+	TokenHash  string `json:"-" gorm:"column:token_hash;uniqueIndex"`
+	Prefix     string `json:"prefix" gorm:"column:prefix"` // 令牌开头几位，用于在列表中辨认
+	LastUsedAt int64  `json:"last_used_at" gorm:"column:last_used_at;default:0"`
+	CreateAt   int64  `json:"create_at" gorm:"column:create_at"`
+}
+
+// SavedSearch 是保存的搜索，作为虚拟 feed 显示在分类旁边
+type SavedSearch struct {
+	ID        int64  `json:"id" gorm:"primaryKey;column:id"`
+	Email     string `json:"email" gorm:"column:email;index"`
+	Name      string `json:"name" gorm:"column:name"`
+	Query     string `json:"query" gorm:"column:query;type:text"` // 搜索语法，由 parseSearchQuery 解析
+	Highlight bool   `json:"highlight" gorm:"column:highlight;default:false"`
+	CreateAt  int64  `json:"create_at" gorm:"column:create_at"`
+	UpdateAt  int64  `json:"update_at" gorm:"column:update_at"`
+	Unread    int64  `json:"unread" gorm:"-"`
+}
+
 type UserPreference struct {
 	ID                 int64  `json:"id" gorm:"primaryKey;column:id"`
 	Email              string `json:"email" gorm:"column:email;index"`
@@ -124,15 +479,42 @@ type UserPreference struct {
 	AISummaryPrompt    string `json:"ai_summary_prompt" gorm:"column:ai_summary_prompt;type:text"`
 	EnableAISummary    bool   `json:"enable_ai_summary" gorm:"column:enable_ai_summary;default:false"`
 	AISummaryTime      string `json:"ai_summary_time" gorm:"column:ai_summary_time;default:'22:00'"`
+	ReadOnScroll       bool   `json:"read_on_scroll" gorm:"column:read_on_scroll;default:false"` // 列表滚动经过时自动标记已读
+	FeverKeyHash       string `json:"-" gorm:"column:fever_key_hash;index"`                      // Fever api_key 的哈希，为空表示未启用
 	EnableGitHubLogin  bool   `json:"enable_github_login" gorm:"column:enable_github_login;default:false"`
 	GitHubClientID     string `json:"github_client_id" gorm:"column:github_client_id;type:text"`
 	GitHubSecret       string `json:"github_secret" gorm:"column:github_secret;type:text"`
 	OpenAIAPIKey       string `json:"openai_api_key" gorm:"column:openai_api_key;type:text"`
 	OpenAIEndpoint     string `json:"openai_endpoint" gorm:"column:openai_endpoint;type:text"`
+	LastItemID         int64  `json:"-" gorm:"column:last_item_id;default:0"` // 已分配的最大 Article.ItemID，只增不减，不随设置保存
 	CreateAt           int64  `json:"create_at" gorm:"column:create_at"`
 	UpdateAt           int64  `json:"update_at" gorm:"column:update_at"`
 }
 
+// User 是可以登录的账号，管理员预先添加的邮箱或使用邀请码注册的 GitHub 用户才能登录
+type User struct {
+	ID          int64  `json:"id" gorm:"primaryKey;column:id"`
+	Email       string `json:"email" gorm:"column:email;uniqueIndex"`
+	Role        string `json:"role" gorm:"column:role;default:'member'"` // admin / member / readonly
+	Disabled    bool   `json:"disabled" gorm:"column:disabled;default:false"`
+	InviteCode  string `json:"invite_code" gorm:"column:invite_code"` // 注册时使用的邀请码，管理员添加的为空
+	LastLoginAt int64  `json:"last_login_at" gorm:"column:last_login_at;default:0"`
+	CreateAt    int64  `json:"create_at" gorm:"column:create_at"`
+	UpdateAt    int64  `json:"update_at" gorm:"column:update_at"`
+}
+
+// Invite 是一次性的注册邀请码
+type Invite struct {
+	ID        int64  `json:"id" gorm:"primaryKey;column:id"`
+	Code      string `json:"code" gorm:"column:code;uniqueIndex"`
+	Role      string `json:"role" gorm:"column:role"`
+	CreatedBy string `json:"created_by" gorm:"column:created_by"`
+	UsedBy    string `json:"used_by" gorm:"column:used_by"`
+	UsedAt    int64  `json:"used_at" gorm:"column:used_at;default:0"`
+	ExpireAt  int64  `json:"expire_at" gorm:"column:expire_at;default:0"` // 0 表示不过期
+	CreateAt  int64  `json:"create_at" gorm:"column:create_at"`
+}
+
 type AISummary struct {
 	ID           int64  `json:"id" gorm:"primaryKey;column:id"`
 	Email        string `json:"email" gorm:"column:email;index"`
@@ -157,12 +539,16 @@ const (
 	SceneUserPref = "user_pref"
 )
 
-func updateFeed(email, id string, hideUnread, enableReadability, highlight bool) error {
+func updateFeed(email, id string, hideUnread, enableReadability, highlight bool, refreshInterval int) error {
 	feed := getFeed(id, email)
+	if refreshInterval != feed.RefreshInterval && !validRefreshInterval(refreshInterval) {
+		return errInvalidRefreshInterval
+	}
 
 	if feed.ID == 0 || (feed.HideUnread == hideUnread &&
 		feed.EnableReadability == enableReadability &&
-		feed.Highlight == highlight) {
+		feed.Highlight == highlight &&
+		feed.RefreshInterval == refreshInterval) {
 		return nil
 	}
 
@@ -173,6 +559,7 @@ func updateFeed(email, id string, hideUnread, enableReadability, highlight bool)
 			"hide_unread":        hideUnread,
 			"enable_readability": enableReadability,
 			"highlight":          highlight,
+			"refresh_interval":   refreshInterval,
 		}).Error
 	if err != nil {
 		return fmt.Errorf("could not update feed: %v", err)
@@ -181,7 +568,8 @@ func updateFeed(email, id string, hideUnread, enableReadability, highlight bool)
 	return nil
 }
 
-func getReadArticle(uid, email string) (Article, error) {
+// getArticle 只读取文章，已读状态由 setArticleRead 显式修改，避免 GET 请求被预取时误标已读
+func getArticle(uid, email string) (Article, error) {
 	article := Article{}
 
 	err := globalDB.Where("uid = ? and email = ?", uid, email).First(&article).Error
@@ -189,126 +577,443 @@ func getReadArticle(uid, email string) (Article, error) {
 		return article, fmt.Errorf("could not get article: %v", err)
 	}
 
-	err = globalDB.Model(article).Where("uid = ? and email = ?", uid, email).Update("read", true).Error
-	if err != nil {
-		return article, fmt.Errorf("could not read article: %v", err)
+	articles := []Article{article}
+	loadArticleContent(articles)
+
+	return articles[0], nil
+}
+
+// loadArticleContent 从 entries 和 feeds 表批量补齐文章的标题、链接、订阅名和正文
+func loadArticleContent(articles []Article) {
+	ids := make([]int64, 0, len(articles))
+	names := make(map[int64]string)
+	for _, article := range articles {
+		if article.EntryID != 0 {
+			ids = append(ids, article.EntryID)
+		}
+		names[article.FeedID] = ""
 	}
 
-	return article, nil
+	contents := make(map[int64]Entry, len(ids))
+	for start := 0; start < len(ids); start += 500 {
+		end := min(start+500, len(ids))
+
+		var entries []Entry
+		if err := globalDB.Select("id", "title", "link", "content", "full_content").Where("id IN ?", ids[start:end]).Find(&entries).Error; err != nil {
+			log.Errorf("could not load article content: %v", err)
+			return
+		}
+		for _, entry := range entries {
+			contents[entry.ID] = entry
+		}
+	}
+
+	feedIDs := make([]int64, 0, len(names))
+	for id := range names {
+		feedIDs = append(feedIDs, id)
+	}
+	var feeds []Feed
+	if err := globalDB.Select("id", "title").Where("id IN ?", feedIDs).Find(&feeds).Error; err != nil {
+		log.Errorf("could not load article feeds: %v", err)
+	}
+	for _, fd := range feeds {
+		names[fd.ID] = fd.Title
+	}
+
+	enclosures := getEntryEnclosures(ids)
+	for i := range articles {
+		entry := contents[articles[i].EntryID]
+		articles[i].Title, articles[i].Link, articles[i].Name = entry.Title, entry.Link, names[articles[i].FeedID]
+		articles[i].Content, articles[i].FullContent = entry.Content, entry.FullContent
+		articles[i].Enclosures = enclosures[articles[i].EntryID]
+	}
 }
 
-func addFeedAndCreateArticles(feedURL, email string) (int64, error) {
-	fp := gofeed.NewParser()
-	feed, err := fp.ParseURL(feedURL)
-	if err != nil {
-		return 0, fmt.Errorf("could not fetch feed: %v", err)
+// addFeedAndCreateArticles 订阅 discoverFeeds 找到的 feed，发现时已经抓取过的直接使用其结果
+func addFeedAndCreateArticles(discovered discoveredFeed, email string) (int64, error) {
+	feedURL, result := discovered.URL, discovered.result
+	if result == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), feedFetchTimeout)
+		defer cancel()
+
+		var err error
+		if result, err = fetchFeed(ctx, &Feed{URL: feedURL}); err != nil {
+			return 0, err
+		}
 	}
+	feed := result.Feed
 
 	feedID, err := getSetFeed(feedURL, email, feed.Title, time.Now().Unix())
 	if err != nil {
 		return 0, fmt.Errorf("could not set feed: %v", err)
 	}
 
-	articles := make([]*Article, 0, len(feed.Items))
-	for _, item := range feed.Items {
-		if !rssItemTimeFilter(item, time.Hour*24*7) {
+	_, entries, err := saveFetchedEntries(feedURL, result)
+	if err != nil {
+		return feedID, err
+	}
+
+	weekAgo := time.Now().Add(-time.Hour * 24 * 7).Unix()
+	rules := getEnabledRules(email)
+	articles := make([]*Article, 0, len(entries))
+	for _, entry := range entries {
+		if entry.PublishAt <= weekAgo {
 			continue
 		}
-
-		articles = append(articles, &Article{
-			Uid:       uuid.New().String(),
-			Name:      feed.Title,
-			FeedID:    feedID,
-			Email:     email,
-			Title:     item.Title,
-			Link:      item.Link,
-			Read:      false,
-			Deleted:   false,
-			Content:   item.Content,
-			PublishAt: item.PublishedParsed.Unix(),
-			CreateAt:  time.Now().Unix(),
-		})
+		article := newSubscriberArticle(feedID, email, feed.Title, entry)
+		applyRules(rules, article, entry)
+		articles = append(articles, article)
 	}
 
-	if err := globalDB.CreateInBatches(articles, 10).Error; err != nil {
+	// 重复添加同一个 feed 时忽略已存在的文章
+	err = globalDB.Clauses(clause.OnConflict{
+		Columns:   articleGUIDConflictColumns,
+		DoNothing: true,
+	}).CreateInBatches(articles, 10).Error
+	if err != nil {
 		return feedID, fmt.Errorf("could not create articles: %v", err)
 	}
 
 	return feedID, nil
 }
 
-func parseFeedAndSaveArticles(fd *Feed) ([]*Article, error) {
-	fp := gofeed.NewParser()
+func newSubscriberArticle(feedID int64, email, name string, entry *Entry) *Article {
+	return &Article{
+		Uid:           uuid.New().String(),
+		Name:          name,
+		FeedID:        feedID,
+		Email:         email,
+		GUID:          entry.GUID,
+		Title:         entry.Title,
+		Link:          entry.Link,
+		Read:          false,
+		Deleted:       false,
+		CreateAt:      time.Now().Unix(),
+		PublishAt:     entry.PublishAt,
+		PublishSource: entry.PublishSource,
+		EntryID:       entry.ID,
+		Content:       entry.Content,
+	}
+}
 
-	feed, err := fp.ParseURL(fd.URL)
+func parseFeedAndSaveArticles(ctx context.Context, fd *Feed) ([]*Article, error) {
+	result, err := fetchFeed(ctx, fd)
 	if err != nil {
 		log.Errorf("ticker to get feed error: %v", err)
-		feed = &gofeed.Feed{}
+		recordFeedFailure(fd, result, err)
+		return nil, err
 	}
 
-	feedFilter := func(item *gofeed.Item) bool {
-		if item == nil {
-			return false
-		}
-		if fd.LastFetchedAt == 0 {
-			return rssItemTimeFilter(item, time.Hour*24*7)
+	sourceID, entries, err := saveFetchedEntries(fd.URL, result)
+	if err != nil {
+		return nil, err
+	}
+
+	return saveSubscriberArticles(fd, result, sourceID, entries)
+}
+
+// parseFeedGroupAndSaveArticles 对同一个 URL 只抓取一次，条目只写入一份，再把结果分发给每个订阅者
+func parseFeedGroupAndSaveArticles(ctx context.Context, group *feedGroup) error {
+	probe := &Feed{URL: group.URL}
+
+	// 只有所有订阅者的校验头一致时才能发条件请求，否则 304 对部分订阅者不成立
+	first := group.Feeds[0]
+	sameValidators := true
+	for _, fd := range group.Feeds[1:] {
+		if fd.ETag != first.ETag || fd.LastModified != first.LastModified {
+			sameValidators = false
+			break
 		}
+	}
+	if sameValidators {
+		probe.ETag, probe.LastModified = first.ETag, first.LastModified
+	}
 
-		if item.PublishedParsed == nil {
-			return false
+	result, err := fetchFeed(ctx, probe)
+	if err != nil {
+		log.Errorf("ticker to get feed error: %v", err)
+		for _, fd := range group.Feeds {
+			recordFeedFailure(fd, result, err)
 		}
+		return err
+	}
 
-		return item.PublishedParsed.After(time.Unix(fd.LastFetchedAt, 0))
+	return saveFeedGroupResult(group.URL, group.Feeds, result)
+}
+
+// saveFeedGroupResult 把一次抓取或推送的结果写入 entries，再分发给同一 URL 的所有订阅者
+func saveFeedGroupResult(url string, feeds []*Feed, result *fetchResult) error {
+	sourceID, entries, err := saveFetchedEntries(url, result)
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, fd := range feeds {
+		if _, err := saveSubscriberArticles(fd, result, sourceID, entries); err != nil {
+			log.Errorf("could not save articles for feed %d (%s): %v", fd.ID, fd.Email, err)
+			failed++
+		}
 	}
+	if failed > 0 {
+		return fmt.Errorf("could not save articles for %d of %d subscribers", failed, len(feeds))
+	}
+
+	return nil
+}
 
-	// 获取已存在的文章标题，用于去重
-	var existingTitles []string
-	if err := globalDB.Model(&Article{}).
-		Where("feed_id = ? AND email = ?", fd.ID, fd.Email).
-		Pluck("title", &existingTitles).Error; err != nil {
-		log.Errorf("failed to fetch existing titles: %v", err)
+// saveFetchedEntries 把抓取结果写入全局 entries 表，已存在的 guid 只更新标题、链接和正文，
+// 返回按 feed 顺序排列的条目
+func saveFetchedEntries(url string, result *fetchResult) (int64, []*Entry, error) {
+	if result.NotModified {
+		return 0, nil, nil
 	}
 
-	// 创建标题映射，用于快速查找
-	existingTitlesMap := make(map[string]bool)
-	for _, title := range existingTitles {
-		existingTitlesMap[title] = true
+	feed := result.Feed
+	sourceID, err := ensureSource(globalDB, url, feed.Title)
+	if err != nil {
+		return 0, nil, err
 	}
 
-	articles := make([]*Article, 0, len(feed.Items))
+	// 推送的内容不一定带 hub 链接，只在主动抓取时更新
+	if !result.Pushed {
+		if err := updateSourceHub(sourceID, result.Hub, result.Topic); err != nil {
+			return sourceID, nil, err
+		}
+	}
 
+	now := time.Now()
+	guids := make([]string, 0, len(feed.Items))
+	items := make(map[string]*gofeed.Item, len(feed.Items))
 	for _, item := range feed.Items {
-		if !feedFilter(item) {
+		if item == nil {
+			continue
+		}
+		guid := itemGUID(item)
+		if _, dup := items[guid]; dup {
 			continue
 		}
+		items[guid] = item
+		guids = append(guids, guid)
+	}
+	if len(guids) == 0 {
+		return sourceID, nil, markEntriesSeen(sourceID, guids, result.Pushed, now.Unix())
+	}
+
+	// 只查询本次 feed 中出现的 guid，避免随历史增长变慢
+	loadEntries := func() (map[string]*Entry, error) {
+		var rows []*Entry
+		if err := globalDB.Where("source_id = ? AND guid IN ?", sourceID, guids).Find(&rows).Error; err != nil {
+			return nil, fmt.Errorf("could not get existing entries: %v", err)
+		}
+		existing := make(map[string]*Entry, len(rows))
+		for _, row := range rows {
+			existing[row.GUID] = row
+		}
+		return existing, nil
+	}
+
+	existing, err := loadEntries()
+	if err != nil {
+		return sourceID, nil, err
+	}
 
-		// 标题去重检查
-		if _, exists := existingTitlesMap[item.Title]; exists {
-			log.Infof("skipping duplicate article: %s", item.Title)
+	creates := make([]*Entry, 0, len(guids))
+	for _, guid := range guids {
+		item := items[guid]
+		content := sanitizeHTML(item.Content, item.Link)
+
+		if old, ok := existing[guid]; ok {
+			if old.Title == item.Title && old.Link == item.Link && old.Content == content {
+				continue
+			}
+
+			log.Infof("updating edited entry: %s", item.Title)
+			err := globalDB.Model(&Entry{}).Where("id = ?", old.ID).Updates(map[string]interface{}{
+				"title":        item.Title,
+				"link":         item.Link,
+				"content":      content,
+				"text_content": htmlToText(content),
+				"sanitized":    sanitizerVersion,
+				"update_at":    now.Unix(),
+			}).Error
+			if err != nil {
+				return sourceID, nil, fmt.Errorf("could not update entry: %v", err)
+			}
 			continue
 		}
 
-		articles = append(articles, &Article{
-			Uid:       uuid.New().String(),
-			Name:      feed.Title,
-			FeedID:    fd.ID,
-			Email:     fd.Email,
-			Title:     item.Title,
-			Link:      item.Link,
-			Read:      false,
-			Deleted:   false,
-			Content:   item.Content,
-			PublishAt: item.PublishedParsed.Unix(),
-			CreateAt:  time.Now().Unix(),
+		publishAt, publishSource := itemPublishTime(item, now)
+		creates = append(creates, &Entry{
+			SourceID:      sourceID,
+			GUID:          guid,
+			Title:         item.Title,
+			Link:          item.Link,
+			Content:       content,
+			TextContent:   htmlToText(content),
+			Sanitized:     sanitizerVersion,
+			PublishAt:     publishAt.Unix(),
+			PublishSource: publishSource,
+			CreateAt:      now.Unix(),
+			UpdateAt:      now.Unix(),
 		})
 	}
 
-	err = globalDB.Transaction(func(tx *gorm.DB) error {
-		if err := tx.CreateInBatches(articles, 10).Error; err != nil {
+	if len(creates) > 0 {
+		err := globalDB.Clauses(clause.OnConflict{
+			Columns:   entryGUIDConflictColumns,
+			DoNothing: true,
+		}).CreateInBatches(creates, 10).Error
+		if err != nil {
+			return sourceID, nil, fmt.Errorf("could not create entries: %v", err)
+		}
+	}
+
+	if err := markEntriesSeen(sourceID, guids, result.Pushed, now.Unix()); err != nil {
+		return sourceID, nil, err
+	}
+
+	if existing, err = loadEntries(); err != nil {
+		return sourceID, nil, err
+	}
+
+	entries := make([]*Entry, 0, len(guids))
+	for _, guid := range guids {
+		if entry, ok := existing[guid]; ok {
+			entries = append(entries, entry)
+		}
+	}
+
+	if err := saveEntryEnclosures(entries, items); err != nil {
+		return sourceID, nil, err
+	}
+
+	return sourceID, entries, nil
+}
+
+// markEntriesSeen 记录本次 feed 中出现的条目，主动抓取时同时推进 source 的 fetched_at。
+// 推送通常只包含新条目，不能据此判断其他条目已经移出 feed
+func markEntriesSeen(sourceID int64, guids []string, pushed bool, now int64) error {
+	if len(guids) > 0 {
+		err := globalDB.Model(&Entry{}).Where("source_id = ? AND guid IN ?", sourceID, guids).Update("seen_at", now).Error
+		if err != nil {
+			return fmt.Errorf("could not mark entries seen: %v", err)
+		}
+	}
+	if pushed {
+		return nil
+	}
+
+	if err := globalDB.Model(&Source{}).Where("id = ?", sourceID).Update("fetched_at", now).Error; err != nil {
+		return fmt.Errorf("could not update source fetched time: %v", err)
+	}
+	return nil
+}
+
+// saveSubscriberArticles 为单个订阅者创建或更新文章状态行，已存在的 guid 保留 uid 和已读/收藏状态
+func saveSubscriberArticles(fd *Feed, result *fetchResult, sourceID int64, entries []*Entry) ([]*Article, error) {
+	if result.NotModified {
+		log.Infof("feed not modified: %s", fd.URL)
+		err := globalDB.Model(&Feed{ID: fd.ID}).Updates(feedSuccessUpdates(result)).Error
+		if err != nil {
+			return nil, fmt.Errorf("could not update feed item: %v", err)
+		}
+		return nil, nil
+	}
+
+	feed := result.Feed
+
+	// 失败期间 last_fetched_at 仍会前进，因此以上次成功抓取时间为准
+	lastSuccessAt := fd.LastSuccessAt
+	if lastSuccessAt == 0 {
+		lastSuccessAt = fd.LastFetchedAt
+	}
+
+	weekAgo := time.Now().Add(-time.Hour * 24 * 7).Unix()
+	entryFilter := func(entry *Entry) bool {
+		if lastSuccessAt == 0 {
+			return entry.PublishAt > weekAgo
+		}
+		return entry.PublishAt > lastSuccessAt
+	}
+
+	guids := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		guids = append(guids, entry.GUID)
+	}
+
+	existing := make(map[string]Article)
+	if len(guids) > 0 {
+		var rows []Article
+		if err := globalDB.Select("guid", "entry_id").
+			Where("email = ? AND feed_id = ? AND guid IN ?", fd.Email, fd.ID, guids).
+			Find(&rows).Error; err != nil {
+			return nil, fmt.Errorf("could not get existing articles: %v", err)
+		}
+		for _, row := range rows {
+			existing[row.GUID] = row
+		}
+	}
+
+	articles := make([]*Article, 0, len(entries))
+	upserts := make([]*Article, 0, len(entries))
+	var rules []*compiledRule
+
+	for _, entry := range entries {
+		old, exists := existing[entry.GUID]
+		if exists && old.EntryID == entry.ID {
+			continue
+		}
+
+		if !exists && !entryFilter(entry) {
+			continue
+		}
+
+		article := newSubscriberArticle(fd.ID, fd.Email, feed.Title, entry)
+		if !exists {
+			// 规则只作用于新文章，已有文章保留用户自己的状态
+			if rules == nil {
+				rules = getEnabledRules(fd.Email)
+			}
+			applyRules(rules, article, entry)
+			if !article.Deleted {
+				articles = append(articles, article)
+			}
+		}
+		upserts = append(upserts, article)
+	}
+
+	err := globalDB.Transaction(func(tx *gorm.DB) error {
+		// 已存在的 guid 只更新关联的 entry，保留 uid 和已读/收藏状态
+		if err := tx.Clauses(clause.OnConflict{
+			Columns:   articleGUIDConflictColumns,
+			DoUpdates: clause.AssignmentColumns([]string{"entry_id"}),
+		}).CreateInBatches(upserts, 10).Error; err != nil {
 			return fmt.Errorf("could not create articles: %v", err)
 		}
 
-		if err := tx.Model(&Feed{ID: fd.ID}).Update("last_fetched_at", time.Now().Unix()).Error; err != nil {
+		// 已删除的文章只需要在条目还在 feed 中时保留 guid，移出 feed 后直接删除
+		if !result.Pushed {
+			if err := tx.Where("email = ? AND feed_id = ? AND deleted = ? AND guid NOT IN ?", fd.Email, fd.ID, true, guids).
+				Delete(&Article{}).Error; err != nil {
+				return fmt.Errorf("could not delete dropped articles: %v", err)
+			}
+		}
+
+		// 推送通常只包含新条目，不更新抓取状态，避免影响轮询的时间过滤和自动间隔
+		updates := map[string]interface{}{}
+		if !result.Pushed {
+			updates = feedSuccessUpdates(result)
+			updates["auto_refresh_interval"] = int(adaptiveRefreshInterval(feed) / time.Minute)
+		}
+		if fd.SourceID == 0 && sourceID != 0 {
+			updates["source_id"] = sourceID
+		}
+		if len(updates) == 0 {
+			return nil
+		}
+
+		if err := tx.Model(&Feed{ID: fd.ID}).Updates(updates).Error; err != nil {
 			return fmt.Errorf("could not update feed item: %v", err)
 		}
 
@@ -322,6 +1027,37 @@ func parseFeedAndSaveArticles(fd *Feed) ([]*Article, error) {
 	return articles, nil
 }
 
+func feedSuccessUpdates(result *fetchResult) map[string]interface{} {
+	now := time.Now().Unix()
+	return map[string]interface{}{
+		"last_fetched_at": now,
+		"last_success_at": now,
+		"last_status":     result.StatusCode,
+		"last_error":      "",
+		"error_count":     0,
+		"etag":            result.ETag,
+		"last_modified":   result.LastModified,
+	}
+}
+
+// recordFeedFailure 记录抓取失败，error_count 用于计算退避时间
+func recordFeedFailure(fd *Feed, result *fetchResult, fetchErr error) {
+	status := 0
+	if result != nil {
+		status = result.StatusCode
+	}
+
+	err := globalDB.Model(&Feed{ID: fd.ID}).Updates(map[string]interface{}{
+		"last_fetched_at": time.Now().Unix(),
+		"last_status":     status,
+		"last_error":      truncateRunes(fetchErr.Error(), 500),
+		"error_count":     gorm.Expr("error_count + 1"),
+	}).Error
+	if err != nil {
+		log.Errorf("could not record feed failure: %v", err)
+	}
+}
+
 func getCategories(email string) []Category {
 	categories := []Category{}
 
@@ -451,11 +1187,76 @@ func getUserPreference(email string) (*UserPreference, error) {
 	return &pref, nil
 }
 
+var articleItemIDMu sync.Mutex
+
+// assignArticleItemIDs 按入库顺序为还没有 item_id 的文章分配 id，已分配的 id 不会改变。
+// 计数器保存在 UserPreference.LastItemID 上，只增不减，删除文章后也不会复用客户端已经见过的 id
+func assignArticleItemIDs(email string) error {
+	articleItemIDMu.Lock()
+	defer articleItemIDMu.Unlock()
+
+	// 确保计数器所在的设置行存在
+	if _, err := getUserPreference(email); err != nil {
+		return err
+	}
+
+	for {
+		var uids []string
+		err := globalDB.Model(&Article{}).Where("email = ? AND (item_id IS NULL OR item_id = 0)", email).
+			Order("create_at asc, publish_at asc, uid asc").Limit(bulkChunkSize).Pluck("uid", &uids).Error
+		if err != nil {
+			return fmt.Errorf("could not get articles without item id: %v", err)
+		}
+		if len(uids) == 0 {
+			return nil
+		}
+
+		err = globalDB.Transaction(func(tx *gorm.DB) error {
+			var last int64
+			if err := tx.Model(&UserPreference{}).Select("last_item_id").Where("email = ?", email).Scan(&last).Error; err != nil {
+				return fmt.Errorf("could not get last item id: %v", err)
+			}
+			for _, uid := range uids {
+				last++
+				if err := tx.Model(&Article{}).Where("uid = ? AND email = ?", uid, email).Update("item_id", last).Error; err != nil {
+					return fmt.Errorf("could not set article item id: %v", err)
+				}
+			}
+			if err := tx.Model(&UserPreference{}).Where("email = ?", email).Update("last_item_id", last).Error; err != nil {
+				return fmt.Errorf("could not update last item id: %v", err)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// migrateArticleItemIDs 为计数器出现之前已经分配过 item_id 的用户初始化 last_item_id
+func migrateArticleItemIDs(db *gorm.DB) error {
+	err := db.Model(&UserPreference{}).Where("last_item_id = 0").Update("last_item_id",
+		db.Model(&Article{}).Select("COALESCE(MAX(item_id), 0)").Where("articles.email = user_preferences.email")).Error
+	if err != nil {
+		return fmt.Errorf("could not migrate last item ids: %v", err)
+	}
+	return nil
+}
+
+func readOnScrollEnabled(email string) bool {
+	pref, err := getUserPreference(email)
+	if err != nil {
+		log.Errorf("could not get user preference: %v", err)
+		return false
+	}
+	return pref.ReadOnScroll
+}
+
 func updateUserPreference(email string, pref *UserPreference) error {
 	pref.UpdateAt = time.Now().Unix()
 
-	// 使用Select指定要更新的字段，包括零值字段
-	err := globalDB.Model(&UserPreference{}).Where("email = ?", email).Select("*").Updates(pref).Error
+	// 使用Select指定要更新的字段，包括零值字段；item id 计数器由 assignArticleItemIDs 单独维护
+	err := globalDB.Model(&UserPreference{}).Where("email = ?", email).Select("*").Omit("last_item_id").Updates(pref).Error
 	if err != nil {
 		return fmt.Errorf("could not update user preference: %v", err)
 	}
@@ -466,20 +1267,25 @@ func updateUserPreference(email string, pref *UserPreference) error {
 	return nil
 }
 
+// cleanupExpiredArticles 和 cleanupReadArticles 与 deleteArticle 一样只做软删除，
+// 保留的 guid 防止仍在 feed 中的条目在下次抓取时作为新文章插入
 func cleanupExpiredArticles(email string, days int) (int64, error) {
 	expiredTime := time.Now().AddDate(0, 0, -days).Unix()
-	result := globalDB.Where("email = ? AND read = false AND publish_at < ?", email, expiredTime).Delete(&Article{})
+	result := globalDB.Model(&Article{}).Where("email = ? AND read = false AND deleted = false AND publish_at < ?", email, expiredTime).
+		Update("deleted", true)
 	if result.Error != nil {
 		return 0, fmt.Errorf("could not cleanup expired articles: %v", result.Error)
 	}
+	pruneSharedStorage()
 	return result.RowsAffected, nil
 }
 
 func cleanupReadArticles(email string) (int64, error) {
-	result := globalDB.Where("email = ? AND read = true", email).Delete(&Article{})
+	result := globalDB.Model(&Article{}).Where("email = ? AND read = true AND deleted = false", email).Update("deleted", true)
 	if result.Error != nil {
 		return 0, fmt.Errorf("could not cleanup read articles: %v", result.Error)
 	}
+	pruneSharedStorage()
 	return result.RowsAffected, nil
 }
 
@@ -544,6 +1350,8 @@ func getArticlesForAISummary(email string, date time.Time) ([]Article, error) {
 		return nil, fmt.Errorf("could not get articles for AI summary: %v", err)
 	}
 
+	loadArticleContent(articles)
+
 	log.Infof("Found %d articles for AI summary", len(articles))
 	return articles, nil
 }
@@ -578,6 +1386,11 @@ func getFeedCategoriesForAISummary(email string, articles []Article) (map[int64]
 }
 
 func getSetFeed(url, email, title string, lastFetchedAt int64) (int64, error) {
+	sourceID, err := ensureSource(globalDB, url, title)
+	if err != nil {
+		return 0, err
+	}
+
 	feed := &Feed{
 		URL:           url,
 		Title:         title,
@@ -585,6 +1398,7 @@ func getSetFeed(url, email, title string, lastFetchedAt int64) (int64, error) {
 		CreateAt:      time.Now().Unix(),
 		Priority:      1,
 		LastFetchedAt: lastFetchedAt,
+		SourceID:      sourceID,
 	}
 
 	result := globalDB.Where("url = ? and email = ?", url, email).FirstOrCreate(feed)
@@ -592,6 +1406,12 @@ func getSetFeed(url, email, title string, lastFetchedAt int64) (int64, error) {
 		return 0, result.Error
 	}
 
+	if feed.SourceID == 0 {
+		if err := globalDB.Model(feed).Update("source_id", sourceID).Error; err != nil {
+			return feed.ID, fmt.Errorf("could not set feed source: %v", err)
+		}
+	}
+
 	return feed.ID, nil
 }
 
@@ -603,66 +1423,91 @@ func getFeed(id, email string) *Feed {
 	return &feed
 }
 
-func getRecentlyArticles(email string) []Article {
-	articles := []Article{}
+func getRecentlyArticles(email string, showHidden bool, cursor string) ([]Article, string) {
+	query := globalDB.Where("email = ? and read = false and deleted = false", email)
+	if !showHidden {
+		query = query.Where("feed_id NOT IN (?)", globalDB.Model(&Feed{}).Select("id").Where("email = ? AND hide_unread = ?", email, true))
+	}
 
-	err := globalDB.Where("email = ? and read = false", email).Order("publish_at desc").Find(&articles).Error
+	articles, next, err := findArticlePage(query, cursor)
 	if err != nil {
 		log.Infof("could not get articles: %v", err)
-		return nil
+		return nil, ""
 	}
-
-	return articles
+	return articles, next
 }
 
+// deleteArticle 只做软删除，保留 guid 防止文章在下次抓取时被重新插入
 func deleteArticle(uid, email string) error {
-	err := globalDB.Where("uid = ? AND email = ?", uid, email).Delete(&Article{}).Error
+	err := globalDB.Model(&Article{}).Where("uid = ? AND email = ?", uid, email).Update("deleted", true).Error
 	if err != nil {
 		return fmt.Errorf("could not delete article: %v", err)
 	}
 	return nil
 }
 
-func toggleFavorite(uid, email string) error {
+func setArticleRead(uid, email string, read bool) error {
+	result := globalDB.Model(&Article{}).Where("uid = ? AND email = ?", uid, email).Update("read", read)
+	if result.Error != nil {
+		return fmt.Errorf("could not update read status: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("could not find article: %s", uid)
+	}
+	return nil
+}
+
+func toggleRead(uid, email string) error {
 	var article Article
 	err := globalDB.Where("uid = ? AND email = ?", uid, email).First(&article).Error
 	if err != nil {
 		return fmt.Errorf("could not find article: %v", err)
 	}
 
-	err = globalDB.Model(&Article{}).Where("uid = ? AND email = ?", uid, email).Update("favorite", !article.Favorite).Error
+	return setArticleRead(uid, email, !article.Read)
+}
+
+func toggleFavorite(uid, email string) error {
+	var article Article
+	err := globalDB.Where("uid = ? AND email = ?", uid, email).First(&article).Error
 	if err != nil {
-		return fmt.Errorf("could not update favorite status: %v", err)
+		return fmt.Errorf("could not find article: %v", err)
+	}
+
+	return setArticleFavorite(uid, email, !article.Favorite)
+}
+
+func setArticleFavorite(uid, email string, favorite bool) error {
+	result := globalDB.Model(&Article{}).Where("uid = ? AND email = ?", uid, email).Update("favorite", favorite)
+	if result.Error != nil {
+		return fmt.Errorf("could not update favorite status: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("could not find article: %s", uid)
 	}
 	return nil
 }
 
-func getFavoriteArticles(email string) []Article {
-	articles := []Article{}
-	err := globalDB.Where("email = ? AND favorite = ?", email, true).Order("publish_at desc").Find(&articles).Error
+func getFavoriteArticles(email, cursor string) ([]Article, string) {
+	articles, next, err := findArticlePage(globalDB.Where("email = ? AND favorite = ? AND deleted = false", email, true), cursor)
 	if err != nil {
 		log.Infof("could not get favorite articles: %v", err)
-		return nil
+		return nil, ""
 	}
-	return articles
+	return articles, next
 }
 
-func getFeedArticles(email, feedID string) []Article {
-	articles := []Article{}
-
-	err := globalDB.Where("email = ? and feed_id = ? and read = false",
-		email, feedID).Order("publish_at desc").Find(&articles).Error
+func getFeedArticles(email, feedID, cursor string) ([]Article, string) {
+	articles, next, err := findArticlePage(globalDB.Where("email = ? and feed_id = ? and read = false and deleted = false", email, feedID), cursor)
 	if err != nil {
 		log.Infof("could not get articles: %v", err)
-		return nil
+		return nil, ""
 	}
-
-	return articles
+	return articles, next
 }
 
-func getArticlesByCategory(email, category string) []Article {
-	articles := []Article{}
-
+// getCategoryFeedIDs 返回分类下的订阅，分类为空表示未分类（Inbox）
+func getCategoryFeedIDs(email, category string) ([]int64, error) {
 	var feedIDs []int64
 	var err error
 
@@ -673,21 +1518,111 @@ func getArticlesByCategory(email, category string) []Article {
 	}
 
 	if err != nil {
-		log.Infof("could not get feed IDs for category: %v", err)
-		return nil
+		return nil, fmt.Errorf("could not get feed IDs for category: %v", err)
+	}
+	return feedIDs, nil
+}
+
+func getArticlesByCategory(email, category, cursor string) ([]Article, string) {
+	feedIDs, err := getCategoryFeedIDs(email, category)
+	if err != nil {
+		log.Info(err)
+		return nil, ""
 	}
 
 	if len(feedIDs) == 0 {
-		return articles
+		return []Article{}, ""
 	}
 
-	err = globalDB.Where("email = ? AND feed_id IN ? AND read = false", email, feedIDs).Order("publish_at desc").Find(&articles).Error
+	articles, next, err := findArticlePage(globalDB.Where("email = ? AND feed_id IN ? AND read = false AND deleted = false", email, feedIDs), cursor)
 	if err != nil {
 		log.Infof("could not get articles by category: %v", err)
-		return nil
+		return nil, ""
 	}
+	return articles, next
+}
+
+// findArticlePage 按 (publish_at, uid) 倒序做 keyset 分页，只查询列表需要的列，
+// 分页后再关联 entries 和 feeds 取标题、链接和订阅名。
+// cursor 为空表示第一页，返回的 next 为空表示没有下一页
+func findArticlePage(query *gorm.DB, cursor string) ([]Article, string, error) {
+	if publishAt, uid, ok := parseArticleCursor(cursor); ok {
+		query = query.Where("(publish_at < ? OR (publish_at = ? AND uid < ?))", publishAt, publishAt, uid)
+	}
+	page := query.Model(&Article{}).Select(articleListColumns).Order("publish_at desc, uid desc").Limit(articlePageSize + 1)
 
-	return articles
+	articles := []Article{}
+	err := globalDB.Table("(?) AS p", page).
+		Select("p.*, e.title, e.link, f.title AS name").
+		Joins("LEFT JOIN entries e ON e.id = p.entry_id").
+		Joins("LEFT JOIN feeds f ON f.id = p.feed_id").
+		Order("p.publish_at desc, p.uid desc").
+		Find(&articles).Error
+	if err != nil {
+		return nil, "", err
+	}
+
+	next := ""
+	if len(articles) > articlePageSize {
+		articles = articles[:articlePageSize]
+		last := articles[len(articles)-1]
+		next = fmt.Sprintf("%d:%s", last.PublishAt, last.Uid)
+	}
+
+	loadArticleListFlags(articles)
+	return articles, next, nil
+}
+
+func parseArticleCursor(cursor string) (int64, string, bool) {
+	rawPublishAt, uid, found := strings.Cut(cursor, ":")
+	if !found || uid == "" {
+		return 0, "", false
+	}
+
+	publishAt, err := strconv.ParseInt(rawPublishAt, 10, 64)
+	if err != nil {
+		return 0, "", false
+	}
+	return publishAt, uid, true
+}
+
+// loadArticleListFlags 只查询列表页需要的正文状态，不加载正文本身
+func loadArticleListFlags(articles []Article) {
+	ids := make([]int64, 0, len(articles))
+	for _, article := range articles {
+		if article.EntryID != 0 {
+			ids = append(ids, article.EntryID)
+		}
+	}
+	if len(ids) == 0 {
+		return
+	}
+
+	var flags []struct {
+		ID             int64
+		HasContent     bool
+		HasFullContent bool
+	}
+	err := globalDB.Model(&Entry{}).
+		Select("id, COALESCE(LENGTH(content), 0) >= ? AS has_content, COALESCE(LENGTH(full_content), 0) > 0 AS has_full_content", readableContentMinLength).
+		Where("id IN ?", ids).Scan(&flags).Error
+	if err != nil {
+		log.Errorf("could not load article flags: %v", err)
+		return
+	}
+
+	byID := make(map[int64]int, len(flags))
+	for i, flag := range flags {
+		byID[flag.ID] = i
+	}
+
+	enclosures := getEntryEnclosures(ids)
+	for i := range articles {
+		if j, ok := byID[articles[i].EntryID]; ok {
+			articles[i].HasContent, articles[i].HasFullContent = flags[j].HasContent, flags[j].HasFullContent
+		}
+		articles[i].Enclosures = enclosures[articles[i].EntryID]
+	}
 }
 
 func getFeeds(email string) []Feed {
@@ -702,10 +1637,12 @@ func getFeeds(email string) []Feed {
 	return feeds
 }
 
-func getEmailsFeeds(emails []string) []Feed {
+// getAllFeeds 返回所有用户订阅的 feed，供后台抓取任务使用
+func getAllFeeds() []Feed {
 	feeds := []Feed{}
 
-	err := globalDB.Where("email in ?", emails).Order("create_at desc").Find(&feeds).Error
+	// 停用账号的订阅不再抓取
+	err := globalDB.Where("email <> '' AND email NOT IN (?)", disabledUserEmails()).Order("create_at desc").Find(&feeds).Error
 	if err != nil {
 		log.Infof("could not get feeds: %v", err)
 		return nil
@@ -724,6 +1661,46 @@ func deleteFeed(email, id string) {
 	if err != nil {
 		log.Infof("could not delete article: %v", err)
 	}
+
+	pruneSharedStorage()
+}
+
+// pruneSharedStorage 删除已经没有订阅的 source，以及没有未删除文章引用、并且已经不在
+// source 最近一次抓取结果中的 entry，再删除引用这些 entry 的已删除文章。
+// 还在 feed 中的 entry 删除后会在下次抓取时重新入库
+func pruneSharedStorage() {
+	err := globalDB.Where("id NOT IN (?)",
+		globalDB.Model(&Feed{}).Select("source_id").Where("source_id IS NOT NULL")).Delete(&Source{}).Error
+	if err != nil {
+		log.Errorf("could not prune sources: %v", err)
+	}
+
+	result := globalDB.Where("id NOT IN (?)",
+		globalDB.Model(&Article{}).Select("entry_id").Where("entry_id IS NOT NULL AND deleted = ?", false)).
+		Where("NOT EXISTS (?)",
+			globalDB.Model(&Source{}).Select("1").Where("sources.id = entries.source_id AND sources.fetched_at <= entries.seen_at")).
+		Delete(&Entry{})
+	if result.Error != nil {
+		log.Errorf("could not prune entries: %v", result.Error)
+	}
+
+	// 被删除的 entry 可能属于待撤销的批量删除，撤销后文章会指向不存在的 entry，因此丢弃这些撤销记录
+	if result.RowsAffected > 0 {
+		if err := globalDB.Where("action = ?", "delete").Delete(&BulkAction{}).Error; err != nil {
+			log.Errorf("could not drop bulk delete undo records: %v", err)
+		}
+	}
+
+	err = globalDB.Where("deleted = ? AND entry_id > 0 AND entry_id NOT IN (?)", true, globalDB.Model(&Entry{}).Select("id")).
+		Delete(&Article{}).Error
+	if err != nil {
+		log.Errorf("could not prune deleted articles: %v", err)
+	}
+
+	err = globalDB.Where("entry_id NOT IN (?)", globalDB.Model(&Entry{}).Select("id")).Delete(&Enclosure{}).Error
+	if err != nil {
+		log.Errorf("could not prune enclosures: %v", err)
+	}
 }
 
 func refreshFeed(email, id string) {
@@ -733,15 +1710,12 @@ func refreshFeed(email, id string) {
 		return
 	}
 
-	parseFeedAndSaveArticles(feed)
-}
+	ctx, cancel := context.WithTimeout(context.Background(), feedFetchTimeout)
+	defer cancel()
 
-func rssItemTimeFilter(item *gofeed.Item, dur time.Duration) bool {
-	if item == nil || item.PublishedParsed == nil {
-		return false
+	if _, err := parseFeedAndSaveArticles(ctx, feed); err != nil {
+		log.Errorf("could not refresh feed %d: %v", feed.ID, err)
 	}
-
-	return item.PublishedParsed.Unix() > time.Now().Add(-dur).Unix()
 }
 
 func getFeedMetaWithCache(feedID int64) FeedMetaCache {
@@ -768,6 +1742,12 @@ func getFeedMetaWithCache(feedID int64) FeedMetaCache {
 }
 
 func isAdminUser(email string) bool {
+	user, err := getActiveUser(email)
+	return err == nil && user.Role == userRoleAdmin
+}
+
+// ownsSiteSettings 站点级设置（GitHub 登录、OpenAI）只从默认用户的偏好中读取，其他管理员不能修改
+func ownsSiteSettings(email string) bool {
 	return email == DefaultEmail
 }
 
@@ -792,7 +1772,11 @@ func getYesterdayHighlightedUnreadArticlesForUser(email string) ([]Article, erro
 		return nil, fmt.Errorf("failed to fetch highlighted feed IDs for user %s: %v", email, err)
 	}
 
-	if len(highlightedFeedIDs) == 0 {
+	var highlightedSearches, highlightRules int64
+	globalDB.Model(&SavedSearch{}).Where("email = ? AND highlight = ?", email, true).Count(&highlightedSearches)
+	globalDB.Model(&Rule{}).Where("email = ? AND highlight = ?", email, true).Count(&highlightRules)
+
+	if len(highlightedFeedIDs) == 0 && highlightedSearches == 0 && highlightRules == 0 {
 		return nil, fmt.Errorf("no highlighted feeds found for user %s", email)
 	}
 
@@ -801,14 +1785,37 @@ func getYesterdayHighlightedUnreadArticlesForUser(email string) ([]Article, erro
 	start := time.Date(yesterday.Year(), yesterday.Month(), yesterday.Day(), 0, 0, 0, 0, TimeZone)
 	end := start.Add(24 * time.Hour)
 
+	// 高亮 feed 的文章和被规则标记高亮的文章
+	query := globalDB.Where("email = ? AND publish_at >= ? AND publish_at < ? AND read = ? AND deleted = ?",
+		email, start.Unix(), end.Unix(), false, false)
+	if len(highlightedFeedIDs) > 0 {
+		query = query.Where("(feed_id IN ? OR highlight = ?)", highlightedFeedIDs, true)
+	} else {
+		query = query.Where("highlight = ?", true)
+	}
+
 	var articles []Article
-	err := globalDB.Where("email = ? AND publish_at >= ? AND publish_at < ? AND read = ? AND deleted = ? AND feed_id IN ?",
-		email, start.Unix(), end.Unix(), false, false, highlightedFeedIDs).
-		Find(&articles).Error
+	if err := query.Find(&articles).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch articles for user %s: %v", email, err)
+	}
 
+	// 保存搜索匹配的文章和高亮 feed 的文章合并去重
+	matched, err := getHighlightedSavedSearchArticles(email, start, end)
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch articles for user %s: %v", email, err)
+		return nil, err
+	}
+
+	seen := make(map[string]bool, len(articles))
+	for _, article := range articles {
+		seen[article.Uid] = true
+	}
+	for _, article := range matched {
+		if !seen[article.Uid] {
+			seen[article.Uid] = true
+			articles = append(articles, article)
+		}
 	}
 
+	loadArticleContent(articles)
 	return articles, nil
 }
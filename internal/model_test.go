@@ -0,0 +1,303 @@
+package internal
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// useTestDB 用临时 sqlite 替换 globalDB，测试结束后还原
+func useTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "rssy.db")), &gorm.Config{
+		Logger: logger.Discard,
+	})
+	if err != nil {
+		t.Fatalf("open test db: %v", err)
+	}
+	if err := db.AutoMigrate(&Article{}, &Feed{}, &Source{}, &Entry{}, &Enclosure{}, &SavedSearch{}, &Rule{}, &BulkAction{}, &APIToken{}, &UserPreference{}, &AISummary{}, &Category{}, &User{}, &Invite{}); err != nil {
+		t.Fatalf("migrate test db: %v", err)
+	}
+
+	old := globalDB
+	globalDB = db
+	t.Cleanup(func() { globalDB = old })
+
+	return db
+}
+
+func TestSaveFeedGroupResultSharesEntries(t *testing.T) {
+	db := useTestDB(t)
+
+	alice, err := getSetFeed("https://example.com/feed", "alice@example.com", "Example", 0)
+	if err != nil {
+		t.Fatalf("getSetFeed() error = %v", err)
+	}
+	bob, err := getSetFeed("https://example.com/feed", "bob@example.com", "Example", 0)
+	if err != nil {
+		t.Fatalf("getSetFeed() error = %v", err)
+	}
+
+	now := time.Now()
+	result := &fetchResult{Feed: &gofeed.Feed{
+		Title: "Example",
+		Items: []*gofeed.Item{{
+			GUID:            "post-1",
+			Title:           "Post",
+			Link:            "https://example.com/post-1",
+			Content:         "<p>long content</p>",
+			PublishedParsed: &now,
+		}},
+	}}
+
+	var feeds []*Feed
+	db.Where("id IN ?", []int64{alice, bob}).Find(&feeds)
+	if err := saveFeedGroupResult("https://example.com/feed", feeds, result); err != nil {
+		t.Fatalf("saveFeedGroupResult() error = %v", err)
+	}
+
+	var sources, entries, articles int64
+	db.Model(&Source{}).Count(&sources)
+	db.Model(&Entry{}).Count(&entries)
+	db.Model(&Article{}).Count(&articles)
+	if sources != 1 || entries != 1 || articles != 2 {
+		t.Fatalf("sources, entries, articles = %d, %d, %d, want 1, 1, 2", sources, entries, articles)
+	}
+
+	got, _ := getRecentlyArticles("bob@example.com", false, "")
+	loadArticleContent(got)
+	if len(got) != 1 || got[0].Content != "<p>long content</p>" {
+		t.Fatalf("bob's articles = %+v", got)
+	}
+	uid := got[0].Uid
+
+	// 编辑后的正文只更新共享的 entry，用户的文章状态保持不变
+	result.Feed.Items[0].Content = "<p>edited</p>"
+	var fd Feed
+	db.First(&fd, bob)
+	if err := saveFeedGroupResult(fd.URL, []*Feed{&fd}, result); err != nil {
+		t.Fatalf("saveFeedGroupResult() error = %v", err)
+	}
+
+	got, _ = getRecentlyArticles("alice@example.com", false, "")
+	loadArticleContent(got)
+	if len(got) != 1 || got[0].Content != "<p>edited</p>" {
+		t.Fatalf("alice should see the edited entry, got %+v", got)
+	}
+	got, _ = getRecentlyArticles("bob@example.com", false, "")
+	if len(got) != 1 || got[0].Uid != uid {
+		t.Fatalf("bob's article should keep uid %s, got %+v", uid, got)
+	}
+}
+
+func TestMigrateSharedStorage(t *testing.T) {
+	db := useTestDB(t)
+
+	// 模拟旧版本按用户保存正文、标题和链接的表结构
+	for _, column := range []string{"content", "title", "link", "name"} {
+		if err := db.Exec("ALTER TABLE articles ADD COLUMN " + column + " text").Error; err != nil {
+			t.Fatalf("add legacy column: %v", err)
+		}
+	}
+	for _, fd := range []Feed{
+		{ID: 1, URL: "https://example.com/feed", Email: "alice@example.com"},
+		{ID: 2, URL: "https://example.com/feed", Email: "bob@example.com"},
+	} {
+		if err := db.Create(&fd).Error; err != nil {
+			t.Fatalf("create feed: %v", err)
+		}
+	}
+	for i, email := range []string{"alice@example.com", "bob@example.com"} {
+		err := db.Exec("INSERT INTO articles (uid, feed_id, email, guid, title, content) VALUES (?, ?, ?, ?, ?, ?)",
+			email, i+1, email, "post-1", "Post", "<p>legacy</p>").Error
+		if err != nil {
+			t.Fatalf("insert legacy article: %v", err)
+		}
+	}
+
+	if err := migrateSharedStorage(db); err != nil {
+		t.Fatalf("migrateSharedStorage() error = %v", err)
+	}
+
+	for _, column := range []string{"content", "title", "link", "name"} {
+		if db.Migrator().HasColumn(&Article{}, column) {
+			t.Fatalf("articles.%s should be dropped", column)
+		}
+	}
+
+	var entries []Entry
+	db.Find(&entries)
+	if len(entries) != 1 || entries[0].Content != "<p>legacy</p>" || entries[0].Title != "Post" {
+		t.Fatalf("entries = %+v", entries)
+	}
+
+	var articles []Article
+	db.Find(&articles)
+	for _, article := range articles {
+		if article.EntryID != entries[0].ID {
+			t.Fatalf("article %s entry_id = %d, want %d", article.Uid, article.EntryID, entries[0].ID)
+		}
+	}
+
+	var feeds []Feed
+	db.Find(&feeds)
+	if len(feeds) != 2 || feeds[0].SourceID == 0 || feeds[0].SourceID != feeds[1].SourceID {
+		t.Fatalf("feeds should share one source, got %+v", feeds)
+	}
+}
+
+func TestArticlePagination(t *testing.T) {
+	db := useTestDB(t)
+
+	hidden := Feed{ID: 2, URL: "https://example.com/hidden", Email: "alice@example.com", HideUnread: true}
+	if err := db.Create(&hidden).Error; err != nil {
+		t.Fatalf("create feed: %v", err)
+	}
+	entry := Entry{SourceID: 1, GUID: "long", Title: "Long", Content: strings.Repeat("x", readableContentMinLength)}
+	if err := db.Create(&entry).Error; err != nil {
+		t.Fatalf("create entry: %v", err)
+	}
+
+	// 相同的 publish_at 跨页时也不能丢失或重复
+	total := articlePageSize*2 + 5
+	for i := 0; i < total; i++ {
+		article := Article{
+			Uid:       fmt.Sprintf("uid-%03d", i),
+			FeedID:    1,
+			Email:     "alice@example.com",
+			GUID:      fmt.Sprintf("guid-%03d", i),
+			PublishAt: int64(i / 3),
+			EntryID:   entry.ID,
+		}
+		if err := db.Create(&article).Error; err != nil {
+			t.Fatalf("create article: %v", err)
+		}
+	}
+	db.Create(&Article{Uid: "hidden", FeedID: hidden.ID, Email: "alice@example.com", GUID: "hidden", PublishAt: 1000})
+
+	seen := make(map[string]bool)
+	cursor, pages := "", 0
+	lastPublishAt := int64(1 << 62)
+	for {
+		articles, next := getRecentlyArticles("alice@example.com", false, cursor)
+		pages++
+		for _, article := range articles {
+			if seen[article.Uid] || article.Uid == "hidden" {
+				t.Fatalf("unexpected article %s on page %d", article.Uid, pages)
+			}
+			if article.PublishAt > lastPublishAt {
+				t.Fatalf("articles out of order at %s", article.Uid)
+			}
+			if !article.HasContent || article.Content != "" || article.Title != "Long" {
+				t.Fatalf("list should carry the entry title and only content flags, got %+v", article)
+			}
+			seen[article.Uid], lastPublishAt = true, article.PublishAt
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+
+	if len(seen) != total || pages != 3 {
+		t.Fatalf("paged %d articles in %d pages, want %d in 3", len(seen), pages, total)
+	}
+
+	if articles, _ := getRecentlyArticles("alice@example.com", true, ""); articles[0].Uid != "hidden" {
+		t.Fatalf("show hidden should include hidden feeds, got %s", articles[0].Uid)
+	}
+}
+
+func TestArticleReadState(t *testing.T) {
+	db := useTestDB(t)
+	email := "alice@example.com"
+
+	if err := db.Create(&Article{Uid: "a1", Email: email, FeedID: 1, GUID: "a1"}).Error; err != nil {
+		t.Fatalf("create article: %v", err)
+	}
+	isRead := func() bool {
+		var article Article
+		db.Where("uid = ?", "a1").First(&article)
+		return article.Read
+	}
+
+	// 读取文章不再修改已读状态
+	if _, err := getArticle("a1", email); err != nil || isRead() {
+		t.Fatalf("getArticle() should not mark read, err = %v", err)
+	}
+
+	if err := toggleRead("a1", email); err != nil || !isRead() {
+		t.Fatalf("toggleRead() should mark read, err = %v", err)
+	}
+	if err := toggleRead("a1", email); err != nil || isRead() {
+		t.Fatalf("toggleRead() should mark unread, err = %v", err)
+	}
+	if err := setArticleRead("a1", email, true); err != nil || !isRead() {
+		t.Fatalf("setArticleRead() err = %v", err)
+	}
+	if err := setArticleRead("a1", "bob@example.com", false); err == nil || !isRead() {
+		t.Fatalf("other users should not change the article")
+	}
+}
+
+func TestCleanupKeepsGUIDs(t *testing.T) {
+	db := useTestDB(t)
+
+	email := "alice@example.com"
+	feedID, _ := getSetFeed("https://example.com/feed", email, "Example", 0)
+	now := time.Now()
+	// 没有日期的条目每次入库都会得到新的首次发现时间
+	items := []*gofeed.Item{
+		{GUID: "dated", Title: "Dated", PublishedParsed: &now},
+		{GUID: "undated", Title: "Undated"},
+	}
+	fetch := func(items []*gofeed.Item) {
+		t.Helper()
+		var fd Feed
+		db.First(&fd, feedID)
+		if err := saveFeedGroupResult(fd.URL, []*Feed{&fd}, &fetchResult{Feed: &gofeed.Feed{Title: "Example", Items: items}}); err != nil {
+			t.Fatalf("saveFeedGroupResult() error = %v", err)
+		}
+	}
+	fetch(items)
+
+	db.Model(&Article{}).Where("guid = ?", "dated").Update("read", true)
+	if n, err := cleanupReadArticles(email); err != nil || n != 1 {
+		t.Fatalf("cleanupReadArticles() = %d, %v", n, err)
+	}
+	if n, err := cleanupExpiredArticles(email, -1); err != nil || n != 1 {
+		t.Fatalf("cleanupExpiredArticles() = %d, %v", n, err)
+	}
+
+	// 仍在 feed 中的条目不会作为新文章重新出现
+	fetch(items)
+	if articles, _ := getRecentlyArticles(email, true, ""); len(articles) != 0 {
+		t.Fatalf("cleaned articles came back: %+v", articles)
+	}
+	var entries int64
+	if db.Model(&Entry{}).Count(&entries); entries != 2 {
+		t.Fatalf("entries still in the feed should be kept, got %d", entries)
+	}
+
+	// 移出 feed 后 entry 和已删除的文章行才被清理。seen_at 精确到秒，先把上次抓取往前移
+	db.Model(&Entry{}).Where("1 = 1").Update("seen_at", gorm.Expr("seen_at - 60"))
+	fetch([]*gofeed.Item{{GUID: "newer", Title: "Newer"}})
+	pruneSharedStorage()
+	var guids []string
+	db.Model(&Entry{}).Pluck("guid", &guids)
+	if len(guids) != 1 || guids[0] != "newer" {
+		t.Fatalf("entries after prune = %v", guids)
+	}
+	var tombstones int64
+	if db.Model(&Article{}).Where("deleted = ?", true).Count(&tombstones); tombstones != 0 {
+		t.Fatalf("tombstones = %d, want 0", tombstones)
+	}
+}
@@ -0,0 +1,210 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// 单张图片大小上限
+const imageProxyMaxSize = 20 << 20
+
+var (
+	imageCacheDir = orenv("IMAGE_CACHE_DIR", "image-cache")
+	// 图片缓存总大小上限（MB）
+	imageCacheMaxMB = orenvInt("IMAGE_CACHE_MB", 512)
+
+	imageCache     *DiskCache
+	imageCacheOnce sync.Once
+
+	// 图片地址来自 feed 内容，拒绝连接内网地址，避免代理被用来访问内部服务
+	imageProxyClient = &http.Client{
+		Timeout: 30 * time.Second,
+		Transport: &http.Transport{
+			Proxy:       http.ProxyFromEnvironment,
+			DialContext: (&net.Dialer{Timeout: 10 * time.Second, Control: denyPrivateAddress}).DialContext,
+		},
+	}
+)
+
+var errImageNotAllowed = errors.New("image url not allowed")
+
+func denyPrivateAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsMulticast() {
+		return fmt.Errorf("%w: %s", errImageNotAllowed, address)
+	}
+
+	return nil
+}
+
+func getImageCache() *DiskCache {
+	imageCacheOnce.Do(func() {
+		cache, err := NewDiskCache(imageCacheDir, int64(imageCacheMaxMB)<<20)
+		if err != nil {
+			log.Errorf("could not open image cache, images will not be cached: %v", err)
+			return
+		}
+		imageCache = cache
+	})
+	return imageCache
+}
+
+// signImageURL 使用 CipherKey 对图片地址签名，防止 /proxy/image 被当作开放代理
+func signImageURL(rawURL string) string {
+	mac := hmac.New(sha256.New, CipherKey)
+	mac.Write([]byte(rawURL))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func verifyImageURL(rawURL, sig string) bool {
+	expected, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, CipherKey)
+	mac.Write([]byte(rawURL))
+	return hmac.Equal(mac.Sum(nil), expected)
+}
+
+func imageProxyURL(rawURL string) string {
+	return "/proxy/image?url=" + url.QueryEscape(rawURL) + "&sig=" + signImageURL(rawURL)
+}
+
+// rewriteImageURLs 把文章内容中 <img>/<source> 的 src 和 srcset 改写为签名的代理地址，
+// 内容应已经过 sanitizeHTML 处理
+func rewriteImageURLs(content string) string {
+	if !strings.Contains(content, "<img") && !strings.Contains(content, "<source") {
+		return content
+	}
+
+	fragmentContext := &html.Node{Type: html.ElementNode, Data: "div", DataAtom: atom.Div}
+	nodes, err := html.ParseFragment(strings.NewReader(content), fragmentContext)
+	if err != nil {
+		return content
+	}
+
+	var buf bytes.Buffer
+	for _, n := range nodes {
+		walkNodes(n, func(c *html.Node) {
+			if c.Type != html.ElementNode || (c.DataAtom != atom.Img && c.DataAtom != atom.Source) {
+				return
+			}
+			for i, attr := range c.Attr {
+				switch attr.Key {
+				case "src":
+					c.Attr[i].Val = proxiedImageURL(attr.Val)
+				case "srcset":
+					c.Attr[i].Val = proxiedSrcset(attr.Val)
+				}
+			}
+		})
+		if err := html.Render(&buf, n); err != nil {
+			return content
+		}
+	}
+
+	return buf.String()
+}
+
+func proxiedImageURL(raw string) string {
+	lower := strings.ToLower(raw)
+	if !strings.HasPrefix(lower, "http://") && !strings.HasPrefix(lower, "https://") {
+		return raw
+	}
+	return imageProxyURL(raw)
+}
+
+func proxiedSrcset(raw string) string {
+	candidates := strings.Split(raw, ",")
+	for i, candidate := range candidates {
+		fields := strings.Fields(candidate)
+		if len(fields) == 0 {
+			continue
+		}
+		fields[0] = proxiedImageURL(fields[0])
+		candidates[i] = strings.Join(fields, " ")
+	}
+	return strings.Join(candidates, ", ")
+}
+
+// fetchProxiedImage 优先从磁盘缓存读取，未命中时抓取原图并写入缓存。
+// 缓存文件的第一行是 Content-Type
+func fetchProxiedImage(ctx context.Context, rawURL string) (string, []byte, error) {
+	sum := sha256.Sum256([]byte(rawURL))
+	key := hex.EncodeToString(sum[:])
+
+	cache := getImageCache()
+	if cache != nil {
+		if data, ok := cache.Get(key); ok {
+			if contentType, body, found := bytes.Cut(data, []byte("\n")); found {
+				return string(contentType), body, nil
+			}
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return "", nil, fmt.Errorf("could not create request: %v", err)
+	}
+	// 不发送 Referer，部分防盗链站点只允许空 Referer
+	req.Header.Set("User-Agent", feedUserAgent)
+	req.Header.Set("Accept", "image/*")
+
+	resp, err := imageProxyClient.Do(req)
+	if err != nil {
+		return "", nil, fmt.Errorf("could not fetch image: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", nil, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+
+	// 只代理图片，避免把任意 HTML 以本站的源返回给浏览器
+	contentType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil || !strings.HasPrefix(contentType, "image/") {
+		return "", nil, fmt.Errorf("%w: content type %q", errImageNotAllowed, resp.Header.Get("Content-Type"))
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, imageProxyMaxSize+1))
+	if err != nil {
+		return "", nil, fmt.Errorf("could not read image: %v", err)
+	}
+	if len(body) > imageProxyMaxSize {
+		return "", nil, fmt.Errorf("%w: image larger than %d bytes", errImageNotAllowed, imageProxyMaxSize)
+	}
+
+	if cache != nil {
+		if err := cache.Set(key, append([]byte(contentType+"\n"), body...)); err != nil {
+			log.Errorf("could not cache image %s: %v", rawURL, err)
+		}
+	}
+
+	return contentType, body, nil
+}
@@ -0,0 +1,130 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSignImageURL(t *testing.T) {
+	raw := "https://example.com/a.png"
+	if !verifyImageURL(raw, signImageURL(raw)) {
+		t.Fatalf("signature should verify")
+	}
+	if verifyImageURL("https://example.com/b.png", signImageURL(raw)) || verifyImageURL(raw, "bad") {
+		t.Fatalf("tampered url or signature should not verify")
+	}
+}
+
+func TestRewriteImageURLs(t *testing.T) {
+	got := rewriteImageURLs(`<p><img src="https://example.com/a.png" srcset="http://example.com/a.png 1x, https://example.com/a2.png 2x"/><img src="data:image/png;base64,AAAA"/></p>`)
+
+	want := imageProxyURL("https://example.com/a.png")
+	if !strings.Contains(got, `src="`+strings.ReplaceAll(want, "&", "&amp;")+`"`) {
+		t.Fatalf("src should be proxied, got %s", got)
+	}
+	if !strings.Contains(got, strings.ReplaceAll(imageProxyURL("http://example.com/a.png"), "&", "&amp;")+" 1x") ||
+		!strings.Contains(got, strings.ReplaceAll(imageProxyURL("https://example.com/a2.png"), "&", "&amp;")+" 2x") {
+		t.Fatalf("srcset should be proxied, got %s", got)
+	}
+	if !strings.Contains(got, `src="data:image/png;base64,AAAA"`) {
+		t.Fatalf("data url should be kept, got %s", got)
+	}
+
+	proxied, _ := url.Parse(want)
+	if !verifyImageURL(proxied.Query().Get("url"), proxied.Query().Get("sig")) {
+		t.Fatalf("rewritten url should carry a valid signature")
+	}
+}
+
+func TestDiskCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	dir := t.TempDir()
+	cache, err := NewDiskCache(dir, 10)
+	if err != nil {
+		t.Fatalf("NewDiskCache() error = %v", err)
+	}
+
+	cache.Set("a", []byte("aaaa"))
+	cache.Set("b", []byte("bbbb"))
+	if _, ok := cache.Get("a"); !ok {
+		t.Fatalf("a should be cached")
+	}
+	cache.Set("c", []byte("cccc"))
+
+	if _, ok := cache.Get("b"); ok {
+		t.Fatalf("b should be evicted as least recently used")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "b")); !os.IsNotExist(err) {
+		t.Fatalf("evicted file should be removed, stat err = %v", err)
+	}
+	if cache.Size() != 8 {
+		t.Fatalf("Size() = %d, want 8", cache.Size())
+	}
+
+	// 重新打开时从磁盘恢复
+	reopened, err := NewDiskCache(dir, 10)
+	if err != nil {
+		t.Fatalf("NewDiskCache() error = %v", err)
+	}
+	if data, ok := reopened.Get("c"); !ok || string(data) != "cccc" || reopened.Size() != 8 {
+		t.Fatalf("reopened cache lost entries: %q, %v, size %d", data, ok, reopened.Size())
+	}
+}
+
+func TestFetchProxiedImage(t *testing.T) {
+	hits := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		if r.Header.Get("Referer") != "" {
+			t.Errorf("proxy should not send a referer")
+		}
+		if r.URL.Path == "/page" {
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte("<script>alert(1)</script>"))
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte("png-bytes"))
+	}))
+	defer server.Close()
+
+	oldClient, oldCache := imageProxyClient, imageCache
+	imageCacheOnce.Do(func() {})
+	cache, err := NewDiskCache(t.TempDir(), 1<<20)
+	if err != nil {
+		t.Fatalf("NewDiskCache() error = %v", err)
+	}
+	imageCache = cache
+	t.Cleanup(func() { imageProxyClient, imageCache = oldClient, oldCache })
+
+	// 默认客户端拒绝连接内网地址
+	if _, _, err := fetchProxiedImage(context.Background(), server.URL+"/a.png"); !errors.Is(err, errImageNotAllowed) {
+		t.Fatalf("loopback image should be rejected, got %v", err)
+	}
+
+	imageProxyClient = server.Client()
+
+	hits = 0
+	for i := 0; i < 2; i++ {
+		contentType, body, err := fetchProxiedImage(context.Background(), server.URL+"/a.png")
+		if err != nil {
+			t.Fatalf("fetchProxiedImage() error = %v", err)
+		}
+		if contentType != "image/png" || string(body) != "png-bytes" {
+			t.Fatalf("fetchProxiedImage() = %q, %q", contentType, body)
+		}
+	}
+	if hits != 1 {
+		t.Fatalf("second fetch should be served from cache, upstream hits = %d", hits)
+	}
+
+	if _, _, err := fetchProxiedImage(context.Background(), server.URL+"/page"); !errors.Is(err, errImageNotAllowed) {
+		t.Fatalf("non-image response should be rejected, got %v", err)
+	}
+}
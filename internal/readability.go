@@ -0,0 +1,393 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+const (
+	// 每轮最多提取的文章数，剩余的留到下一轮
+	fullTextBatchSize = 50
+	// 临时错误（超时、5xx 等）之后等待多久再重试
+	fullTextRetryDelay = time.Hour
+	// 文章页面大小上限
+	fullTextMaxPageSize = 5 << 20
+	// 正文少于这个字数时认为提取失败
+	fullTextMinLength = 200
+)
+
+// 同时抓取文章页面的数量上限，和 feed 抓取的并发互不占用
+var fullTextConcurrency = orenvInt("FULLTEXT_CONCURRENCY", 2)
+
+var (
+	unlikelyCandidates = regexp.MustCompile(`(?i)banner|breadcrumb|combx|comment|community|cookie|disqus|extra|footer|header|menu|modal|nav|pager|popup|promo|related|remark|rss|share|shoutbox|sidebar|skyscraper|social|sponsor|subscribe|tags|tool|widget|ad-break|advert`)
+	maybeCandidate     = regexp.MustCompile(`(?i)and|article|body|column|content|main|shadow`)
+	positiveWeight     = regexp.MustCompile(`(?i)article|body|content|entry|hentry|h-entry|main|page|post|text|blog|story`)
+	negativeWeight     = regexp.MustCompile(`(?i)hidden|banner|combx|comment|com-|contact|footer|masthead|media|meta|outbrain|promo|related|scroll|share|shoutbox|sidebar|skyscraper|sponsor|shopping|tags|tool|widget`)
+)
+
+// 提取前直接删除的标签
+var fullTextStripTags = map[atom.Atom]bool{
+	atom.Script: true, atom.Style: true, atom.Noscript: true, atom.Iframe: true, atom.Form: true,
+	atom.Nav: true, atom.Aside: true, atom.Footer: true, atom.Header: true, atom.Button: true,
+	atom.Input: true, atom.Select: true, atom.Textarea: true, atom.Link: true, atom.Meta: true,
+}
+
+// errFullTextUnavailable 表示页面本身无法提取正文（4xx、非 HTML、提取失败），重试也不会成功
+var errFullTextUnavailable = errors.New("full text unavailable")
+
+// pendingFullTextEntries 返回开启了 readability 的订阅中还没有提取正文的条目，新条目优先
+func pendingFullTextEntries(limit int, skip []int64) ([]*Entry, error) {
+	query := globalDB.Select("id", "link").
+		Where("full_content_at = ? AND link <> ''", 0).
+		Where("source_id IN (?)", globalDB.Model(&Feed{}).Select("source_id").Where("enable_readability = ?", true))
+	if len(skip) > 0 {
+		query = query.Where("id NOT IN ?", skip)
+	}
+
+	var entries []*Entry
+	if err := query.Order("publish_at desc, id desc").Limit(limit).Find(&entries).Error; err != nil {
+		return nil, fmt.Errorf("could not get pending full text entries: %v", err)
+	}
+	return entries, nil
+}
+
+// extractPendingFullText 从数据库取出一批待提取的条目，用 fullTextConcurrency 个 worker 提取正文。
+// 遇到临时错误的条目记录在 retryAt 中，fullTextRetryDelay 之后再重试，返回本轮处理的条目数
+func extractPendingFullText(ctx context.Context, retryAt map[int64]time.Time) int {
+	now := time.Now()
+	skip := make([]int64, 0, len(retryAt))
+	for id, at := range retryAt {
+		if now.Before(at) {
+			skip = append(skip, id)
+		} else {
+			delete(retryAt, id)
+		}
+	}
+
+	entries, err := pendingFullTextEntries(fullTextBatchSize, skip)
+	if err != nil {
+		log.Error(err)
+		return 0
+	}
+
+	jobs := make(chan *Entry)
+	failed := make(chan int64, len(entries))
+	var wg sync.WaitGroup
+	for i := 0; i < fullTextConcurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for entry := range jobs {
+				if err := extractEntryFullText(ctx, entry); err != nil {
+					log.Errorf("could not extract full text for %s: %v", entry.Link, err)
+					failed <- entry.ID
+				}
+			}
+		}()
+	}
+
+	for _, entry := range entries {
+		jobs <- entry
+	}
+	close(jobs)
+	wg.Wait()
+	close(failed)
+
+	for id := range failed {
+		retryAt[id] = now.Add(fullTextRetryDelay)
+	}
+	return len(entries)
+}
+
+// extractEntryFullText 抓取文章页面并把正文保存在共享的 entry 上。遇到 errFullTextUnavailable
+// 时同样记录 full_content_at，不再重试；其他错误原样返回，由调用方稍后重试
+func extractEntryFullText(ctx context.Context, entry *Entry) error {
+	content, err := fetchFullText(ctx, entry.Link)
+	if err != nil && !errors.Is(err, errFullTextUnavailable) {
+		return err
+	}
+	if err != nil {
+		log.Infof("full text unavailable for %s: %v", entry.Link, err)
+	}
+
+	entry.FullContent, entry.FullContentAt = sanitizeHTML(content, entry.Link), time.Now().Unix()
+	err = globalDB.Model(&Entry{}).Where("id = ?", entry.ID).Updates(map[string]interface{}{
+		"full_content":    entry.FullContent,
+		"full_content_at": entry.FullContentAt,
+	}).Error
+	if err != nil {
+		return fmt.Errorf("could not save full text: %v", err)
+	}
+	return nil
+}
+
+func fetchFullText(ctx context.Context, link string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, feedFetchTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		return "", fmt.Errorf("%w: could not create request: %v", errFullTextUnavailable, err)
+	}
+	req.Header.Set("User-Agent", feedUserAgent)
+
+	resp, err := feedHTTPClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("could not fetch page: %v", err)
+	}
+	defer resp.Body.Close()
+
+	// 408 和 429 是临时的，其余 4xx 重试也没有意义
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 &&
+		resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests {
+		return "", fmt.Errorf("%w: unexpected status: %s", errFullTextUnavailable, resp.Status)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+
+	if contentType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type")); err == nil &&
+		contentType != "text/html" && contentType != "application/xhtml+xml" {
+		return "", fmt.Errorf("%w: content type %q", errFullTextUnavailable, contentType)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, fullTextMaxPageSize))
+	if err != nil {
+		return "", fmt.Errorf("could not read page: %v", err)
+	}
+
+	content, err := extractMainContent(body, resp.Request.URL)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", errFullTextUnavailable, err)
+	}
+	return content, nil
+}
+
+// extractMainContent 是简化的 readability 算法：按段落文本长度和逗号数给父节点打分，
+// 结合 class/id 权重和链接密度选出正文容器，相对链接按页面地址解析
+func extractMainContent(body []byte, pageURL *url.URL) (string, error) {
+	doc, err := html.Parse(bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("could not parse page: %v", err)
+	}
+
+	stripUnlikelyNodes(doc)
+
+	scores := make(map[*html.Node]float64)
+	var candidates []*html.Node
+	addScore := func(n *html.Node, score float64) {
+		if n == nil || n.Type != html.ElementNode {
+			return
+		}
+		if _, ok := scores[n]; !ok {
+			scores[n] = initialNodeScore(n)
+			candidates = append(candidates, n)
+		}
+		scores[n] += score
+	}
+
+	walkNodes(doc, func(n *html.Node) {
+		if n.Type != html.ElementNode || (n.DataAtom != atom.P && n.DataAtom != atom.Pre && n.DataAtom != atom.Td) {
+			return
+		}
+
+		text := strings.TrimSpace(nodeText(n))
+		if len([]rune(text)) < 25 {
+			return
+		}
+
+		score := 1 + float64(strings.Count(text, ",")+strings.Count(text, "，"))
+		score += min(float64(len([]rune(text)))/100, 3)
+
+		addScore(n.Parent, score)
+		if n.Parent != nil {
+			addScore(n.Parent.Parent, score/2)
+		}
+	})
+
+	var best *html.Node
+	bestScore := 0.0
+	for _, n := range candidates {
+		scores[n] *= 1 - linkDensity(n)
+		if best == nil || scores[n] > bestScore {
+			best, bestScore = n, scores[n]
+		}
+	}
+	if best == nil {
+		return "", fmt.Errorf("no content candidate found")
+	}
+
+	// 正文被拆成多个兄弟节点时，把得分接近的兄弟节点一起带上
+	threshold := max(10, bestScore*0.2)
+	var parts []*html.Node
+	if best.Parent == nil {
+		parts = append(parts, best)
+	} else {
+		for sibling := best.Parent.FirstChild; sibling != nil; sibling = sibling.NextSibling {
+			if sibling == best {
+				parts = append(parts, sibling)
+				continue
+			}
+			if score, ok := scores[sibling]; ok && score >= threshold {
+				parts = append(parts, sibling)
+				continue
+			}
+			if sibling.Type == html.ElementNode && sibling.DataAtom == atom.P {
+				text := nodeText(sibling)
+				if len([]rune(text)) > 80 && linkDensity(sibling) < 0.25 {
+					parts = append(parts, sibling)
+				}
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	textLength := 0
+	for _, part := range parts {
+		resolveRelativeURLs(part, pageURL)
+		textLength += len([]rune(strings.TrimSpace(nodeText(part))))
+		if err := html.Render(&buf, part); err != nil {
+			return "", fmt.Errorf("could not render content: %v", err)
+		}
+	}
+
+	if textLength < fullTextMinLength {
+		return "", fmt.Errorf("extracted content too short: %d", textLength)
+	}
+
+	return buf.String(), nil
+}
+
+func stripUnlikelyNodes(n *html.Node) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		if c.Type == html.CommentNode || (c.Type == html.ElementNode && isUnlikelyNode(c)) {
+			n.RemoveChild(c)
+		} else {
+			stripUnlikelyNodes(c)
+		}
+		c = next
+	}
+}
+
+func isUnlikelyNode(n *html.Node) bool {
+	if fullTextStripTags[n.DataAtom] {
+		return true
+	}
+
+	switch n.DataAtom {
+	case atom.Html, atom.Body, atom.Article, atom.Main:
+		return false
+	}
+
+	match := nodeAttr(n, "class") + " " + nodeAttr(n, "id")
+	return unlikelyCandidates.MatchString(match) && !maybeCandidate.MatchString(match)
+}
+
+func initialNodeScore(n *html.Node) float64 {
+	score := 0.0
+	switch n.DataAtom {
+	case atom.Article:
+		score += 10
+	case atom.Div, atom.Main, atom.Section:
+		score += 5
+	case atom.Pre, atom.Td, atom.Blockquote:
+		score += 3
+	case atom.Ol, atom.Ul, atom.Dl, atom.Dd, atom.Dt, atom.Li, atom.Form:
+		score -= 3
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6, atom.Th:
+		score -= 5
+	}
+
+	for _, attr := range []string{nodeAttr(n, "class"), nodeAttr(n, "id")} {
+		if attr == "" {
+			continue
+		}
+		if negativeWeight.MatchString(attr) {
+			score -= 25
+		}
+		if positiveWeight.MatchString(attr) {
+			score += 25
+		}
+	}
+
+	return score
+}
+
+func linkDensity(n *html.Node) float64 {
+	total := len([]rune(nodeText(n)))
+	if total == 0 {
+		return 0
+	}
+
+	linkLength := 0
+	walkNodes(n, func(c *html.Node) {
+		if c.Type == html.ElementNode && c.DataAtom == atom.A {
+			linkLength += len([]rune(nodeText(c)))
+		}
+	})
+
+	return float64(linkLength) / float64(total)
+}
+
+// resolveRelativeURLs 把 href/src 解析为绝对地址，离线阅读时链接和图片仍然可用
+func resolveRelativeURLs(n *html.Node, base *url.URL) {
+	if base == nil {
+		return
+	}
+
+	walkNodes(n, func(c *html.Node) {
+		if c.Type != html.ElementNode {
+			return
+		}
+		for i, attr := range c.Attr {
+			if attr.Key != "href" && attr.Key != "src" {
+				continue
+			}
+			if u, err := base.Parse(strings.TrimSpace(attr.Val)); err == nil {
+				c.Attr[i].Val = u.String()
+			}
+		}
+	})
+}
+
+func walkNodes(n *html.Node, fn func(*html.Node)) {
+	fn(n)
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		walkNodes(c, fn)
+	}
+}
+
+func nodeText(n *html.Node) string {
+	var sb strings.Builder
+	walkNodes(n, func(c *html.Node) {
+		if c.Type == html.TextNode {
+			sb.WriteString(c.Data)
+		}
+	})
+	return sb.String()
+}
+
+func nodeAttr(n *html.Node, key string) string {
+	for _, attr := range n.Attr {
+		if attr.Key == key {
+			return attr.Val
+		}
+	}
+	return ""
+}
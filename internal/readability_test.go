@@ -0,0 +1,181 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testArticlePage = `<!DOCTYPE html>
+<html><head><title>Post</title><script>var tracking = true;</script></head>
+<body>
+<header class="site-header"><a href="/">Home</a> <a href="/about">About</a></header>
+<nav><ul><li><a href="/a">A</a></li><li><a href="/b">B</a></li></ul></nav>
+<div class="sidebar"><p>Subscribe to the newsletter, follow us, and read more of our popular posts here.</p></div>
+<article class="post">
+  <h1>Post</h1>
+  <div class="entry-content">
+    <p>The first paragraph of the article explains the problem, with enough words, commas, and detail to be scored.</p>
+    <p>The second paragraph goes deeper, adding context, examples, and a <a href="/docs">relative link</a> to the docs.</p>
+    <p><img src="images/diagram.png" alt="diagram"></p>
+    <p>The third paragraph wraps up the discussion, summarises the findings, and thanks the reader for their time.</p>
+  </div>
+</article>
+<div id="comments"><p>Great post, thanks for writing this, it helped me a lot with my own project!</p></div>
+<footer><p>Copyright 2024, all rights reserved, powered by a static site generator.</p></footer>
+</body></html>`
+
+func TestExtractMainContent(t *testing.T) {
+	base, _ := url.Parse("https://example.com/blog/post/")
+	content, err := extractMainContent([]byte(testArticlePage), base)
+	if err != nil {
+		t.Fatalf("extractMainContent() error = %v", err)
+	}
+
+	for _, want := range []string{"first paragraph", "second paragraph", "third paragraph",
+		`href="https://example.com/docs"`, `src="https://example.com/blog/post/images/diagram.png"`} {
+		if !strings.Contains(content, want) {
+			t.Errorf("content should contain %q, got %s", want, content)
+		}
+	}
+	for _, unwanted := range []string{"tracking", "newsletter", "Great post", "Copyright", "About"} {
+		if strings.Contains(content, unwanted) {
+			t.Errorf("content should not contain %q, got %s", unwanted, content)
+		}
+	}
+
+	if _, err := extractMainContent([]byte(`<html><body><p>short</p></body></html>`), base); err == nil {
+		t.Fatalf("short page should fail extraction")
+	}
+}
+
+func TestReadabilityFeedStoresFullText(t *testing.T) {
+	db := useTestDB(t)
+
+	var pageHits int
+	mux := http.NewServeMux()
+	mux.HandleFunc("/post", func(w http.ResponseWriter, r *http.Request) {
+		pageHits++
+		w.Write([]byte(testArticlePage))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	mux.HandleFunc("/feed.xml", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `<?xml version="1.0"?>
+<rss version="2.0" xmlns:content="http://purl.org/rss/1.0/modules/content/"><channel><title>Example</title>
+<item><guid>post</guid><title>Post</title><link>%s/post</link><content:encoded>summary only</content:encoded><pubDate>%s</pubDate></item>
+</channel></rss>`, server.URL, time.Now().UTC().Format(time.RFC1123Z))
+	})
+
+	feedID, err := getSetFeed(server.URL+"/feed.xml", "alice@example.com", "Example", time.Now().Add(-time.Hour).Unix())
+	if err != nil {
+		t.Fatalf("getSetFeed() error = %v", err)
+	}
+	db.Model(&Feed{}).Where("id = ?", feedID).Update("enable_readability", true)
+
+	var fd Feed
+	db.First(&fd, feedID)
+	if _, err := parseFeedAndSaveArticles(context.Background(), &fd); err != nil {
+		t.Fatalf("parseFeedAndSaveArticles() error = %v", err)
+	}
+	// 抓取 feed 时不提取正文，由后台任务从数据库中取出待提取的条目
+	if pageHits != 0 {
+		t.Fatalf("article page should not be fetched with the feed, got %d", pageHits)
+	}
+	for i := 0; i < 2; i++ {
+		extractPendingFullText(context.Background(), make(map[int64]time.Time))
+	}
+	if pageHits != 1 {
+		t.Fatalf("article page should be fetched once, got %d", pageHits)
+	}
+
+	articles, _ := getRecentlyArticles("alice@example.com", false, "")
+	if len(articles) != 1 {
+		t.Fatalf("articles = %+v", articles)
+	}
+
+	article, err := getArticle(articles[0].Uid, "alice@example.com")
+	if err != nil {
+		t.Fatalf("getArticle() error = %v", err)
+	}
+	if article.Content != "summary only" {
+		t.Fatalf("feed content should be kept, got %q", article.Content)
+	}
+	if !strings.Contains(article.FullContent, "second paragraph") || strings.Contains(article.FullContent, "newsletter") {
+		t.Fatalf("full content = %q", article.FullContent)
+	}
+}
+
+func TestExtractPendingFullTextRetriesTemporaryErrors(t *testing.T) {
+	db := useTestDB(t)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/post", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(testArticlePage))
+	})
+	mux.HandleFunc("/gone", func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	})
+	mux.HandleFunc("/busy", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "busy", http.StatusServiceUnavailable)
+	})
+	mux.HandleFunc("/file.pdf", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Write([]byte("%PDF-1.4"))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	readable := Source{URL: "https://example.com/readable"}
+	plain := Source{URL: "https://example.com/plain"}
+	db.Create(&readable)
+	db.Create(&plain)
+	db.Create(&Feed{URL: readable.URL, Email: "alice@example.com", SourceID: readable.ID, EnableReadability: true})
+	db.Create(&Feed{URL: plain.URL, Email: "alice@example.com", SourceID: plain.ID})
+
+	entries := []*Entry{
+		{SourceID: readable.ID, GUID: "post", Link: server.URL + "/post"},
+		{SourceID: readable.ID, GUID: "gone", Link: server.URL + "/gone"},
+		{SourceID: readable.ID, GUID: "busy", Link: server.URL + "/busy"},
+		{SourceID: readable.ID, GUID: "pdf", Link: server.URL + "/file.pdf"},
+		{SourceID: plain.ID, GUID: "plain", Link: server.URL + "/post"},
+	}
+	if err := db.Create(&entries).Error; err != nil {
+		t.Fatalf("create entries: %v", err)
+	}
+
+	retryAt := make(map[int64]time.Time)
+	if n := extractPendingFullText(context.Background(), retryAt); n != 4 {
+		t.Fatalf("processed %d entries, want 4", n)
+	}
+
+	stamped := make(map[string]bool)
+	var rows []Entry
+	db.Find(&rows)
+	for _, row := range rows {
+		stamped[row.GUID] = row.FullContentAt != 0
+		if row.GUID == "post" && !strings.Contains(row.FullContent, "second paragraph") {
+			t.Fatalf("full content = %q", row.FullContent)
+		}
+	}
+	if !stamped["post"] || !stamped["gone"] || !stamped["pdf"] || stamped["busy"] || stamped["plain"] {
+		t.Fatalf("full_content_at stamped = %v, only temporary errors should be retried", stamped)
+	}
+
+	// 临时错误的条目要等到重试时间之后才会再次抓取
+	if n := extractPendingFullText(context.Background(), retryAt); n != 0 {
+		t.Fatalf("processed %d entries before the retry delay", n)
+	}
+	for id := range retryAt {
+		retryAt[id] = time.Now().Add(-time.Second)
+	}
+	if n := extractPendingFullText(context.Background(), retryAt); n != 1 {
+		t.Fatalf("processed %d entries after the retry delay, want 1", n)
+	}
+}
@@ -0,0 +1,250 @@
+package internal
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/charmbracelet/log"
+)
+
+// 试运行时检查的最近文章数
+const ruleDryRunLimit = 500
+
+// compiledRule 是编译好匹配函数的规则，一次抓取中复用
+type compiledRule struct {
+	Rule
+	title   func(string) bool
+	content func(string) bool
+}
+
+// compilePattern 解析规则中的匹配模式：/.../ 包裹的是正则，支持 i 标志，其余按不区分大小写的子串匹配
+func compilePattern(pattern string) (func(string) bool, error) {
+	pattern = strings.TrimSpace(pattern)
+	if pattern == "" {
+		return nil, nil
+	}
+
+	// 结尾的 / 之后只能是 i 标志，否则像 /usr/bin 这样的路径仍按子串匹配
+	if end := strings.LastIndex(pattern, "/"); strings.HasPrefix(pattern, "/") && end > 0 {
+		if expr, flags := pattern[1:end], pattern[end+1:]; flags == "" || flags == "i" {
+			if flags != "" {
+				expr = "(?" + flags + ")" + expr
+			}
+
+			re, err := regexp.Compile(expr)
+			if err != nil {
+				return nil, fmt.Errorf("invalid regexp %q: %v", pattern, err)
+			}
+			return re.MatchString, nil
+		}
+	}
+
+	lower := strings.ToLower(pattern)
+	return func(s string) bool { return strings.Contains(strings.ToLower(s), lower) }, nil
+}
+
+func compileRule(rule Rule) (*compiledRule, error) {
+	if strings.TrimSpace(rule.TitlePattern) == "" && strings.TrimSpace(rule.ContentPattern) == "" && rule.ShorterThan <= 0 {
+		return nil, fmt.Errorf("rule needs at least one condition")
+	}
+	if !rule.MarkRead && !rule.Favorite && !rule.Highlight && !rule.Drop {
+		return nil, fmt.Errorf("rule needs at least one action")
+	}
+
+	title, err := compilePattern(rule.TitlePattern)
+	if err != nil {
+		return nil, err
+	}
+	content, err := compilePattern(rule.ContentPattern)
+	if err != nil {
+		return nil, err
+	}
+
+	return &compiledRule{Rule: rule, title: title, content: content}, nil
+}
+
+// match 判断条目是否满足规则的所有条件，text 是正文的纯文本
+func (r *compiledRule) match(feedID int64, title, text string) bool {
+	if r.FeedID != 0 && r.FeedID != feedID {
+		return false
+	}
+	if r.title != nil && !r.title(title) {
+		return false
+	}
+	if r.content != nil && !r.content(text) {
+		return false
+	}
+	if r.ShorterThan > 0 && utf8.RuneCountInString(text) >= r.ShorterThan {
+		return false
+	}
+	return true
+}
+
+// getEnabledRules 返回用户启用的规则，无法编译的规则会被跳过
+func getEnabledRules(email string) []*compiledRule {
+	var rules []Rule
+	if err := globalDB.Where("email = ? AND enabled = ?", email, true).Order("id asc").Find(&rules).Error; err != nil {
+		log.Errorf("could not get rules for %s: %v", email, err)
+		return nil
+	}
+
+	compiled := make([]*compiledRule, 0, len(rules))
+	for _, rule := range rules {
+		c, err := compileRule(rule)
+		if err != nil {
+			log.Errorf("skip invalid rule %d: %v", rule.ID, err)
+			continue
+		}
+		compiled = append(compiled, c)
+	}
+	return compiled
+}
+
+// applyRules 在新文章写入前执行所有匹配规则的动作。
+// drop 的文章以已删除状态写入，保留 guid，避免下次抓取时被重新插入
+func applyRules(rules []*compiledRule, article *Article, entry *Entry) {
+	for _, rule := range rules {
+		if !rule.match(article.FeedID, entry.Title, entry.TextContent) {
+			continue
+		}
+
+		article.Read = article.Read || rule.MarkRead
+		article.Favorite = article.Favorite || rule.Favorite
+		article.Highlight = article.Highlight || rule.Highlight
+		article.Deleted = article.Deleted || rule.Drop
+	}
+}
+
+func getRules(email string) []Rule {
+	rules := []Rule{}
+	if err := globalDB.Where("email = ?", email).Order("id asc").Find(&rules).Error; err != nil {
+		log.Errorf("could not get rules for %s: %v", email, err)
+		return nil
+	}
+	return rules
+}
+
+func createRule(email string, rule Rule) error {
+	if _, err := compileRule(rule); err != nil {
+		return err
+	}
+	if rule.FeedID != 0 && getFeed(fmt.Sprint(rule.FeedID), email).ID == 0 {
+		return fmt.Errorf("feed %d not found", rule.FeedID)
+	}
+
+	now := time.Now().Unix()
+	rule.ID, rule.Email, rule.CreateAt, rule.UpdateAt = 0, email, now, now
+	if strings.TrimSpace(rule.Name) == "" {
+		rule.Name = describeRule(rule)
+	}
+
+	if err := globalDB.Create(&rule).Error; err != nil {
+		return fmt.Errorf("could not create rule: %v", err)
+	}
+	return nil
+}
+
+func toggleRule(email, id string) error {
+	var rule Rule
+	if err := globalDB.Where("id = ? AND email = ?", id, email).First(&rule).Error; err != nil {
+		return fmt.Errorf("could not find rule: %v", err)
+	}
+
+	err := globalDB.Model(&Rule{}).Where("id = ?", rule.ID).Updates(map[string]interface{}{
+		"enabled":   !rule.Enabled,
+		"update_at": time.Now().Unix(),
+	}).Error
+	if err != nil {
+		return fmt.Errorf("could not update rule: %v", err)
+	}
+	return nil
+}
+
+func deleteRule(email, id string) error {
+	if err := globalDB.Where("id = ? AND email = ?", id, email).Delete(&Rule{}).Error; err != nil {
+		return fmt.Errorf("could not delete rule: %v", err)
+	}
+	return nil
+}
+
+func getRule(email, id string) *Rule {
+	var rule Rule
+	if err := globalDB.Where("id = ? AND email = ?", id, email).First(&rule).Error; err != nil {
+		return nil
+	}
+	return &rule
+}
+
+// dryRunRule 返回最近的文章中会被规则匹配的文章，不修改任何数据
+func dryRunRule(email string, rule Rule) ([]Article, error) {
+	compiled, err := compileRule(rule)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []struct {
+		Article
+		TextContent string
+	}
+	err = globalDB.Table("articles a").
+		Select("a.*, e.title, e.link, f.title AS name, e.text_content").
+		Joins("LEFT JOIN entries e ON e.id = a.entry_id").
+		Joins("LEFT JOIN feeds f ON f.id = a.feed_id").
+		Where("a.email = ? AND a.deleted = ?", email, false).
+		Order("a.publish_at desc").Limit(ruleDryRunLimit).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("could not get recent articles: %v", err)
+	}
+
+	matched := []Article{}
+	for _, row := range rows {
+		if compiled.match(row.FeedID, row.Title, row.TextContent) {
+			matched = append(matched, row.Article)
+		}
+	}
+	return matched, nil
+}
+
+// exportRules 导出用户的规则，feed_id 替换为订阅地址以便在其他实例导入
+func exportRules(email string) []Rule {
+	rules := getRules(email)
+
+	feedURLs := make(map[int64]string)
+	for _, feed := range getFeeds(email) {
+		feedURLs[feed.ID] = feed.URL
+	}
+	for i := range rules {
+		rules[i].FeedURL = feedURLs[rules[i].FeedID]
+	}
+	return rules
+}
+
+// describeRule 生成规则的简短描述，用作默认名称和列表展示
+func describeRule(rule Rule) string {
+	var conditions []string
+	if rule.TitlePattern != "" {
+		conditions = append(conditions, "title ~ "+rule.TitlePattern)
+	}
+	if rule.ContentPattern != "" {
+		conditions = append(conditions, "content ~ "+rule.ContentPattern)
+	}
+	if rule.ShorterThan > 0 {
+		conditions = append(conditions, fmt.Sprintf("shorter than %d", rule.ShorterThan))
+	}
+
+	var actions []string
+	for _, action := range []struct {
+		enabled bool
+		name    string
+	}{{rule.MarkRead, "read"}, {rule.Favorite, "favorite"}, {rule.Highlight, "highlight"}, {rule.Drop, "drop"}} {
+		if action.enabled {
+			actions = append(actions, action.name)
+		}
+	}
+
+	return strings.Join(conditions, " and ") + " → " + strings.Join(actions, ", ")
+}
@@ -0,0 +1,133 @@
+package internal
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+func TestCompilePattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		input   string
+		want    bool
+	}{
+		{"sponsored", "This post is SPONSORED", true},
+		{"sponsored", "regular post", false},
+		{`/^\[ad\]/`, "[ad] buy now", true},
+		{`/^\[ad\]/`, "[AD] buy now", false},
+		{`/^\[ad\]/i`, "[AD] buy now", true},
+		{"/usr/bin", "see /usr/bin/env", true},
+		{"/ad/x", "an /ad/x path", true},
+	}
+
+	for _, tt := range tests {
+		match, err := compilePattern(tt.pattern)
+		if err != nil {
+			t.Fatalf("compilePattern(%q) error = %v", tt.pattern, err)
+		}
+		if got := match(tt.input); got != tt.want {
+			t.Errorf("compilePattern(%q)(%q) = %v, want %v", tt.pattern, tt.input, got, tt.want)
+		}
+	}
+
+	for _, pattern := range []string{"/[/", "/(a/i"} {
+		if _, err := compilePattern(pattern); err == nil {
+			t.Errorf("compilePattern(%q) should fail", pattern)
+		}
+	}
+}
+
+func TestRulesOnIngest(t *testing.T) {
+	db := useTestDB(t)
+	email := "alice@example.com"
+
+	id, err := getSetFeed("https://example.com/feed", email, "Example", 0)
+	if err != nil {
+		t.Fatalf("getSetFeed() error = %v", err)
+	}
+	var fd Feed
+	db.First(&fd, id)
+
+	rules := []Rule{
+		{Name: "ads", Enabled: true, TitlePattern: `/^\[ad\]/i`, Drop: true},
+		{Name: "short", Enabled: true, FeedID: fd.ID, ShorterThan: 20, MarkRead: true},
+		{Name: "release", Enabled: true, ContentPattern: "release", Favorite: true, Highlight: true},
+		{Name: "disabled", Enabled: true, TitlePattern: "weekly", MarkRead: true},
+	}
+	for _, rule := range rules {
+		if err := createRule(email, rule); err != nil {
+			t.Fatalf("createRule(%s) error = %v", rule.Name, err)
+		}
+	}
+	if err := createRule(email, Rule{TitlePattern: "x"}); err == nil {
+		t.Fatalf("rule without actions should be rejected")
+	}
+	if err := createRule(email, Rule{TitlePattern: "x", MarkRead: true, FeedID: fd.ID + 100}); err == nil {
+		t.Fatalf("rule for unknown feed should be rejected")
+	}
+
+	all := getRules(email)
+	if len(all) != 4 {
+		t.Fatalf("rules = %+v", all)
+	}
+	if err := toggleRule(email, strconv.FormatInt(all[3].ID, 10)); err != nil {
+		t.Fatalf("toggleRule() error = %v", err)
+	}
+
+	now := time.Now()
+	items := []*gofeed.Item{
+		{GUID: "ad", Title: "[AD] Buy now", Link: "https://example.com/ad", Content: "<p>This is a long enough advertisement body</p>"},
+		{GUID: "short", Title: "Link", Link: "https://example.com/short", Content: "<p>tiny</p>"},
+		{GUID: "release", Title: "Version 2", Link: "https://example.com/release", Content: "<p>The new release is out with many changes</p>"},
+		{GUID: "weekly", Title: "Weekly digest", Link: "https://example.com/weekly", Content: "<p>A normal weekly digest without rules</p>"},
+	}
+	for _, item := range items {
+		item.PublishedParsed = &now
+	}
+
+	// 第二次抓取时 drop 的条目不应被重新插入
+	for i := 0; i < 2; i++ {
+		if err := saveFeedGroupResult(fd.URL, []*Feed{&fd}, &fetchResult{Feed: &gofeed.Feed{Title: "Example", Items: items}}); err != nil {
+			t.Fatalf("saveFeedGroupResult() error = %v", err)
+		}
+	}
+
+	var stored []Article
+	db.Where("email = ?", email).Find(&stored)
+	if len(stored) != 4 {
+		t.Fatalf("stored articles = %d, want 4", len(stored))
+	}
+	byGUID := make(map[string]Article)
+	for _, article := range stored {
+		byGUID[article.GUID] = article
+	}
+
+	if !byGUID["ad"].Deleted {
+		t.Errorf("ad should be dropped: %+v", byGUID["ad"])
+	}
+	if !byGUID["short"].Read || byGUID["short"].Deleted {
+		t.Errorf("short article should be marked read: %+v", byGUID["short"])
+	}
+	if release := byGUID["release"]; !release.Favorite || !release.Highlight || release.Read {
+		t.Errorf("release should be favorite and highlighted: %+v", release)
+	}
+	if weekly := byGUID["weekly"]; weekly.Read || weekly.Favorite || weekly.Deleted {
+		t.Errorf("disabled rule should not apply: %+v", weekly)
+	}
+
+	matched, err := dryRunRule(email, Rule{TitlePattern: "weekly", MarkRead: true})
+	if err != nil || len(matched) != 1 || matched[0].GUID != "weekly" {
+		t.Fatalf("dryRunRule() = %+v, %v", matched, err)
+	}
+	if matched, _ := dryRunRule(email, Rule{TitlePattern: "buy", Drop: true}); len(matched) != 0 {
+		t.Fatalf("dry run should skip dropped articles, got %+v", matched)
+	}
+
+	exported := exportRules(email)
+	if len(exported) != 4 || exported[1].FeedURL != "https://example.com/feed" || exported[0].FeedURL != "" {
+		t.Fatalf("exportRules() = %+v", exported)
+	}
+}
@@ -0,0 +1,216 @@
+package internal
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// sanitizerVersion 在白名单规则变化时递增，启动迁移会重新清洗旧版本的条目
+const sanitizerVersion = 1
+
+// 连同内容一起删除的标签
+var sanitizeDropTags = map[atom.Atom]bool{
+	atom.Script: true, atom.Style: true, atom.Iframe: true, atom.Frame: true, atom.Frameset: true,
+	atom.Object: true, atom.Embed: true, atom.Applet: true, atom.Noscript: true, atom.Template: true,
+	atom.Form: true, atom.Input: true, atom.Button: true, atom.Select: true, atom.Textarea: true,
+	atom.Svg: true, atom.Math: true, atom.Head: true, atom.Title: true, atom.Meta: true,
+	atom.Link: true, atom.Base: true,
+}
+
+// 允许的标签及其属性，不在白名单中的标签只保留子节点
+var sanitizeAllowedTags = map[atom.Atom][]string{
+	atom.A: {"href", "name"}, atom.Abbr: nil, atom.B: nil, atom.Blockquote: {"cite"}, atom.Br: nil,
+	atom.Caption: nil, atom.Cite: nil, atom.Code: {"class"}, atom.Dd: nil, atom.Del: {"cite", "datetime"},
+	atom.Details: nil, atom.Div: nil, atom.Dl: nil, atom.Dt: nil, atom.Em: nil, atom.Figcaption: nil,
+	atom.Figure: nil, atom.H1: nil, atom.H2: nil, atom.H3: nil, atom.H4: nil, atom.H5: nil, atom.H6: nil,
+	atom.Hr: nil, atom.I: nil, atom.Img: {"src", "srcset", "width", "height", "loading"},
+	atom.Ins: {"cite", "datetime"}, atom.Kbd: nil, atom.Li: nil, atom.Mark: nil, atom.Ol: {"start", "type"},
+	atom.P: nil, atom.Picture: nil, atom.Pre: {"class"}, atom.Q: {"cite"}, atom.S: nil, atom.Small: nil,
+	atom.Source: {"src", "srcset", "type", "media"}, atom.Span: nil, atom.Strong: nil, atom.Sub: nil,
+	atom.Summary: nil, atom.Sup: nil, atom.Table: nil, atom.Tbody: nil, atom.Td: {"colspan", "rowspan", "align"},
+	atom.Tfoot: nil, atom.Th: {"colspan", "rowspan", "align", "scope"}, atom.Thead: nil,
+	atom.Time: {"datetime"}, atom.Tr: nil, atom.U: nil, atom.Ul: nil,
+	atom.Audio: {"src", "controls", "preload"}, atom.Video: {"src", "poster", "controls", "preload", "width", "height"},
+}
+
+// 所有允许的标签都可以带的属性
+var sanitizeGlobalAttrs = []string{"title", "alt", "dir", "lang"}
+
+var sanitizeURLAttrs = map[string]bool{"href": true, "src": true, "cite": true, "poster": true, "srcset": true}
+
+// sanitizeHTML 按白名单清洗 feed 提供的 HTML：删除脚本、事件属性和 javascript: 等链接，
+// 相对地址按文章链接解析，外链统一加上 rel="noopener noreferrer"
+func sanitizeHTML(content, baseLink string) string {
+	if strings.TrimSpace(content) == "" {
+		return ""
+	}
+
+	base, err := url.Parse(strings.TrimSpace(baseLink))
+	if err != nil || base.Scheme == "" || base.Host == "" {
+		base = nil
+	}
+
+	fragmentContext := &html.Node{Type: html.ElementNode, Data: "div", DataAtom: atom.Div}
+	nodes, err := html.ParseFragment(strings.NewReader(content), fragmentContext)
+	if err != nil {
+		return html.EscapeString(content)
+	}
+
+	root := &html.Node{Type: html.ElementNode, Data: "div", DataAtom: atom.Div}
+	for _, n := range nodes {
+		root.AppendChild(n)
+	}
+	sanitizeChildren(root, base)
+
+	var buf bytes.Buffer
+	for c := root.FirstChild; c != nil; c = c.NextSibling {
+		if err := html.Render(&buf, c); err != nil {
+			return ""
+		}
+	}
+
+	return buf.String()
+}
+
+func sanitizeChildren(n *html.Node, base *url.URL) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+
+		switch c.Type {
+		case html.TextNode:
+		case html.ElementNode:
+			attrs, allowed := sanitizeAllowedTags[c.DataAtom]
+			switch {
+			case sanitizeDropTags[c.DataAtom]:
+				n.RemoveChild(c)
+			case !allowed:
+				// 不在白名单中的标签（包括自定义元素）只保留子节点
+				next = unwrapNode(c)
+			default:
+				c.Attr = sanitizeAttrs(c, attrs, base)
+				sanitizeChildren(c, base)
+			}
+		default:
+			// 注释、doctype 等
+			n.RemoveChild(c)
+		}
+
+		c = next
+	}
+}
+
+// unwrapNode 用子节点替换当前节点，返回下一个待处理的节点
+func unwrapNode(n *html.Node) *html.Node {
+	parent := n.Parent
+	first := n.FirstChild
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		n.RemoveChild(c)
+		parent.InsertBefore(c, n)
+		c = next
+	}
+
+	next := n.NextSibling
+	parent.RemoveChild(n)
+	if first != nil {
+		return first
+	}
+	return next
+}
+
+func sanitizeAttrs(n *html.Node, allowed []string, base *url.URL) []html.Attribute {
+	attrs := make([]html.Attribute, 0, len(n.Attr))
+	for _, attr := range n.Attr {
+		key := strings.ToLower(attr.Key)
+		if attr.Namespace != "" || (!containsString(allowed, key) && !containsString(sanitizeGlobalAttrs, key)) {
+			continue
+		}
+
+		if sanitizeURLAttrs[key] {
+			var ok bool
+			if key == "srcset" {
+				attr.Val, ok = sanitizeSrcset(attr.Val, base)
+			} else {
+				attr.Val, ok = sanitizeURL(attr.Val, base, key == "href", n.DataAtom == atom.Img && key == "src")
+			}
+			if !ok {
+				continue
+			}
+		}
+
+		attrs = append(attrs, html.Attribute{Key: key, Val: attr.Val})
+	}
+
+	if n.DataAtom == atom.A {
+		attrs = append(attrs,
+			html.Attribute{Key: "target", Val: "_blank"},
+			html.Attribute{Key: "rel", Val: "noopener noreferrer"})
+	}
+
+	return attrs
+}
+
+// sanitizeURL 只允许 http(s) 链接，href 额外允许 mailto，图片允许 data:image
+func sanitizeURL(raw string, base *url.URL, allowMailto, allowDataImage bool) (string, bool) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", false
+	}
+
+	lower := strings.ToLower(raw)
+	if allowDataImage && strings.HasPrefix(lower, "data:image/") && !strings.HasPrefix(lower, "data:image/svg") {
+		return raw, true
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", false
+	}
+	if base != nil {
+		u = base.ResolveReference(u)
+	}
+
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https":
+		return u.String(), true
+	case "mailto":
+		return u.String(), allowMailto
+	case "":
+		// 没有文章链接时保留页内锚点和相对地址
+		if base == nil && !strings.Contains(lower, ":") {
+			return raw, true
+		}
+	}
+
+	return "", false
+}
+
+func sanitizeSrcset(raw string, base *url.URL) (string, bool) {
+	var candidates []string
+	for _, candidate := range strings.Split(raw, ",") {
+		fields := strings.Fields(candidate)
+		if len(fields) == 0 {
+			continue
+		}
+		src, ok := sanitizeURL(fields[0], base, false, false)
+		if !ok {
+			continue
+		}
+		candidates = append(candidates, strings.Join(append([]string{src}, fields[1:]...), " "))
+	}
+
+	return strings.Join(candidates, ", "), len(candidates) > 0
+}
+
+func containsString(values []string, want string) bool {
+	for _, v := range values {
+		if v == want {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,94 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSanitizeHTML(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{
+			name:    "script",
+			content: `<p>hi</p><script>alert(1)</script>`,
+			want:    `<p>hi</p>`,
+		},
+		{
+			name:    "event handler and style",
+			content: `<img src="a.png" onerror="alert(1)" style="position:fixed" alt="a">`,
+			want:    `<img src="https://example.com/post/a.png" alt="a"/>`,
+		},
+		{
+			name:    "javascript url",
+			content: `<a href=" JaVaScRiPt:alert(1)">x</a>`,
+			want:    `<a target="_blank" rel="noopener noreferrer">x</a>`,
+		},
+		{
+			name:    "relative link gets noopener",
+			content: `<a href="../about" target="_self" rel="opener">about</a>`,
+			want:    `<a href="https://example.com/about" target="_blank" rel="noopener noreferrer">about</a>`,
+		},
+		{
+			name:    "unknown tags are unwrapped",
+			content: `<custom-card><font color="red">text</font></custom-card>`,
+			want:    `text`,
+		},
+		{
+			name:    "iframe and svg dropped",
+			content: `<iframe src="https://evil"></iframe><svg onload="alert(1)"><script>x</script></svg>ok`,
+			want:    `ok`,
+		},
+		{
+			name:    "srcset filtered",
+			content: `<img srcset="small.png 1x, javascript:alert(1) 2x">`,
+			want:    `<img srcset="https://example.com/post/small.png 1x"/>`,
+		},
+		{
+			name:    "data images allowed except svg",
+			content: `<img src="data:image/png;base64,AAAA"><img src="data:image/svg+xml;base64,AAAA">`,
+			want:    `<img src="data:image/png;base64,AAAA"/><img/>`,
+		},
+		{
+			name:    "comments removed",
+			content: `<!-- <script>x</script> --><b>bold</b>`,
+			want:    `<b>bold</b>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sanitizeHTML(tt.content, "https://example.com/post/"); got != tt.want {
+				t.Fatalf("sanitizeHTML() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSanitizeHTMLWithoutBaseKeepsRelativeLinks(t *testing.T) {
+	got := sanitizeHTML(`<a href="#note">note</a><a href="vbscript:x">bad</a>`, "")
+	if !strings.Contains(got, `href="#note"`) || strings.Contains(got, "vbscript") {
+		t.Fatalf("sanitizeHTML() = %q", got)
+	}
+}
+
+func TestMigrateSanitizedContent(t *testing.T) {
+	db := useTestDB(t)
+
+	entry := Entry{SourceID: 1, GUID: "1", Link: "https://example.com/p", Content: `<p onclick="x()">hi</p><script>x</script>`}
+	if err := db.Create(&entry).Error; err != nil {
+		t.Fatalf("create entry: %v", err)
+	}
+
+	if err := migrateSanitizedContent(db); err != nil {
+		t.Fatalf("migrateSanitizedContent() error = %v", err)
+	}
+
+	var got Entry
+	db.First(&got, entry.ID)
+	if got.Content != "<p>hi</p>" || got.Sanitized != sanitizerVersion {
+		t.Fatalf("entry after migration = %q, version %d", got.Content, got.Sanitized)
+	}
+}
@@ -0,0 +1,164 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"gorm.io/gorm"
+)
+
+func createSavedSearch(email, name, query string, highlight bool) (int64, error) {
+	name, query = strings.TrimSpace(name), strings.TrimSpace(query)
+	if query == "" {
+		return 0, fmt.Errorf("query is required")
+	}
+	if name == "" {
+		name = query
+	}
+	if err := validateSavedQuery(query); err != nil {
+		return 0, err
+	}
+
+	now := time.Now().Unix()
+	search := SavedSearch{
+		Email:     email,
+		Name:      name,
+		Query:     query,
+		Highlight: highlight,
+		CreateAt:  now,
+		UpdateAt:  now,
+	}
+	if err := globalDB.Create(&search).Error; err != nil {
+		return 0, fmt.Errorf("could not create saved search: %v", err)
+	}
+	return search.ID, nil
+}
+
+// validateSavedQuery 保存前检查日期等条件，避免保存之后列表一直报错
+func validateSavedQuery(query string) error {
+	opts := parseSearchQuery(query)
+	if len(opts.Terms) == 0 && !opts.hasFilters() {
+		return fmt.Errorf("query has no terms or filters")
+	}
+	_, err := applySearchFilters(globalDB.Table("articles a"), "", opts)
+	return err
+}
+
+// getSavedSearches 返回用户的保存搜索，附带匹配的未读文章数
+func getSavedSearches(email string) []SavedSearch {
+	searches := []SavedSearch{}
+	if err := globalDB.Where("email = ?", email).Order("create_at asc").Find(&searches).Error; err != nil {
+		log.Errorf("could not get saved searches: %v", err)
+		return nil
+	}
+
+	for i := range searches {
+		query, err := savedSearchArticleQuery(email, parseSearchQuery(searches[i].Query))
+		if err != nil {
+			continue
+		}
+		if err := query.Where("a.read = ?", false).Count(&searches[i].Unread).Error; err != nil {
+			log.Errorf("could not count saved search %d: %v", searches[i].ID, err)
+		}
+	}
+
+	return searches
+}
+
+func getSavedSearch(email, id string) *SavedSearch {
+	var search SavedSearch
+	if err := globalDB.Where("id = ? AND email = ?", id, email).First(&search).Error; err != nil {
+		return nil
+	}
+	return &search
+}
+
+func updateSavedSearch(email, id, name, query string, highlight bool) error {
+	name, query = strings.TrimSpace(name), strings.TrimSpace(query)
+	if name == "" || query == "" {
+		return fmt.Errorf("name and query are required")
+	}
+	if err := validateSavedQuery(query); err != nil {
+		return err
+	}
+
+	err := globalDB.Model(&SavedSearch{}).Where("id = ? AND email = ?", id, email).Updates(map[string]interface{}{
+		"name":      name,
+		"query":     query,
+		"highlight": highlight,
+		"update_at": time.Now().Unix(),
+	}).Error
+	if err != nil {
+		return fmt.Errorf("could not update saved search: %v", err)
+	}
+	return nil
+}
+
+func deleteSavedSearch(email, id string) error {
+	if err := globalDB.Where("id = ? AND email = ?", id, email).Delete(&SavedSearch{}).Error; err != nil {
+		return fmt.Errorf("could not delete saved search: %v", err)
+	}
+	return nil
+}
+
+// savedSearchArticleQuery 返回匹配搜索条件的文章查询，articles 的别名是 a
+func savedSearchArticleQuery(email string, opts SearchOptions) (*gorm.DB, error) {
+	query := globalDB.Table("articles a").Where("a.email = ? AND a.deleted = ?", email, false)
+
+	query, err := applySearchFilters(query, email, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(opts.Terms) > 0 {
+		condition, args := entryMatchCondition(opts.Terms)
+		query = query.Where("a.entry_id IN (?)", globalDB.Table("entries e").
+			Joins("LEFT JOIN sources s ON s.id = e.source_id").
+			Select("e.id").Where(condition, args...))
+	}
+
+	return query, nil
+}
+
+// getSavedSearchArticles 按时间倒序分页列出保存搜索匹配的文章，和分类列表一样渲染
+func getSavedSearchArticles(email string, search *SavedSearch, cursor string) ([]Article, string, error) {
+	query, err := savedSearchArticleQuery(email, parseSearchQuery(search.Query))
+	if err != nil {
+		return nil, "", err
+	}
+
+	articles, next, err := findArticlePage(query, cursor)
+	if err != nil {
+		return nil, "", fmt.Errorf("could not get saved search articles: %v", err)
+	}
+	return articles, next, nil
+}
+
+// getHighlightedSavedSearchArticles 返回开启高亮的保存搜索在时间范围内匹配的未读文章
+func getHighlightedSavedSearchArticles(email string, start, end time.Time) ([]Article, error) {
+	var searches []SavedSearch
+	if err := globalDB.Where("email = ? AND highlight = ?", email, true).Find(&searches).Error; err != nil {
+		return nil, fmt.Errorf("could not get highlighted saved searches: %v", err)
+	}
+
+	var articles []Article
+	for _, search := range searches {
+		query, err := savedSearchArticleQuery(email, parseSearchQuery(search.Query))
+		if err != nil {
+			log.Errorf("invalid saved search %d: %v", search.ID, err)
+			continue
+		}
+
+		var matched []Article
+		err = query.Select("a.*").Where("a.publish_at >= ? AND a.publish_at < ? AND a.read = ?", start.Unix(), end.Unix(), false).
+			Find(&matched).Error
+		if err != nil {
+			return nil, fmt.Errorf("could not get articles for saved search %d: %v", search.ID, err)
+		}
+		articles = append(articles, matched...)
+	}
+
+	return articles, nil
+}
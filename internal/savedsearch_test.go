@@ -0,0 +1,70 @@
+package internal
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+func TestSavedSearch(t *testing.T) {
+	db := useTestDB(t)
+
+	db.Create(&Category{Name: "Tech", Email: "alice@example.com"})
+	techID, _ := getSetFeed("https://example.com/tech", "alice@example.com", "Tech Feed", 0)
+	newsID, _ := getSetFeed("https://example.com/news", "alice@example.com", "News Feed", 0)
+	db.Model(&Feed{}).Where("id = ?", techID).Update("categories", "Tech")
+
+	yesterday := time.Now().In(TimeZone).Add(-24 * time.Hour)
+	publishAt := time.Date(yesterday.Year(), yesterday.Month(), yesterday.Day(), 12, 0, 0, 0, TimeZone)
+	for _, id := range []int64{techID, newsID} {
+		var fd Feed
+		db.First(&fd, id)
+		items := []*gofeed.Item{
+			{GUID: "k8s", Title: "Kubernetes operators", Link: fd.URL + "/k8s", Content: "<p>about kubernetes</p>", PublishedParsed: &publishAt},
+			{GUID: "rust", Title: "Rust news", Link: fd.URL + "/rust", Content: "<p>about rust</p>", PublishedParsed: &publishAt},
+		}
+		if err := saveFeedGroupResult(fd.URL, []*Feed{&fd}, &fetchResult{Feed: &gofeed.Feed{Items: items}}); err != nil {
+			t.Fatalf("saveFeedGroupResult() error = %v", err)
+		}
+	}
+
+	if _, err := createSavedSearch("alice@example.com", "bad", "from:yesterday", false); err == nil {
+		t.Fatalf("invalid date should be rejected")
+	}
+
+	id, err := createSavedSearch("alice@example.com", "k8s", `category:Tech "kubernetes" -is:read`, true)
+	if err != nil {
+		t.Fatalf("createSavedSearch() error = %v", err)
+	}
+
+	searches := getSavedSearches("alice@example.com")
+	if len(searches) != 1 || searches[0].Unread != 1 {
+		t.Fatalf("saved searches = %+v", searches)
+	}
+
+	search := getSavedSearch("alice@example.com", strconv.FormatInt(id, 10))
+	if search == nil || getSavedSearch("bob@example.com", strconv.FormatInt(id, 10)) != nil {
+		t.Fatalf("saved search should only be visible to its owner")
+	}
+
+	articles, next, err := getSavedSearchArticles("alice@example.com", search, "")
+	if err != nil || next != "" || len(articles) != 1 || articles[0].Title != "Kubernetes operators" || articles[0].FeedID != techID {
+		t.Fatalf("saved search articles = %+v, %q, %v", articles, next, err)
+	}
+
+	// 保存搜索开启高亮后匹配的文章会进入每日通知
+	highlighted, err := getYesterdayHighlightedUnreadArticlesForUser("alice@example.com")
+	if err != nil || len(highlighted) != 1 || highlighted[0].Uid != articles[0].Uid {
+		t.Fatalf("highlighted articles = %+v, %v", highlighted, err)
+	}
+
+	db.Model(&Article{}).Where("uid = ?", articles[0].Uid).Update("read", true)
+	if searches = getSavedSearches("alice@example.com"); searches[0].Unread != 0 {
+		t.Fatalf("unread count after read = %d", searches[0].Unread)
+	}
+	if articles, _, _ = getSavedSearchArticles("alice@example.com", search, ""); len(articles) != 0 {
+		t.Fatalf("-is:read should hide read articles, got %+v", articles)
+	}
+}
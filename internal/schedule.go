@@ -1,6 +1,7 @@
 package internal
 
 import (
+	"context"
 	"fmt"
 	"strconv"
 	"strings"
@@ -11,8 +12,7 @@ import (
 
 var (
 	fetchParseJob = FeedParseJob{
-		emails: []string{DefaultEmail},
-		tk:     time.NewTicker(30 * time.Minute),
+		tk: time.NewTicker(time.Duration(orenvInt("FETCH_TICK_MINUTES", 5)) * time.Minute),
 	}
 
 	dailyNotifyJob = &DailyNotifyJob{
@@ -22,11 +22,15 @@ var (
 	aiSummaryJob = &AISummaryJob{
 		tk: time.NewTicker(time.Minute),
 	}
+
+	fullTextJob = &FullTextJob{
+		tk:      time.NewTicker(time.Minute),
+		retryAt: make(map[int64]time.Time),
+	}
 )
 
 type FeedParseJob struct {
-	tk     *time.Ticker
-	emails []string
+	tk *time.Ticker
 }
 
 type DailyNotifyJob struct {
@@ -39,6 +43,13 @@ type AISummaryJob struct {
 	lastSummaryDate string
 }
 
+// FullTextJob 在 feed 抓取之外提取开启了 readability 的订阅的正文，
+// 不占用 feed 抓取的 worker 和 host 配额
+type FullTextJob struct {
+	tk      *time.Ticker
+	retryAt map[int64]time.Time // 遇到临时错误的 entry 下次重试的时间
+}
+
 func init() {
 	go func() {
 		fetchParseJob.Start()
@@ -51,6 +62,10 @@ func init() {
 	go func() {
 		aiSummaryJob.Start()
 	}()
+
+	go func() {
+		fullTextJob.Start()
+	}()
 }
 
 func (t *FeedParseJob) Start() {
@@ -58,23 +73,32 @@ func (t *FeedParseJob) Start() {
 	for range t.tk.C {
 		log.Infof("ticker to get feed, now: %v", time.Now())
 
-		feeds := getEmailsFeeds(t.emails)
+		now := time.Now()
+		groups := groupFeedsByURL(getAllFeeds())
+		shouldFetch := websubPollFilter(now, getWebSubActiveSourceIDs(now),
+			dueFeedGroupFilter(now, feedFetchUserQuota))
+		summary := runFetchCycle(context.Background(), groups, shouldFetch, parseFeedGroupAndSaveArticles)
 
-		for _, feedItem := range feeds {
-			if time.Now().Before(time.Unix(feedItem.LastFetchedAt+3600, 0)) {
-				continue
-			}
+		log.Infof("feed parse cycle done: %s", summary)
 
-			if feedItem.ID == 0 {
-				continue
-			}
+		renewWebSubSubscriptions(context.Background())
+	}
+}
+
+func (t *FeedParseJob) Stop() {
+	t.tk.Stop()
+}
 
-			parseFeedAndSaveArticles(&feedItem)
+func (t *FullTextJob) Start() {
+	log.Infof("start full text job")
+	for range t.tk.C {
+		if n := extractPendingFullText(context.Background(), t.retryAt); n > 0 {
+			log.Infof("full text job processed %d entries", n)
 		}
 	}
 }
 
-func (t *FeedParseJob) Stop() {
+func (t *FullTextJob) Stop() {
 	t.tk.Stop()
 }
 
@@ -90,7 +114,7 @@ func (t *DailyNotifyJob) Start() {
 
 		// 获取所有启用了通知的用户
 		var preferences []UserPreference
-		err := globalDB.Where("enable_notification = ?", true).Find(&preferences).Error
+		err := globalDB.Where("enable_notification = ? AND email NOT IN (?)", true, disabledUserEmails()).Find(&preferences).Error
 		if err != nil {
 			log.Errorf("Failed to get users with notification enabled: %v", err)
 			continue
@@ -122,7 +146,6 @@ func (t *DailyNotifyJob) Stop() {
 	t.tk.Stop()
 }
 
-
 func (t *AISummaryJob) Start() {
 	log.Infof("start AI summary job")
 	for range t.tk.C {
@@ -135,7 +158,7 @@ func (t *AISummaryJob) Start() {
 
 		// 获取所有启用了AI总结的用户
 		var preferences []UserPreference
-		err := globalDB.Where("enable_ai_summary = ?", true).Find(&preferences).Error
+		err := globalDB.Where("enable_ai_summary = ? AND email NOT IN (?)", true, disabledUserEmails()).Find(&preferences).Error
 		if err != nil {
 			log.Errorf("Failed to get users with AI summary enabled: %v", err)
 			continue
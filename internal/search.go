@@ -0,0 +1,531 @@
+package internal
+
+import (
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/charmbracelet/log"
+	xhtml "golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"gorm.io/gorm"
+)
+
+const (
+	// 搜索结果每页条数
+	searchPageSize = 30
+	// trigram 分词器无法匹配少于 3 个字符的词，这时退回到 LIKE
+	searchMinTermLength = 3
+	// snippet 中标记命中词的占位符，转义后替换为 <mark>
+	snippetStart = "\ue000"
+	snippetStop  = "\ue001"
+)
+
+// SearchOptions 是搜索条件，Terms 之外都是可选的过滤条件
+type SearchOptions struct {
+	Query    string   `json:"q"`
+	Terms    []string `json:"terms"` // 关键词，引号中的短语作为一个词
+	FeedID   int64    `json:"feed_id"`
+	Category string   `json:"category"`
+	Read     string   `json:"read"` // 空表示全部，unread / read
+	Favorite bool     `json:"favorite"`
+	From     string   `json:"from"` // 2006-01-02
+	To       string   `json:"to"`
+	Page     int      `json:"page"`
+}
+
+func (opts SearchOptions) hasFilters() bool {
+	return opts.FeedID != 0 || opts.Category != "" || opts.Read != "" || opts.Favorite || opts.From != "" || opts.To != ""
+}
+
+type SearchResult struct {
+	Article
+	Snippet string  `json:"snippet"` // 已经转义，只包含 <mark> 标签
+	Rank    float64 `json:"rank"`
+}
+
+// migrateSearchIndex 回填条目的纯文本并建立全文索引：
+// SQLite 使用 FTS5 虚拟表，由触发器与 entries 保持同步；Postgres 使用生成的 tsvector 列和 GIN 索引
+func migrateSearchIndex(db *gorm.DB) error {
+	lastID := int64(0)
+	for batch := 1; ; batch++ {
+		var entries []Entry
+		err := db.Select("id", "content").Where("id > ? AND text_content IS NULL", lastID).
+			Order("id asc").Limit(500).Find(&entries).Error
+		if err != nil {
+			return fmt.Errorf("could not load entries to index: %v", err)
+		}
+		if len(entries) == 0 {
+			break
+		}
+
+		for _, entry := range entries {
+			if err := db.Model(&Entry{}).Where("id = ?", entry.ID).Update("text_content", htmlToText(entry.Content)).Error; err != nil {
+				return fmt.Errorf("could not set entry text: %v", err)
+			}
+			lastID = entry.ID
+		}
+		log.Infof("extracted entry text batch %d", batch)
+	}
+
+	if db.Dialector.Name() == "postgres" {
+		return setupPostgresSearch(db)
+	}
+	return setupSQLiteSearch(db)
+}
+
+func setupPostgresSearch(db *gorm.DB) error {
+	statements := []string{
+		`ALTER TABLE entries ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (
+			setweight(to_tsvector('simple', coalesce(title, '')), 'A') ||
+			setweight(to_tsvector('simple', coalesce(text_content, '')), 'B')) STORED`,
+		`CREATE INDEX IF NOT EXISTS idx_entries_search_vector ON entries USING GIN (search_vector)`,
+	}
+	for _, stmt := range statements {
+		if err := db.Exec(stmt).Error; err != nil {
+			return fmt.Errorf("could not set up search index: %v", err)
+		}
+	}
+	return nil
+}
+
+func setupSQLiteSearch(db *gorm.DB) error {
+	exists := hasSQLiteSearchIndex(db)
+	if !exists {
+		// trigram 分词可以匹配中文等没有空格分隔的文本
+		err := db.Exec(`CREATE VIRTUAL TABLE entries_fts USING fts5(title, content, feed_name, tokenize = 'trigram')`).Error
+		if err != nil {
+			// 驱动编译时没有启用 FTS5（需要 sqlite_fts5 build tag），搜索退回到 LIKE
+			log.Warnf("could not create fts5 table, search will fall back to LIKE: %v", err)
+			return nil
+		}
+	}
+
+	statements := []string{
+		`CREATE TRIGGER IF NOT EXISTS entries_fts_insert AFTER INSERT ON entries BEGIN
+			INSERT INTO entries_fts (rowid, title, content, feed_name)
+			VALUES (new.id, new.title, new.text_content, (SELECT title FROM sources WHERE id = new.source_id));
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS entries_fts_delete AFTER DELETE ON entries BEGIN
+			DELETE FROM entries_fts WHERE rowid = old.id;
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS entries_fts_update AFTER UPDATE OF title, text_content, source_id ON entries BEGIN
+			DELETE FROM entries_fts WHERE rowid = old.id;
+			INSERT INTO entries_fts (rowid, title, content, feed_name)
+			VALUES (new.id, new.title, new.text_content, (SELECT title FROM sources WHERE id = new.source_id));
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS sources_fts_update AFTER UPDATE OF title ON sources BEGIN
+			UPDATE entries_fts SET feed_name = new.title WHERE rowid IN (SELECT id FROM entries WHERE source_id = new.id);
+		END`,
+	}
+	for _, stmt := range statements {
+		if err := db.Exec(stmt).Error; err != nil {
+			return fmt.Errorf("could not create search trigger: %v", err)
+		}
+	}
+
+	if !exists {
+		err := db.Exec(`INSERT INTO entries_fts (rowid, title, content, feed_name)
+			SELECT e.id, e.title, e.text_content, s.title FROM entries e LEFT JOIN sources s ON s.id = e.source_id`).Error
+		if err != nil {
+			return fmt.Errorf("could not build search index: %v", err)
+		}
+	}
+
+	return nil
+}
+
+func hasSQLiteSearchIndex(db *gorm.DB) bool {
+	var count int64
+	db.Raw("SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = 'entries_fts'").Scan(&count)
+	return count > 0
+}
+
+// parseSearchQuery 解析搜索语法，例如 category:Tech "kubernetes" -is:read。
+// 支持 category:、feed:<id>、is:read、is:unread、is:starred、from:<date>、to:<date>，其余的词作为关键词
+func parseSearchQuery(raw string) SearchOptions {
+	opts := SearchOptions{Query: strings.TrimSpace(raw)}
+
+	for _, token := range tokenizeSearchQuery(raw) {
+		if token.quoted {
+			opts.Terms = append(opts.Terms, token.text)
+			continue
+		}
+
+		negated := strings.HasPrefix(token.text, "-")
+		key, value, found := strings.Cut(strings.TrimPrefix(token.text, "-"), ":")
+		if !found || value == "" {
+			opts.Terms = append(opts.Terms, token.text)
+			continue
+		}
+
+		switch strings.ToLower(key) {
+		case "category":
+			opts.Category = value
+		case "feed":
+			feedID, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				opts.Terms = append(opts.Terms, token.text)
+				continue
+			}
+			opts.FeedID = feedID
+		case "is":
+			switch strings.ToLower(value) {
+			case "read", "unread":
+				// -is:read 等同于 is:unread
+				if (strings.ToLower(value) == "read") != negated {
+					opts.Read = "read"
+				} else {
+					opts.Read = "unread"
+				}
+			case "starred", "favorite":
+				opts.Favorite = !negated
+			default:
+				opts.Terms = append(opts.Terms, token.text)
+			}
+		case "from":
+			opts.From = value
+		case "to":
+			opts.To = value
+		default:
+			opts.Terms = append(opts.Terms, token.text)
+		}
+	}
+
+	return opts
+}
+
+type searchToken struct {
+	text   string
+	quoted bool
+}
+
+// tokenizeSearchQuery 按空白切分，引号中的空白不切分，引号本身会被去掉
+func tokenizeSearchQuery(raw string) []searchToken {
+	var tokens []searchToken
+	var current strings.Builder
+	inQuote, quoted, started := false, false, false
+
+	flush := func() {
+		if started && (current.Len() > 0 || quoted) {
+			if text := strings.TrimSpace(current.String()); text != "" {
+				tokens = append(tokens, searchToken{text: text, quoted: quoted})
+			}
+		}
+		current.Reset()
+		inQuote, quoted, started = false, false, false
+	}
+
+	for _, r := range raw {
+		switch {
+		case r == '"':
+			if !started {
+				quoted = true
+			}
+			started, inQuote = true, !inQuote
+		case unicode.IsSpace(r) && !inQuote:
+			flush()
+		default:
+			started = true
+			current.WriteRune(r)
+		}
+	}
+	flush()
+
+	return tokens
+}
+
+// formatSearchQuery 把搜索条件还原为搜索语法，用于保存搜索
+func formatSearchQuery(opts SearchOptions) string {
+	quote := func(s string) string {
+		if strings.ContainsFunc(s, unicode.IsSpace) {
+			return `"` + s + `"`
+		}
+		return s
+	}
+
+	var parts []string
+	for _, term := range opts.Terms {
+		if strings.ContainsFunc(term, unicode.IsSpace) || strings.Contains(term, ":") || strings.HasPrefix(term, "-") {
+			parts = append(parts, `"`+term+`"`)
+		} else {
+			parts = append(parts, term)
+		}
+	}
+	if opts.Category != "" {
+		parts = append(parts, "category:"+quote(opts.Category))
+	}
+	if opts.FeedID != 0 {
+		parts = append(parts, "feed:"+strconv.FormatInt(opts.FeedID, 10))
+	}
+	if opts.Read != "" {
+		parts = append(parts, "is:"+opts.Read)
+	}
+	if opts.Favorite {
+		parts = append(parts, "is:starred")
+	}
+	if opts.From != "" {
+		parts = append(parts, "from:"+opts.From)
+	}
+	if opts.To != "" {
+		parts = append(parts, "to:"+opts.To)
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// searchArticles 在用户自己的文章中搜索标题、正文和订阅名称
+func searchArticles(email string, opts SearchOptions) ([]SearchResult, bool, error) {
+	terms := opts.Terms
+	if len(terms) == 0 && !opts.hasFilters() {
+		return nil, false, nil
+	}
+
+	query := globalDB.Table("articles a").
+		Joins("JOIN entries e ON e.id = a.entry_id").
+		Joins("LEFT JOIN sources s ON s.id = e.source_id").
+		Joins("LEFT JOIN feeds f ON f.id = a.feed_id").
+		Where("a.email = ? AND a.deleted = ?", email, false)
+
+	query, err := applySearchFilters(query, email, opts)
+	if err != nil {
+		return nil, false, err
+	}
+
+	columns := "a.uid, f.title AS name, a.feed_id, e.title, e.link, a.read, a.favorite, a.publish_at, a.entry_id"
+	switch {
+	case len(terms) == 0:
+		query = query.Select(columns + ", 0 AS rank, e.text_content AS snippet").Order("a.publish_at desc, a.uid desc")
+	case globalDB.Dialector.Name() == "postgres":
+		tsquery, args := tsQuery(terms)
+		condition, conditionArgs := entryMatchCondition(terms)
+		query = query.Select(columns+`, ts_rank(e.search_vector, `+tsquery+`) AS rank,
+			ts_headline('simple', coalesce(e.text_content, ''), `+tsquery+`,
+				'StartSel=`+snippetStart+`, StopSel=`+snippetStop+`, MaxWords=40, MinWords=15') AS snippet`, append(args, args...)...).
+			Where(condition, conditionArgs...).
+			Order("rank desc, a.publish_at desc")
+	case useSearchIndex(terms):
+		// bm25 越小越相关，标题和订阅名的权重高于正文
+		query = query.Joins("JOIN entries_fts ON entries_fts.rowid = e.id").
+			Select(columns+", bm25(entries_fts, 10.0, 1.0, 5.0) AS rank, snippet(entries_fts, -1, ?, ?, '…', 24) AS snippet",
+				snippetStart, snippetStop).
+			Where("entries_fts MATCH ?", ftsQuery(terms)).
+			Order("rank asc, a.publish_at desc")
+	default:
+		condition, args := entryMatchCondition(terms)
+		query = query.Select(columns+", 0 AS rank, e.text_content AS snippet").
+			Where(condition, args...).
+			Order("a.publish_at desc, a.uid desc")
+	}
+
+	page := max(opts.Page, 0)
+	var results []SearchResult
+	if err := query.Offset(page * searchPageSize).Limit(searchPageSize + 1).Scan(&results).Error; err != nil {
+		return nil, false, fmt.Errorf("could not search articles: %v", err)
+	}
+
+	hasMore := len(results) > searchPageSize
+	if hasMore {
+		results = results[:searchPageSize]
+	}
+
+	for i := range results {
+		if !strings.Contains(results[i].Snippet, snippetStart) {
+			results[i].Snippet = makeSnippet(results[i].Snippet, terms)
+		}
+		results[i].Snippet = highlightSnippet(results[i].Snippet)
+	}
+
+	return results, hasMore, nil
+}
+
+// entryMatchCondition 返回条目匹配所有关键词的条件，e 是 entries 的别名，s 是 sources 的别名
+func entryMatchCondition(terms []string) (string, []interface{}) {
+	switch {
+	case globalDB.Dialector.Name() == "postgres":
+		tsquery, args := tsQuery(terms)
+		return "(e.search_vector @@ " + tsquery + " OR to_tsvector('simple', coalesce(s.title, '')) @@ " + tsquery + ")", append(args, args...)
+	case useSearchIndex(terms):
+		return "e.id IN (SELECT rowid FROM entries_fts WHERE entries_fts MATCH ?)", []interface{}{ftsQuery(terms)}
+	}
+
+	conditions := make([]string, 0, len(terms))
+	args := make([]interface{}, 0, len(terms)*3)
+	for _, term := range terms {
+		pattern := "%" + escapeLike(term) + "%"
+		conditions = append(conditions, `(e.title LIKE ? ESCAPE '\' OR e.text_content LIKE ? ESCAPE '\' OR s.title LIKE ? ESCAPE '\')`)
+		args = append(args, pattern, pattern, pattern)
+	}
+	return strings.Join(conditions, " AND "), args
+}
+
+func useSearchIndex(terms []string) bool {
+	return globalDB.Dialector.Name() != "postgres" && hasSQLiteSearchIndex(globalDB) && shortestTerm(terms) >= searchMinTermLength
+}
+
+// tsQuery 每个词作为一个短语，所有短语都需要匹配
+func tsQuery(terms []string) (string, []interface{}) {
+	parts := make([]string, len(terms))
+	args := make([]interface{}, len(terms))
+	for i, term := range terms {
+		parts[i], args[i] = "phraseto_tsquery('simple', ?)", term
+	}
+	return "(" + strings.Join(parts, " && ") + ")", args
+}
+
+func applySearchFilters(query *gorm.DB, email string, opts SearchOptions) (*gorm.DB, error) {
+	if opts.FeedID != 0 {
+		query = query.Where("a.feed_id = ?", opts.FeedID)
+	}
+	if opts.Category != "" {
+		query = query.Where("a.feed_id IN (?)", globalDB.Model(&Feed{}).Select("id").Where("email = ? AND categories = ?", email, opts.Category))
+	}
+
+	if opts.Favorite {
+		query = query.Where("a.favorite = ?", true)
+	}
+
+	switch opts.Read {
+	case "unread":
+		query = query.Where("a.read = ?", false)
+	case "read":
+		query = query.Where("a.read = ?", true)
+	}
+
+	if opts.From != "" {
+		from, err := time.ParseInLocation(time.DateOnly, opts.From, time.Local)
+		if err != nil {
+			return nil, fmt.Errorf("invalid from date: %v", err)
+		}
+		query = query.Where("a.publish_at >= ?", from.Unix())
+	}
+	if opts.To != "" {
+		to, err := time.ParseInLocation(time.DateOnly, opts.To, time.Local)
+		if err != nil {
+			return nil, fmt.Errorf("invalid to date: %v", err)
+		}
+		query = query.Where("a.publish_at < ?", to.AddDate(0, 0, 1).Unix())
+	}
+
+	return query, nil
+}
+
+// ftsQuery 把每个词作为短语引用，避免用户输入被解析为 FTS5 语法
+func ftsQuery(terms []string) string {
+	quoted := make([]string, len(terms))
+	for i, term := range terms {
+		quoted[i] = `"` + strings.ReplaceAll(term, `"`, `""`) + `"`
+	}
+	return strings.Join(quoted, " ")
+}
+
+func shortestTerm(terms []string) int {
+	shortest := 0
+	for i, term := range terms {
+		if n := utf8.RuneCountInString(term); i == 0 || n < shortest {
+			shortest = n
+		}
+	}
+	return shortest
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// makeSnippet 截取第一个命中词附近的文本并标记命中词，用于没有全文索引时
+func makeSnippet(text string, terms []string) string {
+	const radius = 80
+
+	// 大小写转换可能改变字节长度，按 rune 查找命中位置再截取原文
+	runes := []rune(text)
+	lower := foldRunes(text)
+	first := -1
+	for _, term := range terms {
+		if i := strings.Index(lower, foldRunes(term)); i >= 0 {
+			if i = utf8.RuneCountInString(lower[:i]); first < 0 || i < first {
+				first = i
+			}
+		}
+	}
+
+	start := 0
+	if first > 0 {
+		start = max(first-radius, 0)
+	}
+	end := min(start+radius*2, len(runes))
+
+	snippet := string(runes[start:end])
+	if start > 0 {
+		snippet = "…" + snippet
+	}
+	if end < len(runes) {
+		snippet += "…"
+	}
+
+	for _, term := range terms {
+		snippet = markTerm(snippet, term)
+	}
+	return snippet
+}
+
+// foldRunes 逐个 rune 转小写，结果和原文的 rune 数量相同
+func foldRunes(text string) string {
+	return strings.Map(unicode.ToLower, text)
+}
+
+func markTerm(text, term string) string {
+	lowerText, lowerTerm := strings.ToLower(text), strings.ToLower(term)
+	// 大小写转换改变字节长度时不做标记，避免切错位置
+	if lowerTerm == "" || len(lowerText) != len(text) || len(lowerTerm) != len(term) {
+		return text
+	}
+
+	var sb strings.Builder
+	for {
+		i := strings.Index(lowerText, lowerTerm)
+		if i < 0 {
+			sb.WriteString(text)
+			return sb.String()
+		}
+		sb.WriteString(text[:i] + snippetStart + text[i:i+len(term)] + snippetStop)
+		text, lowerText = text[i+len(term):], lowerText[i+len(term):]
+	}
+}
+
+// highlightSnippet 转义 snippet 后把占位符替换为 <mark>
+func highlightSnippet(snippet string) string {
+	escaped := html.EscapeString(snippet)
+	return strings.NewReplacer(snippetStart, "<mark>", snippetStop, "</mark>").Replace(escaped)
+}
+
+// htmlToText 提取 HTML 中的纯文本，块级元素之间用空格分隔
+func htmlToText(content string) string {
+	if content == "" {
+		return ""
+	}
+
+	fragmentContext := &xhtml.Node{Type: xhtml.ElementNode, Data: "div", DataAtom: atom.Div}
+	nodes, err := xhtml.ParseFragment(strings.NewReader(content), fragmentContext)
+	if err != nil {
+		return ""
+	}
+
+	var sb strings.Builder
+	for _, n := range nodes {
+		walkNodes(n, func(c *xhtml.Node) {
+			switch {
+			case c.Type == xhtml.TextNode && (c.Parent == nil || (c.Parent.DataAtom != atom.Script && c.Parent.DataAtom != atom.Style)):
+				sb.WriteString(c.Data)
+			case c.Type == xhtml.ElementNode:
+				sb.WriteString(" ")
+			}
+		})
+	}
+
+	return strings.Join(strings.Fields(sb.String()), " ")
+}
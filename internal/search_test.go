@@ -0,0 +1,157 @@
+package internal
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+func TestHTMLToText(t *testing.T) {
+	got := htmlToText(`<p>Hello <b>world</b></p><p>second&nbsp;line &lt;tag&gt;</p><style>p{}</style>`)
+	if got != "Hello world second line <tag>" {
+		t.Fatalf("htmlToText() = %q", got)
+	}
+}
+
+func TestSearchArticles(t *testing.T) {
+	db := useTestDB(t)
+
+	id, err := getSetFeed("https://example.com/feed", "alice@example.com", "Gopher Weekly", 0)
+	if err != nil {
+		t.Fatalf("getSetFeed() error = %v", err)
+	}
+	var fd Feed
+	db.First(&fd, id)
+	db.Model(&Source{}).Where("id = ?", fd.SourceID).Update("title", "Gopher Weekly")
+
+	now := time.Now()
+	save := func(items ...*gofeed.Item) {
+		t.Helper()
+		for _, item := range items {
+			item.PublishedParsed = &now
+		}
+		if err := saveFeedGroupResult(fd.URL, []*Feed{&fd}, &fetchResult{Feed: &gofeed.Feed{Title: "Gopher Weekly", Items: items}}); err != nil {
+			t.Fatalf("saveFeedGroupResult() error = %v", err)
+		}
+	}
+
+	save(&gofeed.Item{GUID: "1", Title: "Generics deep dive", Link: "https://example.com/1",
+		Content: "<p>Type parameters &lt;script&gt; arrived in Go 1.18</p>"})
+
+	// 迁移前已有的条目需要回填纯文本并加入索引
+	db.Model(&Entry{}).Where("guid = ?", "1").Update("text_content", nil)
+	if err := migrateSearchIndex(db); err != nil {
+		t.Fatalf("migrateSearchIndex() error = %v", err)
+	}
+
+	// 迁移之后新增的条目由触发器同步
+	save(&gofeed.Item{GUID: "2", Title: "中文文章", Link: "https://example.com/2", Content: "<p>这是一个关于全文搜索的例子</p>"})
+
+	search := func(opts SearchOptions) []SearchResult {
+		t.Helper()
+		opts.Terms = parseSearchQuery(opts.Query).Terms
+		results, _, err := searchArticles("alice@example.com", opts)
+		if err != nil {
+			t.Fatalf("searchArticles(%+v) error = %v", opts, err)
+		}
+		return results
+	}
+
+	results := search(SearchOptions{Query: "generics"})
+	if len(results) != 1 || results[0].Title != "Generics deep dive" {
+		t.Fatalf("search generics = %+v", results)
+	}
+
+	results = search(SearchOptions{Query: "arrived"})
+	if len(results) != 1 || !strings.Contains(results[0].Snippet, "<mark>arrived</mark>") || strings.Contains(results[0].Snippet, "<script>") {
+		t.Fatalf("snippet should be escaped and highlighted, got %+v", results)
+	}
+
+	if results = search(SearchOptions{Query: "全文搜索"}); len(results) != 1 || results[0].Title != "中文文章" {
+		t.Fatalf("search chinese = %+v", results)
+	}
+	if results = search(SearchOptions{Query: "中文"}); len(results) != 1 {
+		t.Fatalf("short terms should still match, got %+v", results)
+	}
+	if results = search(SearchOptions{Query: "gopher"}); len(results) != 2 {
+		t.Fatalf("feed name should be searchable, got %+v", results)
+	}
+	if results = search(SearchOptions{Query: "deep", FeedID: fd.ID + 1}); len(results) != 0 {
+		t.Fatalf("feed filter should exclude other feeds, got %+v", results)
+	}
+
+	db.Model(&Article{}).Where("guid = ?", "1").Update("read", true)
+	if results = search(SearchOptions{Query: "gopher", Read: "unread"}); len(results) != 1 || results[0].Title != "中文文章" {
+		t.Fatalf("unread filter = %+v", results)
+	}
+
+	yesterday := now.AddDate(0, 0, -1).Format(time.DateOnly)
+	if results = search(SearchOptions{Query: "gopher", To: yesterday}); len(results) != 0 {
+		t.Fatalf("date filter = %+v", results)
+	}
+	if _, _, err := searchArticles("alice@example.com", SearchOptions{Terms: []string{"gopher"}, From: "bad"}); err == nil {
+		t.Fatalf("invalid date should be rejected")
+	}
+
+	if results = search(SearchOptions{Query: "generics"}); len(results) != 1 {
+		t.Fatalf("search after update = %+v", results)
+	}
+
+	if hasSQLiteSearchIndex(db) {
+		db.Where("guid = ?", "2").Delete(&Entry{})
+		var indexed int64
+		db.Raw("SELECT count(*) FROM entries_fts").Scan(&indexed)
+		if indexed != 1 {
+			t.Fatalf("deleted entry should be removed from the index, %d rows left", indexed)
+		}
+	}
+}
+
+func TestParseSearchQuery(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want SearchOptions
+	}{
+		{
+			raw:  `category:Tech "kubernetes" -is:read`,
+			want: SearchOptions{Terms: []string{"kubernetes"}, Category: "Tech", Read: "unread"},
+		},
+		{
+			raw:  `category:"Tech News" "service mesh" is:starred feed:12 from:2024-01-01 to:2024-02-01`,
+			want: SearchOptions{Terms: []string{"service mesh"}, Category: "Tech News", Favorite: true, FeedID: 12, From: "2024-01-01", To: "2024-02-01"},
+		},
+		{
+			raw:  `-is:unread golang https://go.dev "is:read"`,
+			want: SearchOptions{Terms: []string{"golang", "https://go.dev", "is:read"}, Read: "read"},
+		},
+	}
+
+	for _, tt := range tests {
+		got := parseSearchQuery(tt.raw)
+		tt.want.Query = tt.raw
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseSearchQuery(%q) = %+v, want %+v", tt.raw, got, tt.want)
+		}
+
+		// 还原后的语法解析结果一致
+		if again := parseSearchQuery(formatSearchQuery(got)); !reflect.DeepEqual(again.Terms, got.Terms) || again.Category != got.Category || again.Read != got.Read {
+			t.Errorf("formatSearchQuery(%+v) = %q does not round trip", got, formatSearchQuery(got))
+		}
+	}
+}
+
+func TestMakeSnippetCaseFolding(t *testing.T) {
+	// Ⱥ 转小写后从 2 字节变成 3 字节，命中位置不能按小写后的字节偏移截取原文
+	text := strings.Repeat("Ⱥ", 100) + "foo"
+	snippet := makeSnippet(text, []string{"foo"})
+	if !strings.HasPrefix(snippet, "…"+strings.Repeat("Ⱥ", 80)) || !strings.Contains(snippet, "foo") {
+		t.Fatalf("makeSnippet() = %q", snippet)
+	}
+
+	if got := makeSnippet("Go GOPHER", []string{"gopher"}); got != "Go "+snippetStart+"GOPHER"+snippetStop {
+		t.Fatalf("makeSnippet() = %q", got)
+	}
+}
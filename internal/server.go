@@ -1,9 +1,12 @@
 package internal
 
 import (
+	"errors"
 	"fmt"
+	"html"
 	"io"
 	"net/http"
+	"net/url"
 	"strconv"
 	"time"
 
@@ -11,6 +14,25 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// requestEmail 返回请求对应的用户邮箱，启用了 GitHub 登录但没有有效会话时返回错误
+func requestEmail(r *http.Request) (string, error) {
+	// 调试模式下直接使用默认邮箱 or 检查是否启用了 GitHub 登录
+	if DebugMode || !checkAnyUserHasGitHubLogin() {
+		return DefaultEmail, nil
+	}
+
+	// 启用了 GitHub 登录，检查是否有有效的 GitHub 会话
+	session, err := checkRefreshGHStatus(r)
+	if err != nil {
+		return "", err
+	}
+	// 会话有效期内账号可能被停用或删除
+	if _, err := getActiveUser(session.Email); err != nil {
+		return "", err
+	}
+	return session.Email, nil
+}
+
 func ServerRouter() *gin.Engine {
 	r := gin.Default()
 
@@ -18,25 +40,38 @@ func ServerRouter() *gin.Engine {
 	r.SetHTMLTemplate(tmpl)
 
 	checklogin := func(c *gin.Context) {
-		// 调试模式下直接使用默认邮箱 or 检查是否启用了 GitHub 登录
-		if DebugMode || !checkAnyUserHasGitHubLogin() {
-			c.Set("email", DefaultEmail)
-			c.Next()
-			return
-		}
-
-		// 启用了 GitHub 登录，检查是否有有效的 GitHub 会话
-		session, err := checkRefreshGHStatus(c.Request)
+		email, err := requestEmail(c.Request)
 		if err != nil {
 			// 没有有效会话，重定向到登录页面
 			c.Redirect(http.StatusSeeOther, "/login")
+			c.Abort()
+			return
+		}
+
+		// 只读账号只能浏览
+		if !isReadMethod(c.Request.Method) && !userCanWrite(email) {
+			c.String(http.StatusForbidden, "account is read-only")
+			c.Abort()
 			return
 		}
 
-		c.Set("email", session.Email)
+		c.Set("email", email)
 		c.Next()
 	}
 
+	checkadmin := func(c *gin.Context) {
+		if !isAdminUser(c.GetString("email")) {
+			c.String(http.StatusForbidden, "admin only")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+
+	registerAPIRoutes(r.Group("/api/v1", apiAuth))
+	registerGReaderRoutes(r)
+	registerFeverRoutes(r)
+
 	r.GET("/", checklogin, func(c *gin.Context) {
 		email := c.GetString("email")
 
@@ -45,13 +80,18 @@ func ServerRouter() *gin.Engine {
 			return
 		}
 
-		articles := getRecentlyArticles(email)
+		showHidden := c.Query("show_hidden") == "true"
+		articles, next := getRecentlyArticles(email, showHidden, c.Query("before"))
 		c.HTML(http.StatusOK, "articles.html", gin.H{
 			"Articles":            articles,
 			"SiteURL":             SiteURL,
 			"Headline":            "Unreads",
-			"ShowHidden":          c.Query("show_hidden") == "true",
+			"ShowHidden":          showHidden,
 			"DisplayHiddenToggle": true,
+			"BulkScope":           map[string]string{"scope": "unread", "show_hidden": strconv.FormatBool(showHidden)},
+			"ReadOnScroll":        readOnScrollEnabled(email),
+			"NextPage":            pageURL(c, next),
+			"FirstPage":           firstPageURL(c),
 		})
 	})
 
@@ -80,6 +120,7 @@ func ServerRouter() *gin.Engine {
 			"CurrentCategory": currentCategory,
 			"SiteURL":         SiteURL,
 			"InboxFeeds":      getFeedsByCategory(email, ""),
+			"SavedSearches":   getSavedSearches(email),
 		})
 	})
 
@@ -92,16 +133,20 @@ func ServerRouter() *gin.Engine {
 			return
 		}
 
-		articles := getArticlesByCategory(email, category)
+		articles, next := getArticlesByCategory(email, category, c.Query("before"))
 		headline := category
 		if category == "" {
 			headline = "Inbox"
 		}
 
 		c.HTML(http.StatusOK, "articles.html", gin.H{
-			"Articles": articles,
-			"SiteURL":  SiteURL,
-			"Headline": headline,
+			"Articles":     articles,
+			"SiteURL":      SiteURL,
+			"Headline":     headline,
+			"BulkScope":    map[string]string{"scope": "category", "category": category},
+			"ReadOnScroll": readOnScrollEnabled(email),
+			"NextPage":     pageURL(c, next),
+			"FirstPage":    firstPageURL(c),
 		})
 	})
 
@@ -121,7 +166,7 @@ func ServerRouter() *gin.Engine {
 			return
 		}
 
-		articles := getFeedArticles(email, id)
+		articles, next := getFeedArticles(email, id, c.Query("before"))
 		categories := getCategories(email)
 		c.HTML(http.StatusOK, "articles.html", gin.H{
 			"Articles":        articles,
@@ -134,11 +179,16 @@ func ServerRouter() *gin.Engine {
 				"enable_readability": strconv.FormatBool(feed.EnableReadability),
 				"highlight":          strconv.FormatBool(feed.Highlight),
 			},
-			"HideCreateBy":  true,
-			"FeedID":        id,
-			"LastFetchedAt": feed.LastFetchedAt,
-			"Categories":    categories,
-			"Feed":          feed,
+			"HideCreateBy":     true,
+			"FeedID":           id,
+			"LastFetchedAt":    feed.LastFetchedAt,
+			"Categories":       categories,
+			"Feed":             feed,
+			"RefreshIntervals": feedRefreshIntervalOptions,
+			"BulkScope":        map[string]string{"scope": "feed", "feed_id": id},
+			"ReadOnScroll":     readOnScrollEnabled(email),
+			"NextPage":         pageURL(c, next),
+			"FirstPage":        firstPageURL(c),
 		})
 	})
 
@@ -182,9 +232,23 @@ func ServerRouter() *gin.Engine {
 			return
 		}
 
-		log.Infof("update feed: %s, %t, %t, %t, %s", id, hide, enableReadability, highlight, category)
+		// 表单没有提交刷新间隔时保留原值，提交了但无法解析时返回 400
+		refreshInterval := getFeed(id, email).RefreshInterval
+		if value, ok := c.GetPostForm("refresh_interval"); ok {
+			parsed, err := strconv.Atoi(value)
+			if err != nil {
+				c.String(http.StatusBadRequest, errInvalidRefreshInterval.Error())
+				return
+			}
+			refreshInterval = parsed
+		}
+
+		log.Infof("update feed: %s, %t, %t, %t, %s, %d", id, hide, enableReadability, highlight, category, refreshInterval)
 
-		updateFeed(email, id, hide, enableReadability, highlight)
+		if err := updateFeed(email, id, hide, enableReadability, highlight, refreshInterval); err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
 		if category != "" {
 			updateFeedCategory(email, id, category)
 		}
@@ -202,7 +266,23 @@ func ServerRouter() *gin.Engine {
 			return
 		}
 
-		feedID, err := addFeedAndCreateArticles(feedURL, email)
+		feeds, err := discoverFeeds(c.Request.Context(), feedURL)
+		if err != nil {
+			c.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		// 站点声明了多个 feed 时先让用户选择
+		if len(feeds) > 1 {
+			c.HTML(http.StatusOK, "discover.html", gin.H{
+				"SiteURL": SiteURL,
+				"PageURL": feedURL,
+				"Feeds":   feeds,
+			})
+			return
+		}
+
+		feedID, err := addFeedAndCreateArticles(feeds[0], email)
 		if err != nil {
 			c.String(http.StatusInternalServerError, err.Error())
 			return
@@ -280,7 +360,7 @@ func ServerRouter() *gin.Engine {
 		uid := c.Param("uid")
 		email := c.GetString("email")
 
-		article, err := getReadArticle(uid, email)
+		article, err := getArticle(uid, email)
 		if err != nil {
 			c.String(http.StatusInternalServerError, err.Error())
 			return
@@ -293,19 +373,75 @@ func ServerRouter() *gin.Engine {
 		uid := c.Param("uid")
 		email := c.GetString("email")
 
-		article, err := getReadArticle(uid, email)
+		article, err := getArticle(uid, email)
 		if err != nil {
 			c.String(http.StatusNotFound, "Article not found")
 			return
 		}
+		// 默认展示提取的全文，?view=feed 查看 feed 自带的内容
+		content, fullText := article.Content, false
+		if article.FullContent != "" && c.Query("view") != "feed" {
+			content, fullText = article.FullContent, true
+		}
+
 		c.HTML(http.StatusOK, "content.html", gin.H{
-			"Title":     article.Title,
-			"PublishAt": article.PublishAt,
-			"Content":   article.Content,
+			"Uid":         article.Uid,
+			"Title":       article.Title,
+			"Link":        article.Link,
+			"PublishAt":   article.PublishAt,
+			"Content":     rewriteImageURLs(sanitizeHTML(content, article.Link)),
+			"FullText":    fullText,
+			"HasFullText": article.FullContent != "",
+			"Enclosures":  article.Enclosures,
+			"Episode":     episodeEnclosureIndex(article.Enclosures),
+			"Position":    article.PlaybackPosition,
+			"Read":        article.Read,
 		})
 	})
 
-	r.GET("/article/:uid/delete", checklogin, func(c *gin.Context) {
+	r.POST("/article/:uid/position", checklogin, func(c *gin.Context) {
+		uid := c.Param("uid")
+		email := c.GetString("email")
+
+		position, err := strconv.Atoi(c.PostForm("position"))
+		if email == "" || uid == "" || err != nil {
+			c.String(http.StatusBadRequest, "invalid request")
+			return
+		}
+
+		if err := updatePlaybackPosition(uid, email, position); err != nil {
+			c.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		c.Status(http.StatusNoContent)
+	})
+
+	// read 为 true/false 时直接设置，不传则切换
+	r.POST("/article/:uid/toggle-read", checklogin, func(c *gin.Context) {
+		uid := c.Param("uid")
+		email := c.GetString("email")
+
+		if email == "" || uid == "" {
+			c.String(http.StatusBadRequest, "invalid request")
+			return
+		}
+
+		var err error
+		if read, parseErr := strconv.ParseBool(c.PostForm("read")); parseErr == nil {
+			err = setArticleRead(uid, email, read)
+		} else {
+			err = toggleRead(uid, email)
+		}
+		if err != nil {
+			c.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		c.Status(http.StatusNoContent)
+	})
+
+	r.POST("/article/:uid/delete", checklogin, func(c *gin.Context) {
 		uid := c.Param("uid")
 		email := c.GetString("email")
 
@@ -320,7 +456,7 @@ func ServerRouter() *gin.Engine {
 			return
 		}
 
-		c.Redirect(http.StatusSeeOther, "/")
+		c.Redirect(http.StatusSeeOther, c.Request.Referer())
 	})
 
 	r.POST("/article/:uid/favorite", checklogin, func(c *gin.Context) {
@@ -341,6 +477,50 @@ func ServerRouter() *gin.Engine {
 		c.Redirect(http.StatusSeeOther, c.Request.Referer())
 	})
 
+	r.POST("/articles/bulk", checklogin, func(c *gin.Context) {
+		email := c.GetString("email")
+
+		if email == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+			return
+		}
+
+		days, _ := strconv.Atoi(c.PostForm("days"))
+		target := BulkTarget{
+			Scope:         c.PostForm("scope"),
+			Uids:          c.PostFormArray("uid"),
+			FeedID:        c.PostForm("feed_id"),
+			Category:      c.PostForm("category"),
+			ShowHidden:    c.PostForm("show_hidden") == "true",
+			OlderThanDays: days,
+		}
+
+		record, err := bulkUpdateArticles(email, c.PostForm("action"), target)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, record)
+	})
+
+	r.POST("/articles/bulk/undo", checklogin, func(c *gin.Context) {
+		email := c.GetString("email")
+
+		if email == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+			return
+		}
+
+		record, err := undoBulkAction(email)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, record)
+	})
+
 	r.GET("/favorites", checklogin, func(c *gin.Context) {
 		email := c.GetString("email")
 
@@ -349,14 +529,176 @@ func ServerRouter() *gin.Engine {
 			return
 		}
 
-		articles := getFavoriteArticles(email)
+		articles, next := getFavoriteArticles(email, c.Query("before"))
 		c.HTML(http.StatusOK, "articles.html", gin.H{
-			"Articles": articles,
-			"SiteURL":  SiteURL,
-			"Headline": "Favorites",
+			"Articles":  articles,
+			"SiteURL":   SiteURL,
+			"Headline":  "Favorites",
+			"NextPage":  pageURL(c, next),
+			"FirstPage": firstPageURL(c),
 		})
 	})
 
+	r.GET("/search", checklogin, func(c *gin.Context) {
+		email := c.GetString("email")
+
+		opts := searchOptionsFromQuery(c)
+		data := gin.H{
+			"Options":    opts,
+			"Feeds":      getFeeds(email),
+			"Categories": getCategories(email),
+			"SiteURL":    SiteURL,
+		}
+
+		if len(opts.Terms) > 0 || opts.hasFilters() {
+			results, hasMore, err := searchArticles(email, opts)
+			if err != nil {
+				c.String(http.StatusBadRequest, err.Error())
+				return
+			}
+			data["Searched"] = true
+			data["Results"] = results
+			data["SavedQuery"] = formatSearchQuery(opts)
+			if hasMore {
+				data["NextPage"] = searchPageURL(c, opts.Page+1)
+			}
+			if opts.Page > 0 {
+				data["PrevPage"] = searchPageURL(c, opts.Page-1)
+			}
+		}
+
+		c.HTML(http.StatusOK, "search.html", data)
+	})
+
+	r.GET("/api/search", checklogin, func(c *gin.Context) {
+		email := c.GetString("email")
+
+		opts := searchOptionsFromQuery(c)
+		if len(opts.Terms) == 0 && !opts.hasFilters() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "q or a filter is required"})
+			return
+		}
+
+		results, hasMore, err := searchArticles(email, opts)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"results":  results,
+			"page":     opts.Page,
+			"has_more": hasMore,
+		})
+	})
+
+	r.POST("/saved", checklogin, func(c *gin.Context) {
+		email := c.GetString("email")
+
+		if email == "" {
+			c.String(http.StatusBadRequest, "invalid request")
+			return
+		}
+
+		id, err := createSavedSearch(email, c.PostForm("name"), c.PostForm("query"), c.PostForm("highlight") == "true")
+		if err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+
+		c.Redirect(http.StatusSeeOther, fmt.Sprintf("/saved/%d", id))
+	})
+
+	r.GET("/saved/:id", checklogin, func(c *gin.Context) {
+		email := c.GetString("email")
+
+		if email == "" {
+			c.String(http.StatusBadRequest, "invalid request")
+			return
+		}
+
+		search := getSavedSearch(email, c.Param("id"))
+		if search == nil {
+			c.String(http.StatusNotFound, "saved search not found")
+			return
+		}
+
+		articles, next, err := getSavedSearchArticles(email, search, c.Query("before"))
+		if err != nil {
+			c.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		c.HTML(http.StatusOK, "articles.html", gin.H{
+			"Articles":    articles,
+			"SiteURL":     SiteURL,
+			"Headline":    search.Name,
+			"SavedSearch": search,
+			"NextPage":    pageURL(c, next),
+			"FirstPage":   firstPageURL(c),
+		})
+	})
+
+	r.POST("/saved/:id/update", checklogin, func(c *gin.Context) {
+		email := c.GetString("email")
+		id := c.Param("id")
+
+		if email == "" {
+			c.String(http.StatusBadRequest, "invalid request")
+			return
+		}
+
+		err := updateSavedSearch(email, id, c.PostForm("name"), c.PostForm("query"), c.PostForm("highlight") == "true")
+		if err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+
+		c.Redirect(http.StatusSeeOther, "/saved/"+id)
+	})
+
+	r.POST("/saved/:id/delete", checklogin, func(c *gin.Context) {
+		email := c.GetString("email")
+
+		if email == "" {
+			c.String(http.StatusBadRequest, "invalid request")
+			return
+		}
+
+		if err := deleteSavedSearch(email, c.Param("id")); err != nil {
+			c.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		c.Redirect(http.StatusSeeOther, "/feed")
+	})
+
+	// 图片代理不需要登录，依靠签名防止被当作开放代理
+	r.GET("/proxy/image", func(c *gin.Context) {
+		rawURL := c.Query("url")
+		if rawURL == "" || !verifyImageURL(rawURL, c.Query("sig")) {
+			c.String(http.StatusForbidden, "invalid signature")
+			return
+		}
+
+		contentType, body, err := fetchProxiedImage(c.Request.Context(), rawURL)
+		if errors.Is(err, errImageNotAllowed) {
+			c.String(http.StatusForbidden, "image not allowed")
+			return
+		}
+		if err != nil {
+			log.Errorf("could not proxy image %s: %v", rawURL, err)
+			c.String(http.StatusBadGateway, "could not fetch image")
+			return
+		}
+
+		// SVG 可能带脚本，禁止执行并禁止浏览器猜测类型
+		c.Header("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; sandbox")
+		c.Header("X-Content-Type-Options", "nosniff")
+		c.Header("Cache-Control", "public, max-age=604800, immutable")
+		c.Data(http.StatusOK, contentType, body)
+	})
+
 	r.GET("/favicon.ico", func(c *gin.Context) {
 		favicon, _ := assetFs.ReadFile("assets/favicon.ico")
 		c.Data(http.StatusOK, "image/x-icon", favicon)
@@ -370,6 +712,11 @@ func ServerRouter() *gin.Engine {
 			return
 		}
 
+		// 新用户通过 /login?invite=<code> 注册，邀请码在 GitHub 回调时使用
+		if code := c.Query("invite"); code != "" {
+			http.SetCookie(c.Writer, &http.Cookie{Name: inviteCookie, Value: code, MaxAge: 10 * 60, Path: "/", HttpOnly: true})
+		}
+
 		redirectURL := fmt.Sprintf("https://github.com/login/oauth/authorize?client_id=%s&scope=user&redirect_uri=%s",
 			adminPref.GitHubClientID, fmt.Sprintf("%s/login/callback", SiteURL))
 		c.Redirect(http.StatusSeeOther, redirectURL)
@@ -397,6 +744,18 @@ func ServerRouter() *gin.Engine {
 			return
 		}
 
+		// 只有允许列表中的邮箱和持有邀请码的新用户可以登录
+		inviteCode := ""
+		if cookie, err := c.Request.Cookie(inviteCookie); err == nil {
+			inviteCode = cookie.Value
+			http.SetCookie(c.Writer, &http.Cookie{Name: inviteCookie, MaxAge: -1, Path: "/"})
+		}
+		if _, err := loginUser(email, inviteCode); err != nil {
+			log.Infof("login rejected for %s: %v", email, err)
+			c.String(http.StatusForbidden, "<html><body><h1>Login not allowed: %s</h1></body></html>", html.EscapeString(err.Error()))
+			return
+		}
+
 		session := Session{
 			AK:     ak,
 			RK:     sk,
@@ -408,6 +767,44 @@ func ServerRouter() *gin.Engine {
 		c.Redirect(http.StatusSeeOther, "/")
 	})
 
+	// WebSub hub 回调：GET 验证订阅意图，POST 接收推送内容
+	r.GET("/websub/:id", func(c *gin.Context) {
+		sourceID, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+		leaseSeconds, _ := strconv.Atoi(c.Query("hub.lease_seconds"))
+
+		err := verifyWebSubIntent(sourceID, c.Query("hub.mode"), c.Query("hub.topic"), leaseSeconds)
+		if err != nil {
+			log.Errorf("websub verification failed for source %d: %v", sourceID, err)
+			c.String(http.StatusNotFound, "not found")
+			return
+		}
+
+		c.String(http.StatusOK, c.Query("hub.challenge"))
+	})
+
+	r.POST("/websub/:id", func(c *gin.Context) {
+		sourceID, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+
+		body, err := io.ReadAll(io.LimitReader(c.Request.Body, websubMaxPushSize))
+		if err != nil {
+			c.String(http.StatusBadRequest, "invalid request")
+			return
+		}
+
+		err = receiveWebSubPush(sourceID, body, c.GetHeader("X-Hub-Signature"))
+		if err == errWebSubUnknownSource {
+			c.String(http.StatusNotFound, "not found")
+			return
+		}
+		if err != nil {
+			log.Errorf("could not save websub push for source %d: %v", sourceID, err)
+			c.String(http.StatusInternalServerError, "internal error")
+			return
+		}
+
+		c.Status(http.StatusAccepted)
+	})
+
 	r.GET("/stream", checklogin, func(c *gin.Context) {
 		email := c.GetString("email")
 
@@ -425,6 +822,32 @@ func ServerRouter() *gin.Engine {
 		})
 	})
 
+	renderPreference := func(c *gin.Context, email string, extra gin.H) {
+		pref, err := getUserPreference(email)
+		if err != nil {
+			c.String(http.StatusInternalServerError, "Failed to get preferences: %v", err)
+			return
+		}
+
+		data := gin.H{
+			"SiteURL":    SiteURL,
+			"Preference": pref,
+			"IsAdmin":    isAdminUser(email),
+			"OwnsSite":   ownsSiteSettings(email),
+			"Categories": getCategories(email),
+			"Feeds":      getFeeds(email),
+			"Rules":      getRules(email),
+			"Tokens":     getAPITokens(email),
+			"NewRule":    Rule{Enabled: true},
+			"Message":    c.Query("message"),
+		}
+		for k, v := range extra {
+			data[k] = v
+		}
+
+		c.HTML(http.StatusOK, "preference.html", data)
+	}
+
 	r.GET("/preference", checklogin, func(c *gin.Context) {
 		email := c.GetString("email")
 		if email == "" {
@@ -432,22 +855,246 @@ func ServerRouter() *gin.Engine {
 			return
 		}
 
-		pref, err := getUserPreference(email)
+		renderPreference(c, email, nil)
+	})
+
+	r.POST("/preference/rules", checklogin, func(c *gin.Context) {
+		email := c.GetString("email")
+
+		if email == "" {
+			c.String(http.StatusBadRequest, "invalid request")
+			return
+		}
+
+		feedID, _ := strconv.ParseInt(c.PostForm("feed_id"), 10, 64)
+		shorterThan, _ := strconv.Atoi(c.PostForm("shorter_than"))
+		rule := Rule{
+			Name:           c.PostForm("name"),
+			Enabled:        true,
+			FeedID:         feedID,
+			TitlePattern:   c.PostForm("title_pattern"),
+			ContentPattern: c.PostForm("content_pattern"),
+			ShorterThan:    shorterThan,
+			MarkRead:       c.PostForm("mark_read") == "true",
+			Favorite:       c.PostForm("favorite") == "true",
+			Highlight:      c.PostForm("highlight") == "true",
+			Drop:           c.PostForm("drop") == "true",
+		}
+
+		// 试运行只展示匹配的文章，不保存规则
+		if c.PostForm("action") == "dry_run" {
+			matched, err := dryRunRule(email, rule)
+			extra := gin.H{"NewRule": rule, "DryRunRule": describeRule(rule), "DryRunArticles": matched}
+			if err != nil {
+				extra["Message"] = err.Error()
+			}
+			renderPreference(c, email, extra)
+			return
+		}
+
+		if err := createRule(email, rule); err != nil {
+			renderPreference(c, email, gin.H{"NewRule": rule, "Message": err.Error()})
+			return
+		}
+
+		c.Redirect(http.StatusFound, "/preference#rules")
+	})
+
+	r.GET("/preference/rules/:id/dry-run", checklogin, func(c *gin.Context) {
+		email := c.GetString("email")
+
+		if email == "" {
+			c.String(http.StatusBadRequest, "invalid request")
+			return
+		}
+
+		rule := getRule(email, c.Param("id"))
+		if rule == nil {
+			c.String(http.StatusNotFound, "rule not found")
+			return
+		}
+
+		matched, err := dryRunRule(email, *rule)
+		extra := gin.H{"DryRunRule": rule.Name, "DryRunArticles": matched}
 		if err != nil {
-			c.String(http.StatusInternalServerError, "Failed to get preferences: %v", err)
+			extra["Message"] = err.Error()
+		}
+		renderPreference(c, email, extra)
+	})
+
+	r.POST("/preference/rules/:id/toggle", checklogin, func(c *gin.Context) {
+		email := c.GetString("email")
+
+		if email == "" {
+			c.String(http.StatusBadRequest, "invalid request")
 			return
 		}
 
-		categories := getCategories(email)
-		message := c.Query("message")
+		if err := toggleRule(email, c.Param("id")); err != nil {
+			c.String(http.StatusInternalServerError, err.Error())
+			return
+		}
 
-		c.HTML(http.StatusOK, "preference.html", gin.H{
-			"SiteURL":    SiteURL,
-			"Preference": pref,
-			"IsAdmin":    isAdminUser(email),
-			"Categories": categories,
-			"Message":    message,
-		})
+		c.Redirect(http.StatusFound, "/preference#rules")
+	})
+
+	r.POST("/preference/rules/:id/delete", checklogin, func(c *gin.Context) {
+		email := c.GetString("email")
+
+		if email == "" {
+			c.String(http.StatusBadRequest, "invalid request")
+			return
+		}
+
+		if err := deleteRule(email, c.Param("id")); err != nil {
+			c.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		c.Redirect(http.StatusFound, "/preference#rules")
+	})
+
+	r.GET("/preference/rules/export", checklogin, func(c *gin.Context) {
+		email := c.GetString("email")
+
+		if email == "" {
+			c.String(http.StatusBadRequest, "invalid request")
+			return
+		}
+
+		c.Header("Content-Disposition", "attachment; filename=rssy-rules.json")
+		c.IndentedJSON(http.StatusOK, exportRules(email))
+	})
+
+	r.POST("/preference/tokens", checklogin, func(c *gin.Context) {
+		email := c.GetString("email")
+
+		if email == "" {
+			c.String(http.StatusBadRequest, "invalid request")
+			return
+		}
+
+		token, err := createAPIToken(email, c.PostForm("name"), c.PostForm("scope"))
+		if err != nil {
+			renderPreference(c, email, gin.H{"Message": err.Error()})
+			return
+		}
+
+		// 明文令牌只在这次响应中展示
+		renderPreference(c, email, gin.H{"NewToken": token})
+	})
+
+	r.POST("/preference/tokens/:id/revoke", checklogin, func(c *gin.Context) {
+		email := c.GetString("email")
+
+		if email == "" {
+			c.String(http.StatusBadRequest, "invalid request")
+			return
+		}
+
+		if err := revokeAPIToken(email, c.Param("id")); err != nil {
+			c.String(http.StatusNotFound, err.Error())
+			return
+		}
+
+		c.Redirect(http.StatusFound, "/preference#tokens")
+	})
+
+	r.POST("/preference/fever", checklogin, func(c *gin.Context) {
+		email := c.GetString("email")
+
+		if email == "" {
+			c.String(http.StatusBadRequest, "invalid request")
+			return
+		}
+
+		// 停用时清空密码
+		password := c.PostForm("password")
+		if c.PostForm("action") == "disable" {
+			password = ""
+		} else if password == "" {
+			renderPreference(c, email, gin.H{"Message": "Fever password is required"})
+			return
+		}
+
+		if err := setFeverPassword(email, password); err != nil {
+			renderPreference(c, email, gin.H{"Message": err.Error()})
+			return
+		}
+
+		c.Redirect(http.StatusFound, "/preference#fever")
+	})
+
+	renderAdmin := func(c *gin.Context, extra gin.H) {
+		users, err := getUserStats()
+		if err != nil {
+			c.String(http.StatusInternalServerError, "Failed to get users: %v", err)
+			return
+		}
+
+		data := gin.H{
+			"SiteURL":      SiteURL,
+			"Users":        users,
+			"Invites":      getInvites(),
+			"Roles":        userRoles,
+			"DefaultEmail": DefaultEmail,
+			"GitHubLogin":  checkAnyUserHasGitHubLogin(),
+			"Now":          time.Now().Unix(),
+			"Message":      c.Query("message"),
+		}
+		for k, v := range extra {
+			data[k] = v
+		}
+
+		c.HTML(http.StatusOK, "admin.html", data)
+	}
+
+	r.GET("/admin/users", checklogin, checkadmin, func(c *gin.Context) {
+		renderAdmin(c, nil)
+	})
+
+	// 加入允许列表，对应的 GitHub 用户不需要邀请码即可登录
+	r.POST("/admin/users", checklogin, checkadmin, func(c *gin.Context) {
+		if err := addUser(c.PostForm("email"), c.PostForm("role")); err != nil {
+			renderAdmin(c, gin.H{"Message": err.Error()})
+			return
+		}
+		c.Redirect(http.StatusFound, "/admin/users")
+	})
+
+	r.POST("/admin/users/:id/update", checklogin, checkadmin, func(c *gin.Context) {
+		if err := updateUser(c.Param("id"), c.PostForm("role"), c.PostForm("disabled") == "on"); err != nil {
+			renderAdmin(c, gin.H{"Message": err.Error()})
+			return
+		}
+		c.Redirect(http.StatusFound, "/admin/users")
+	})
+
+	r.POST("/admin/users/:id/delete", checklogin, checkadmin, func(c *gin.Context) {
+		email, err := deleteUser(c.Param("id"))
+		if err != nil {
+			renderAdmin(c, gin.H{"Message": err.Error()})
+			return
+		}
+		c.Redirect(http.StatusFound, "/admin/users?message="+url.QueryEscape("Deleted "+email+" and all of its data"))
+	})
+
+	r.POST("/admin/invites", checklogin, checkadmin, func(c *gin.Context) {
+		days, _ := strconv.Atoi(c.PostForm("days"))
+		invite, err := createInvite(c.GetString("email"), c.PostForm("role"), days)
+		if err != nil {
+			renderAdmin(c, gin.H{"Message": err.Error()})
+			return
+		}
+		renderAdmin(c, gin.H{"NewInviteURL": fmt.Sprintf("%s/login?invite=%s", SiteURL, invite.Code)})
+	})
+
+	r.POST("/admin/invites/:id/delete", checklogin, checkadmin, func(c *gin.Context) {
+		if err := deleteInvite(c.Param("id")); err != nil {
+			c.String(http.StatusNotFound, err.Error())
+			return
+		}
+		c.Redirect(http.StatusFound, "/admin/users#invites")
 	})
 
 	r.POST("/category/add", checklogin, func(c *gin.Context) {
@@ -568,9 +1215,10 @@ func ServerRouter() *gin.Engine {
 			pref.EnableAISummary = c.PostForm("enable_ai_summary") == "on"
 			pref.AISummaryTime = c.PostForm("ai_summary_time")
 			pref.AISummaryPrompt = c.PostForm("ai_summary_prompt")
+			pref.ReadOnScroll = c.PostForm("read_on_scroll") == "on"
 
 			// Admin-only settings
-			if isAdminUser(email) {
+			if ownsSiteSettings(email) {
 				log.Infof("Processing admin settings for user: %s", email)
 				log.Infof("enable_github_login form value: %s", c.PostForm("enable_github_login"))
 				pref.EnableGitHubLogin = c.PostForm("enable_github_login") == "on"
@@ -616,3 +1264,59 @@ func ServerRouter() *gin.Engine {
 
 	return r
 }
+
+// pageURL 在当前地址上设置分页游标，保留其它查询参数
+func pageURL(c *gin.Context, cursor string) string {
+	if cursor == "" {
+		return ""
+	}
+
+	query := c.Request.URL.Query()
+	query.Set("before", cursor)
+	return c.Request.URL.Path + "?" + query.Encode()
+}
+
+// firstPageURL 返回当前列表的第一页，已经在第一页时为空
+func firstPageURL(c *gin.Context) string {
+	if c.Query("before") == "" {
+		return ""
+	}
+
+	query := c.Request.URL.Query()
+	query.Del("before")
+	if len(query) == 0 {
+		return c.Request.URL.Path
+	}
+	return c.Request.URL.Path + "?" + query.Encode()
+}
+
+// searchOptionsFromQuery 解析 q 中的搜索语法，表单中选择的过滤条件优先
+func searchOptionsFromQuery(c *gin.Context) SearchOptions {
+	opts := parseSearchQuery(c.Query("q"))
+
+	if feedID, err := strconv.ParseInt(c.Query("feed_id"), 10, 64); err == nil && feedID != 0 {
+		opts.FeedID = feedID
+	}
+	if category := c.Query("category"); category != "" {
+		opts.Category = category
+	}
+	if read := c.Query("read"); read != "" {
+		opts.Read = read
+	}
+	if from := c.Query("from"); from != "" {
+		opts.From = from
+	}
+	if to := c.Query("to"); to != "" {
+		opts.To = to
+	}
+	page, _ := strconv.Atoi(c.Query("page"))
+	opts.Page = max(page, 0)
+
+	return opts
+}
+
+func searchPageURL(c *gin.Context, page int) string {
+	query := c.Request.URL.Query()
+	query.Set("page", strconv.Itoa(page))
+	return c.Request.URL.Path + "?" + query.Encode()
+}
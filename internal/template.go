@@ -67,10 +67,17 @@ var (
 			return strings.TrimSpace(preview) + "…"
 		},
 
-		"displayContentRead": func(content string) bool {
-			return len(content) >= 30
+		"durationformat": func(seconds int) string {
+			if seconds >= 3600 {
+				return fmt.Sprintf("%d:%02d:%02d", seconds/3600, seconds%3600/60, seconds%60)
+			}
+			return fmt.Sprintf("%d:%02d", seconds/60, seconds%60)
 		},
 
+		"mediaKind": enclosureMediaKind,
+
+		"describeRule": describeRule,
+
 		"buzTimeformat": func(t string) string {
 			tm, err := time.Parse(time.RFC3339Nano, t)
 			if err != nil {
@@ -94,16 +101,27 @@ var (
 			return getFeedMetaWithCache(feedID).Categories
 		},
 
+		"formatMinutes": func(minutes int) string {
+			if minutes < 60 || minutes%60 != 0 {
+				return fmt.Sprintf("%dm", minutes)
+			}
+			return fmt.Sprintf("%dh", minutes/60)
+		},
+
+		"feedRefreshMinutes": func(fd *Feed) int {
+			return int(feedRefreshInterval(fd) / time.Minute)
+		},
+
 		"splitLines": func(text string) []string {
 			return strings.Split(text, "\n")
 		},
 
+		// 全文默认在抓取时提取，只有显式配置了外部服务时才提供外链
 		"buildReadabilityURL": func(articleLink string) string {
-			template := ReadabilityURLTemplate
-			if template == "" {
-				template = "https://reada.songjian.li/read/https://r.jina.ai/%s?md=true&nocache=true"
+			if ReadabilityURLTemplate == "" {
+				return ""
 			}
-			return fmt.Sprintf(template, articleLink)
+			return fmt.Sprintf(ReadabilityURLTemplate, articleLink)
 		},
 
 		"getTimeCategory": func(publishAt int64) string {
@@ -0,0 +1,104 @@
+package internal
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+const (
+	apiTokenPrefix = "rssy_"
+	apiScopeRead   = "read"
+	apiScopeWrite  = "write"
+
+	// 最近使用时间的更新间隔，避免每个请求都写数据库
+	apiTokenTouchInterval = time.Minute
+)
+
+var errInvalidAPIToken = errors.New("invalid api token")
+
+func hashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// createAPIToken 生成新令牌，明文只在创建时返回一次
+func createAPIToken(email, name, scope string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", fmt.Errorf("token name is required")
+	}
+	if scope != apiScopeRead && scope != apiScopeWrite {
+		return "", fmt.Errorf("unknown scope %q", scope)
+	}
+
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("could not generate token: %v", err)
+	}
+	token := apiTokenPrefix + hex.EncodeToString(buf)
+
+	record := APIToken{
+		Email:     email,
+		Name:      name,
+		Scope:     scope,
+		TokenHash: hashAPIToken(token),
+		Prefix:    token[:len(apiTokenPrefix)+6],
+		CreateAt:  time.Now().Unix(),
+	}
+	if err := globalDB.Create(&record).Error; err != nil {
+		return "", fmt.Errorf("could not create token: %v", err)
+	}
+	return token, nil
+}
+
+func getAPITokens(email string) []APIToken {
+	tokens := []APIToken{}
+	if err := globalDB.Where("email = ?", email).Order("create_at desc, id desc").Find(&tokens).Error; err != nil {
+		log.Errorf("could not get api tokens: %v", err)
+		return nil
+	}
+	return tokens
+}
+
+func revokeAPIToken(email, id string) error {
+	result := globalDB.Where("id = ? AND email = ?", id, email).Delete(&APIToken{})
+	if result.Error != nil {
+		return fmt.Errorf("could not revoke token: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("token not found")
+	}
+	return nil
+}
+
+// authenticateAPIToken 按哈希查找令牌并记录使用时间
+func authenticateAPIToken(token string) (*APIToken, error) {
+	if !strings.HasPrefix(token, apiTokenPrefix) {
+		return nil, errInvalidAPIToken
+	}
+
+	var record APIToken
+	if err := globalDB.Where("token_hash = ?", hashAPIToken(token)).First(&record).Error; err != nil {
+		return nil, errInvalidAPIToken
+	}
+	// 停用或删除的账号的令牌一并失效
+	if _, err := getActiveUser(record.Email); err != nil {
+		return nil, errInvalidAPIToken
+	}
+
+	now := time.Now()
+	if now.Sub(time.Unix(record.LastUsedAt, 0)) >= apiTokenTouchInterval {
+		record.LastUsedAt = now.Unix()
+		if err := globalDB.Model(&APIToken{}).Where("id = ?", record.ID).Update("last_used_at", record.LastUsedAt).Error; err != nil {
+			log.Errorf("could not update token %d last used: %v", record.ID, err)
+		}
+	}
+	return &record, nil
+}
@@ -0,0 +1,90 @@
+package internal
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAPITokens(t *testing.T) {
+	db := useTestDB(t)
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+	registerAPIRoutes(r.Group("/api/v1", apiAuth))
+
+	email := "alice@example.com"
+	if err := addUser(email, userRoleMember); err != nil {
+		t.Fatalf("addUser() error = %v", err)
+	}
+	if _, err := getSetFeed("https://example.com/feed", email, "Alice feed", 0); err != nil {
+		t.Fatalf("getSetFeed() error = %v", err)
+	}
+	if err := db.Create(&Article{Uid: "a1", Email: email, FeedID: 1, GUID: "a1"}).Error; err != nil {
+		t.Fatalf("create article: %v", err)
+	}
+
+	readToken, err := createAPIToken(email, "script", apiScopeRead)
+	if err != nil {
+		t.Fatalf("createAPIToken() error = %v", err)
+	}
+	writeToken, _ := createAPIToken(email, "phone", apiScopeWrite)
+	if _, err := createAPIToken(email, "bad", "admin"); err == nil {
+		t.Fatalf("unknown scope should be rejected")
+	}
+
+	// 数据库中只保存哈希
+	var stored int64
+	db.Model(&APIToken{}).Where("token_hash = ? OR prefix = ?", readToken, readToken).Count(&stored)
+	if stored != 0 {
+		t.Fatalf("plain token should not be stored")
+	}
+
+	call := func(method, path, auth, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// 令牌决定请求的用户，而不是默认用户
+	w := call("GET", "/api/v1/feeds", "Bearer "+readToken, "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Alice feed") {
+		t.Fatalf("GET with read token = %d %s", w.Code, w.Body.String())
+	}
+	if w := call("PATCH", "/api/v1/articles/a1", "Bearer "+readToken, `{"read": true}`); w.Code != http.StatusForbidden {
+		t.Fatalf("PATCH with read token = %d, want 403", w.Code)
+	}
+	if w := call("PATCH", "/api/v1/articles/a1", "bearer "+writeToken, `{"read": true}`); w.Code != http.StatusOK {
+		t.Fatalf("PATCH with write token = %d %s", w.Code, w.Body.String())
+	}
+	for _, auth := range []string{"Bearer rssy_wrong", "Bearer " + readToken[:len(readToken)-1], "Basic " + readToken} {
+		if w := call("GET", "/api/v1/feeds", auth, ""); w.Code != http.StatusUnauthorized {
+			t.Fatalf("GET with %q = %d, want 401", auth, w.Code)
+		}
+	}
+
+	tokens := getAPITokens(email)
+	if len(tokens) != 2 || tokens[0].LastUsedAt == 0 || !strings.HasPrefix(readToken, tokens[1].Prefix) {
+		t.Fatalf("tokens = %+v", tokens)
+	}
+
+	if err := revokeAPIToken("bob@example.com", strconv.FormatInt(tokens[1].ID, 10)); err == nil {
+		t.Fatalf("other users should not revoke the token")
+	}
+	if err := revokeAPIToken(email, strconv.FormatInt(tokens[1].ID, 10)); err != nil {
+		t.Fatalf("revokeAPIToken() error = %v", err)
+	}
+	if w := call("GET", "/api/v1/feeds", "Bearer "+readToken, ""); w.Code != http.StatusUnauthorized {
+		t.Fatalf("revoked token = %d, want 401", w.Code)
+	}
+}
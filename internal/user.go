@@ -0,0 +1,342 @@
+package internal
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"gorm.io/gorm"
+)
+
+const (
+	userRoleAdmin    = "admin"
+	userRoleMember   = "member"
+	userRoleReadOnly = "readonly"
+
+	// 登录跳转到 GitHub 期间保存邀请码的 cookie
+	inviteCookie = "invite"
+)
+
+var (
+	userRoles = []string{userRoleAdmin, userRoleMember, userRoleReadOnly}
+
+	errUserNotFound  = errors.New("account not found")
+	errUserDisabled  = errors.New("account is disabled")
+	errInvalidInvite = errors.New("invite code is invalid or expired")
+)
+
+func validUserRole(role string) bool {
+	for _, r := range userRoles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// getUser 返回账号，默认用户总是管理员，不存在时自动创建
+func getUser(email string) (*User, error) {
+	var user User
+	err := globalDB.Where("email = ?", email).First(&user).Error
+	if err == gorm.ErrRecordNotFound && email == DefaultEmail {
+		now := time.Now().Unix()
+		user = User{Email: email, Role: userRoleAdmin, CreateAt: now, UpdateAt: now}
+		err = globalDB.Where("email = ?", email).FirstOrCreate(&user).Error
+	}
+	if err == gorm.ErrRecordNotFound {
+		return nil, errUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not get user: %v", err)
+	}
+	return &user, nil
+}
+
+func getActiveUser(email string) (*User, error) {
+	user, err := getUser(email)
+	if err != nil {
+		return nil, err
+	}
+	if user.Disabled {
+		return nil, errUserDisabled
+	}
+	return user, nil
+}
+
+// userCanWrite 只读账号只能浏览，不能修改任何数据
+func userCanWrite(email string) bool {
+	user, err := getActiveUser(email)
+	return err == nil && user.Role != userRoleReadOnly
+}
+
+func disabledUserEmails() *gorm.DB {
+	return globalDB.Model(&User{}).Select("email").Where("disabled = ?", true)
+}
+
+// loginUser 在 GitHub 登录后调用：已有账号直接登录，新用户需要有效的邀请码
+func loginUser(email, inviteCode string) (*User, error) {
+	user, err := getUser(email)
+	if err == errUserNotFound {
+		return registerUser(email, inviteCode)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if user.Disabled {
+		return nil, errUserDisabled
+	}
+
+	user.LastLoginAt = time.Now().Unix()
+	if err := globalDB.Model(user).Update("last_login_at", user.LastLoginAt).Error; err != nil {
+		log.Errorf("could not update last login of %s: %v", email, err)
+	}
+	return user, nil
+}
+
+func registerUser(email, inviteCode string) (*User, error) {
+	if email == "" || inviteCode == "" {
+		return nil, errUserNotFound
+	}
+
+	now := time.Now().Unix()
+	user := User{Email: email, InviteCode: inviteCode, LastLoginAt: now, CreateAt: now, UpdateAt: now}
+	err := globalDB.Transaction(func(tx *gorm.DB) error {
+		var invite Invite
+		err := tx.Where("code = ? AND used_by = '' AND (expire_at = 0 OR expire_at > ?)", inviteCode, now).First(&invite).Error
+		if err != nil {
+			return errInvalidInvite
+		}
+
+		// 条件更新保证同一个邀请码只能使用一次
+		result := tx.Model(&Invite{}).Where("id = ? AND used_by = ''", invite.ID).Updates(map[string]interface{}{"used_by": email, "used_at": now})
+		if result.Error != nil {
+			return fmt.Errorf("could not use invite: %v", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return errInvalidInvite
+		}
+
+		user.Role = invite.Role
+		if err := tx.Create(&user).Error; err != nil {
+			return fmt.Errorf("could not create user: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Infof("registered user %s with invite %s", email, inviteCode)
+	return &user, nil
+}
+
+// addUser 把邮箱加入允许列表，对应的 GitHub 用户可以直接登录
+func addUser(email, role string) error {
+	email = strings.TrimSpace(email)
+	if !strings.Contains(email, "@") {
+		return fmt.Errorf("invalid email %q", email)
+	}
+	if !validUserRole(role) {
+		return fmt.Errorf("unknown role %q", role)
+	}
+	if _, err := getUser(email); err == nil {
+		return fmt.Errorf("user %s already exists", email)
+	}
+
+	now := time.Now().Unix()
+	if err := globalDB.Create(&User{Email: email, Role: role, CreateAt: now, UpdateAt: now}).Error; err != nil {
+		return fmt.Errorf("could not create user: %v", err)
+	}
+	return nil
+}
+
+func getUserByID(id string) (*User, error) {
+	var user User
+	if err := globalDB.Where("id = ?", id).First(&user).Error; err != nil {
+		return nil, errUserNotFound
+	}
+	return &user, nil
+}
+
+// updateUser 修改角色和停用状态，默认用户必须保持为可用的管理员
+func updateUser(id, role string, disabled bool) error {
+	user, err := getUserByID(id)
+	if err != nil {
+		return err
+	}
+	if !validUserRole(role) {
+		return fmt.Errorf("unknown role %q", role)
+	}
+	if user.Email == DefaultEmail && (role != userRoleAdmin || disabled) {
+		return fmt.Errorf("the default user must stay an active admin")
+	}
+
+	err = globalDB.Model(user).Updates(map[string]interface{}{
+		"role":      role,
+		"disabled":  disabled,
+		"update_at": time.Now().Unix(),
+	}).Error
+	if err != nil {
+		return fmt.Errorf("could not update user: %v", err)
+	}
+	return nil
+}
+
+// deleteUser 删除账号和它的全部数据，共享的条目在没有文章引用后一起清理
+func deleteUser(id string) (string, error) {
+	user, err := getUserByID(id)
+	if err != nil {
+		return "", err
+	}
+	if user.Email == DefaultEmail {
+		return "", fmt.Errorf("the default user cannot be deleted")
+	}
+
+	err = globalDB.Transaction(func(tx *gorm.DB) error {
+		models := []interface{}{&Article{}, &Feed{}, &SavedSearch{}, &Rule{}, &BulkAction{}, &APIToken{}, &UserPreference{}, &AISummary{}, &Category{}}
+		for _, model := range models {
+			if err := tx.Where("email = ?", user.Email).Delete(model).Error; err != nil {
+				return fmt.Errorf("could not delete user data: %v", err)
+			}
+		}
+		if err := tx.Delete(user).Error; err != nil {
+			return fmt.Errorf("could not delete user: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	GlobalMemoryCache.Delete(SceneUserPref, user.Email)
+	pruneSharedStorage()
+	log.Infof("deleted user %s and all of its data", user.Email)
+	return user.Email, nil
+}
+
+type UserStat struct {
+	User
+	FeedCount    int64
+	ArticleCount int64
+	UnreadCount  int64
+}
+
+// getUserStats 返回所有账号以及它们的订阅和文章数量，供管理页面使用
+func getUserStats() ([]UserStat, error) {
+	var users []User
+	if err := globalDB.Order("create_at asc, id asc").Find(&users).Error; err != nil {
+		return nil, fmt.Errorf("could not get users: %v", err)
+	}
+
+	type count struct {
+		Email  string
+		Total  int64
+		Unread int64
+	}
+	var feeds, articles []count
+	if err := globalDB.Model(&Feed{}).Select("email, count(*) AS total").Group("email").Scan(&feeds).Error; err != nil {
+		return nil, fmt.Errorf("could not count feeds: %v", err)
+	}
+	err := globalDB.Model(&Article{}).
+		Select("email, count(*) AS total, sum(CASE WHEN read THEN 0 ELSE 1 END) AS unread").
+		Where("deleted = ?", false).Group("email").Scan(&articles).Error
+	if err != nil {
+		return nil, fmt.Errorf("could not count articles: %v", err)
+	}
+
+	feedCounts := make(map[string]int64, len(feeds))
+	for _, c := range feeds {
+		feedCounts[c.Email] = c.Total
+	}
+	articleCounts := make(map[string]count, len(articles))
+	for _, c := range articles {
+		articleCounts[c.Email] = c
+	}
+
+	stats := make([]UserStat, 0, len(users))
+	for _, user := range users {
+		stats = append(stats, UserStat{
+			User:         user,
+			FeedCount:    feedCounts[user.Email],
+			ArticleCount: articleCounts[user.Email].Total,
+			UnreadCount:  articleCounts[user.Email].Unread,
+		})
+	}
+	return stats, nil
+}
+
+// createInvite 生成邀请码，days 为 0 时不过期
+func createInvite(createdBy, role string, days int) (*Invite, error) {
+	if !validUserRole(role) {
+		return nil, fmt.Errorf("unknown role %q", role)
+	}
+	if days < 0 {
+		return nil, fmt.Errorf("days must not be negative")
+	}
+
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, fmt.Errorf("could not generate invite code: %v", err)
+	}
+
+	now := time.Now()
+	invite := Invite{Code: hex.EncodeToString(buf), Role: role, CreatedBy: createdBy, CreateAt: now.Unix()}
+	if days > 0 {
+		invite.ExpireAt = now.AddDate(0, 0, days).Unix()
+	}
+	if err := globalDB.Create(&invite).Error; err != nil {
+		return nil, fmt.Errorf("could not create invite: %v", err)
+	}
+	return &invite, nil
+}
+
+func getInvites() []Invite {
+	invites := []Invite{}
+	if err := globalDB.Order("create_at desc, id desc").Find(&invites).Error; err != nil {
+		log.Errorf("could not get invites: %v", err)
+		return nil
+	}
+	return invites
+}
+
+func deleteInvite(id string) error {
+	result := globalDB.Where("id = ?", id).Delete(&Invite{})
+	if result.Error != nil {
+		return fmt.Errorf("could not delete invite: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("invite not found")
+	}
+	return nil
+}
+
+// migrateUsers 为已有数据的邮箱创建账号，之前通过 GitHub 登录过的用户升级后仍然可以登录
+func migrateUsers(db *gorm.DB) error {
+	var emails []string
+	err := db.Model(&UserPreference{}).Distinct("email").Where("email <> ''").Pluck("email", &emails).Error
+	if err != nil {
+		return fmt.Errorf("could not load user emails: %v", err)
+	}
+	var feedEmails []string
+	if err := db.Model(&Feed{}).Distinct("email").Where("email <> ''").Pluck("email", &feedEmails).Error; err != nil {
+		return fmt.Errorf("could not load feed emails: %v", err)
+	}
+
+	now := time.Now().Unix()
+	for _, email := range append(append(emails, feedEmails...), DefaultEmail) {
+		role := userRoleMember
+		if email == DefaultEmail {
+			role = userRoleAdmin
+		}
+
+		user := User{Email: email, Role: role, CreateAt: now, UpdateAt: now}
+		if err := db.Where("email = ?", email).FirstOrCreate(&user).Error; err != nil {
+			return fmt.Errorf("could not create user %s: %v", email, err)
+		}
+	}
+	return nil
+}
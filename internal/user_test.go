@@ -0,0 +1,190 @@
+package internal
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestUserAccess(t *testing.T) {
+	db := useTestDB(t)
+
+	// 默认用户不需要预先添加，并且总是管理员
+	if !isAdminUser(DefaultEmail) {
+		t.Fatalf("default user should be admin")
+	}
+	if _, err := loginUser("stranger@example.com", ""); err != errUserNotFound {
+		t.Fatalf("login without invite = %v, want %v", err, errUserNotFound)
+	}
+
+	if err := addUser("alice@example.com", userRoleMember); err != nil {
+		t.Fatalf("addUser() error = %v", err)
+	}
+	if err := addUser("alice@example.com", userRoleMember); err == nil {
+		t.Fatalf("duplicate user should be rejected")
+	}
+	if err := addUser("bob@example.com", "owner"); err == nil {
+		t.Fatalf("unknown role should be rejected")
+	}
+	alice, err := loginUser("alice@example.com", "")
+	if err != nil || alice.LastLoginAt == 0 || isAdminUser(alice.Email) {
+		t.Fatalf("allow-listed login = %+v, %v", alice, err)
+	}
+
+	invite, err := createInvite(DefaultEmail, userRoleReadOnly, 0)
+	if err != nil {
+		t.Fatalf("createInvite() error = %v", err)
+	}
+	bob, err := loginUser("bob@example.com", invite.Code)
+	if err != nil || bob.Role != userRoleReadOnly {
+		t.Fatalf("invite login = %+v, %v", bob, err)
+	}
+	if _, err := loginUser("carol@example.com", invite.Code); err != errInvalidInvite {
+		t.Fatalf("reused invite = %v, want %v", err, errInvalidInvite)
+	}
+	expired, _ := createInvite(DefaultEmail, userRoleMember, 1)
+	db.Model(expired).Update("expire_at", time.Now().Add(-time.Minute).Unix())
+	if _, err := loginUser("carol@example.com", expired.Code); err != errInvalidInvite {
+		t.Fatalf("expired invite = %v, want %v", err, errInvalidInvite)
+	}
+	if userCanWrite(bob.Email) || !userCanWrite(alice.Email) {
+		t.Fatalf("only read-only accounts should be blocked from writing")
+	}
+
+	// 停用后不能登录，令牌也失效
+	token, _ := createAPIToken(alice.Email, "phone", apiScopeWrite)
+	if err := updateUser(strconv.FormatInt(alice.ID, 10), userRoleMember, true); err != nil {
+		t.Fatalf("updateUser() error = %v", err)
+	}
+	if _, err := loginUser(alice.Email, ""); err != errUserDisabled {
+		t.Fatalf("disabled login = %v, want %v", err, errUserDisabled)
+	}
+	if _, err := authenticateAPIToken(token); err == nil {
+		t.Fatalf("tokens of disabled users should be rejected")
+	}
+
+	admin, _ := getUser(DefaultEmail)
+	if err := updateUser(strconv.FormatInt(admin.ID, 10), userRoleMember, false); err == nil {
+		t.Fatalf("default user should stay admin")
+	}
+	if _, err := deleteUser(strconv.FormatInt(admin.ID, 10)); err == nil {
+		t.Fatalf("default user should not be deleted")
+	}
+}
+
+func TestDeleteUser(t *testing.T) {
+	db := useTestDB(t)
+
+	email := "alice@example.com"
+	if err := addUser(email, userRoleMember); err != nil {
+		t.Fatalf("addUser() error = %v", err)
+	}
+	feedID, _ := getSetFeed("https://example.com/feed", email, "Example", 0)
+	otherFeed, _ := getSetFeed("https://example.com/feed", DefaultEmail, "Example", 0)
+	db.Create(&Entry{ID: 1, GUID: "shared"})
+	db.Create(&Entry{ID: 2, GUID: "only-alice"})
+	db.Create(&[]Article{
+		{Uid: "a1", Email: email, FeedID: feedID, GUID: "shared", EntryID: 1},
+		{Uid: "a2", Email: email, FeedID: feedID, GUID: "only-alice", EntryID: 2, Read: true},
+		{Uid: "d1", Email: DefaultEmail, FeedID: otherFeed, GUID: "shared", EntryID: 1},
+	})
+	createAPIToken(email, "phone", apiScopeWrite)
+	getUserPreference(email)
+
+	stats, err := getUserStats()
+	if err != nil {
+		t.Fatalf("getUserStats() error = %v", err)
+	}
+	var found bool
+	for _, stat := range stats {
+		if stat.Email == email {
+			found = stat.FeedCount == 1 && stat.ArticleCount == 2 && stat.UnreadCount == 1
+		}
+	}
+	if !found {
+		t.Fatalf("stats = %+v", stats)
+	}
+
+	user, _ := getUser(email)
+	if _, err := deleteUser(strconv.FormatInt(user.ID, 10)); err != nil {
+		t.Fatalf("deleteUser() error = %v", err)
+	}
+
+	for _, model := range []interface{}{&Article{}, &Feed{}, &APIToken{}, &UserPreference{}, &User{}} {
+		var count int64
+		db.Model(model).Where("email = ?", email).Count(&count)
+		if count != 0 {
+			t.Fatalf("%T rows left after delete: %d", model, count)
+		}
+	}
+	var entries []Entry
+	db.Find(&entries)
+	if len(entries) != 1 || entries[0].ID != 1 {
+		t.Fatalf("only entries still used by others should be kept: %+v", entries)
+	}
+}
+
+func TestReadOnlyUserAPI(t *testing.T) {
+	useTestDB(t)
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+	registerAPIRoutes(r.Group("/api/v1", apiAuth))
+
+	email := "bob@example.com"
+	if err := addUser(email, userRoleReadOnly); err != nil {
+		t.Fatalf("addUser() error = %v", err)
+	}
+	token, _ := createAPIToken(email, "script", apiScopeWrite)
+
+	call := func(method, path string) int {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(`{"name": "Podcasts"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// 可写的令牌也受账号角色限制
+	if code := call("GET", "/api/v1/feeds"); code != http.StatusOK {
+		t.Fatalf("GET = %d, want 200", code)
+	}
+	if code := call("POST", "/api/v1/categories"); code != http.StatusForbidden {
+		t.Fatalf("POST = %d, want 403", code)
+	}
+}
+
+func TestMigrateUsers(t *testing.T) {
+	db := useTestDB(t)
+
+	getSetFeed("https://example.com/feed", "alice@example.com", "Example", 0)
+	db.Create(&UserPreference{Email: "bob@example.com"})
+
+	if err := migrateUsers(db); err != nil {
+		t.Fatalf("migrateUsers() error = %v", err)
+	}
+	if err := migrateUsers(db); err != nil {
+		t.Fatalf("migrateUsers() second run error = %v", err)
+	}
+
+	var users []User
+	db.Order("email").Find(&users)
+	if len(users) != 3 {
+		t.Fatalf("users = %+v", users)
+	}
+	for _, user := range users {
+		want := userRoleMember
+		if user.Email == DefaultEmail {
+			want = userRoleAdmin
+		}
+		if user.Role != want {
+			t.Fatalf("user %s role = %s, want %s", user.Email, user.Role, want)
+		}
+	}
+}
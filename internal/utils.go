@@ -1,6 +1,13 @@
 package internal
 
-import "os"
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
 
 func orenv(key string, fallback string) string {
 	if v, ok := os.LookupEnv(key); ok {
@@ -9,3 +16,43 @@ func orenv(key string, fallback string) string {
 
 	return fallback
 }
+
+func orenvInt(key string, fallback int) int {
+	v, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		return fallback
+	}
+
+	return n
+}
+
+// requestParam 依次从查询参数和表单中取值，第三方客户端的方法不一样
+func requestParam(c *gin.Context, name string) string {
+	if value, ok := c.GetQuery(name); ok {
+		return value
+	}
+	return c.PostForm(name)
+}
+
+func requestParams(c *gin.Context, name string) []string {
+	values := c.QueryArray(name)
+	return append(values, c.PostFormArray(name)...)
+}
+
+// linkOrigin 返回链接的 scheme://host，没有保存站点地址时用来代替
+func linkOrigin(link string) string {
+	u, err := url.Parse(link)
+	if err != nil || u.Host == "" {
+		return link
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+func isReadMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead
+}
@@ -0,0 +1,296 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"gorm.io/gorm"
+)
+
+const (
+	WebSubStatePending    = "pending"
+	WebSubStateSubscribed = "subscribed"
+	WebSubStateDenied     = "denied"
+
+	websubLeaseSeconds = 10 * 24 * 3600
+	// 租约到期前提前续订
+	websubRenewBefore = 24 * time.Hour
+	// 订阅请求发出后长时间没有收到验证，重新发起
+	websubPendingTimeout = time.Hour
+	// 推送内容大小上限
+	websubMaxPushSize = 10 << 20
+)
+
+var errWebSubUnknownSource = errors.New("unknown websub source")
+
+func websubCallbackURL(sourceID int64) string {
+	return fmt.Sprintf("%s/websub/%d", strings.TrimRight(SiteURL, "/"), sourceID)
+}
+
+// websubTopic 优先使用 feed 声明的 self 链接，hub 以它作为 topic
+func websubTopic(src *Source) string {
+	if src.Topic != "" {
+		return src.Topic
+	}
+	return src.URL
+}
+
+// updateSourceHub 记录抓取时发现的 hub，hub 或 topic 变化时重置订阅状态，由续订任务重新订阅
+func updateSourceHub(sourceID int64, hub, topic string) error {
+	err := globalDB.Model(&Source{}).
+		Where("id = ? AND (COALESCE(hub, '') <> ? OR COALESCE(topic, '') <> ?)", sourceID, hub, topic).
+		Updates(map[string]interface{}{
+			"hub":               hub,
+			"topic":             topic,
+			"websub_state":      "",
+			"websub_expires_at": 0,
+		}).Error
+	if err != nil {
+		return fmt.Errorf("could not update source hub: %v", err)
+	}
+	return nil
+}
+
+// websubNeedsSubscribe 判断 source 是否需要向 hub 发起（续）订阅
+func websubNeedsSubscribe(src *Source, now time.Time) bool {
+	if src.Hub == "" {
+		return false
+	}
+
+	requestedAt := time.Unix(src.WebSubRequestedAt, 0)
+	switch src.WebSubState {
+	case WebSubStatePending:
+		return now.Sub(requestedAt) >= websubPendingTimeout
+	case WebSubStateSubscribed:
+		return !now.Before(time.Unix(src.WebSubExpiresAt, 0).Add(-websubRenewBefore))
+	case WebSubStateDenied:
+		return now.Sub(requestedAt) >= feedMaxInterval
+	default:
+		return true
+	}
+}
+
+// renewWebSubSubscriptions 为新发现 hub 的 source 发起订阅，并在租约到期前续订
+func renewWebSubSubscriptions(ctx context.Context) {
+	if SiteURL == "" {
+		return
+	}
+
+	var sources []Source
+	if err := globalDB.Where("hub IS NOT NULL AND hub <> ''").Find(&sources).Error; err != nil {
+		log.Errorf("could not get websub sources: %v", err)
+		return
+	}
+
+	now := time.Now()
+	for i := range sources {
+		if !websubNeedsSubscribe(&sources[i], now) {
+			continue
+		}
+		if err := subscribeWebSub(ctx, &sources[i]); err != nil {
+			log.Errorf("could not subscribe to hub %s for %s: %v", sources[i].Hub, sources[i].URL, err)
+		}
+	}
+}
+
+// subscribeWebSub 向 hub 发送订阅请求，hub 会异步回调 callback 验证意图
+func subscribeWebSub(ctx context.Context, src *Source) error {
+	secret := src.WebSubSecret
+	if secret == "" {
+		buf := make([]byte, 32)
+		if _, err := rand.Read(buf); err != nil {
+			return fmt.Errorf("could not generate secret: %v", err)
+		}
+		secret = hex.EncodeToString(buf)
+	}
+
+	// 先保存 secret，hub 可能在请求返回前就完成验证并开始推送
+	err := globalDB.Model(&Source{}).Where("id = ?", src.ID).Updates(map[string]interface{}{
+		"websub_secret":       secret,
+		"websub_state":        WebSubStatePending,
+		"websub_requested_at": time.Now().Unix(),
+	}).Error
+	if err != nil {
+		return fmt.Errorf("could not update websub state: %v", err)
+	}
+
+	form := url.Values{
+		"hub.callback":      {websubCallbackURL(src.ID)},
+		"hub.mode":          {"subscribe"},
+		"hub.topic":         {websubTopic(src)},
+		"hub.secret":        {secret},
+		"hub.lease_seconds": {strconv.Itoa(websubLeaseSeconds)},
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, feedFetchTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, src.Hub, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("could not create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("User-Agent", feedUserAgent)
+
+	resp, err := feedHTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("could not send subscription request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected hub status: %s", resp.Status)
+	}
+
+	log.Infof("websub subscription requested: %s via %s", websubTopic(src), src.Hub)
+	return nil
+}
+
+// verifyWebSubIntent 处理 hub 的意图验证，只确认我们自己发起过的订阅
+func verifyWebSubIntent(sourceID int64, mode, topic string, leaseSeconds int) error {
+	var src Source
+	if err := globalDB.Where("id = ?", sourceID).First(&src).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errWebSubUnknownSource
+		}
+		return fmt.Errorf("could not get source: %v", err)
+	}
+
+	if topic != websubTopic(&src) {
+		return fmt.Errorf("topic mismatch: %s", topic)
+	}
+
+	switch mode {
+	case "subscribe":
+		if src.Hub == "" || (src.WebSubState != WebSubStatePending && src.WebSubState != WebSubStateSubscribed) {
+			return fmt.Errorf("no pending subscription for %s", topic)
+		}
+		if leaseSeconds <= 0 {
+			leaseSeconds = websubLeaseSeconds
+		}
+		err := globalDB.Model(&Source{}).Where("id = ?", src.ID).Updates(map[string]interface{}{
+			"websub_state":      WebSubStateSubscribed,
+			"websub_expires_at": time.Now().Add(time.Duration(leaseSeconds) * time.Second).Unix(),
+		}).Error
+		if err != nil {
+			return fmt.Errorf("could not update websub state: %v", err)
+		}
+		log.Infof("websub subscription verified: %s, lease %ds", topic, leaseSeconds)
+		return nil
+	case "denied":
+		log.Infof("websub subscription denied: %s", topic)
+		return globalDB.Model(&Source{}).Where("id = ?", src.ID).Update("websub_state", WebSubStateDenied).Error
+	default:
+		// 我们不会主动退订，其他 mode 一律拒绝
+		return fmt.Errorf("unexpected mode: %s", mode)
+	}
+}
+
+// receiveWebSubPush 校验推送内容的 HMAC 签名后，复用轮询的保存逻辑写入文章。
+// 签名不匹配时按规范仍返回成功，但忽略内容
+func receiveWebSubPush(sourceID int64, body []byte, signature string) error {
+	var src Source
+	if err := globalDB.Where("id = ?", sourceID).First(&src).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errWebSubUnknownSource
+		}
+		return fmt.Errorf("could not get source: %v", err)
+	}
+
+	if src.WebSubSecret == "" || !validWebSubSignature(src.WebSubSecret, body, signature) {
+		log.Errorf("ignoring websub push with invalid signature for %s", src.URL)
+		return nil
+	}
+
+	feed, err := newFeedParser().Parse(bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("could not parse pushed feed: %v", err)
+	}
+
+	var feeds []*Feed
+	if err := globalDB.Where("source_id = ? AND email <> ''", src.ID).Find(&feeds).Error; err != nil {
+		return fmt.Errorf("could not get subscribers: %v", err)
+	}
+	if len(feeds) == 0 {
+		return nil
+	}
+
+	log.Infof("websub push received: %s, %d items", src.URL, len(feed.Items))
+	return saveFeedGroupResult(src.URL, feeds, &fetchResult{Feed: feed, StatusCode: http.StatusOK, Pushed: true})
+}
+
+// validWebSubSignature 校验 X-Hub-Signature 头，格式为 method=hex
+func validWebSubSignature(secret string, body []byte, signature string) bool {
+	method, sig, ok := strings.Cut(signature, "=")
+	if !ok {
+		return false
+	}
+
+	var newHash func() hash.Hash
+	switch strings.ToLower(method) {
+	case "sha1":
+		newHash = sha1.New
+	case "sha256":
+		newHash = sha256.New
+	case "sha384":
+		newHash = sha512.New384
+	case "sha512":
+		newHash = sha512.New
+	default:
+		return false
+	}
+
+	expected, err := hex.DecodeString(sig)
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(newHash, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(mac.Sum(nil), expected)
+}
+
+// getWebSubActiveSourceIDs 返回租约仍有效的 source
+func getWebSubActiveSourceIDs(now time.Time) map[int64]struct{} {
+	var ids []int64
+	err := globalDB.Model(&Source{}).
+		Where("websub_state = ? AND websub_expires_at > ?", WebSubStateSubscribed, now.Unix()).
+		Pluck("id", &ids).Error
+	if err != nil {
+		log.Errorf("could not get websub sources: %v", err)
+	}
+
+	active := make(map[int64]struct{}, len(ids))
+	for _, id := range ids {
+		active[id] = struct{}{}
+	}
+	return active
+}
+
+// websubPollFilter 跳过已经通过 WebSub 推送的分组，只保留每 feedMaxInterval 一次的兜底轮询
+func websubPollFilter(now time.Time, active map[int64]struct{}, next func(*feedGroup) bool) func(*feedGroup) bool {
+	return func(group *feedGroup) bool {
+		for _, fd := range group.Feeds {
+			_, pushed := active[fd.SourceID]
+			if !pushed || now.Sub(time.Unix(fd.LastFetchedAt, 0)) >= feedMaxInterval {
+				return next(group)
+			}
+		}
+		return false
+	}
+}
@@ -0,0 +1,161 @@
+package internal
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func signWebSub(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestValidWebSubSignature(t *testing.T) {
+	body := []byte("<feed/>")
+
+	if !validWebSubSignature("secret", body, signWebSub("secret", body)) {
+		t.Fatalf("valid sha256 signature rejected")
+	}
+	for _, sig := range []string{
+		"",
+		"sha256",
+		"md5=00",
+		"sha256=zz",
+		signWebSub("other", body),
+	} {
+		if validWebSubSignature("secret", body, sig) {
+			t.Fatalf("signature %q should be rejected", sig)
+		}
+	}
+}
+
+func TestFetchFeedDiscoversHub(t *testing.T) {
+	const atomFeed = `<?xml version="1.0"?>
+<feed xmlns="http://www.w3.org/2005/Atom"><title>Test</title>
+<link rel="hub" href="https://hub.example.com/"/>
+<link rel="self" href="https://example.com/atom.xml"/>
+</feed>`
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/header" {
+			w.Header().Add("Link", `<https://push.example.com/>; rel="hub", <https://example.com/header.xml>; rel="self"`)
+		}
+		w.Write([]byte(atomFeed))
+	}))
+	defer server.Close()
+
+	for path, want := range map[string][2]string{
+		"/atom":   {"https://hub.example.com/", "https://example.com/atom.xml"},
+		"/header": {"https://push.example.com/", "https://example.com/header.xml"},
+	} {
+		result, err := fetchFeed(context.Background(), &Feed{URL: server.URL + path})
+		if err != nil {
+			t.Fatalf("fetchFeed(%s) error = %v", path, err)
+		}
+		if result.Hub != want[0] || result.Topic != want[1] {
+			t.Fatalf("fetchFeed(%s) hub, topic = %q, %q, want %q, %q", path, result.Hub, result.Topic, want[0], want[1])
+		}
+	}
+}
+
+func TestWebSubSubscribeVerifyAndPush(t *testing.T) {
+	db := useTestDB(t)
+
+	oldSiteURL := SiteURL
+	SiteURL = "https://rssy.example.com"
+	t.Cleanup(func() { SiteURL = oldSiteURL })
+
+	requests := make(chan url.Values, 1)
+	hub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		requests <- r.PostForm
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer hub.Close()
+
+	feedID, err := getSetFeed("https://example.com/feed", "alice@example.com", "Example", time.Now().Add(-time.Hour).Unix())
+	if err != nil {
+		t.Fatalf("getSetFeed() error = %v", err)
+	}
+	var fd Feed
+	db.First(&fd, feedID)
+	if err := updateSourceHub(fd.SourceID, hub.URL, "https://example.com/self"); err != nil {
+		t.Fatalf("updateSourceHub() error = %v", err)
+	}
+
+	renewWebSubSubscriptions(context.Background())
+
+	form := <-requests
+	if form.Get("hub.mode") != "subscribe" || form.Get("hub.topic") != "https://example.com/self" ||
+		form.Get("hub.callback") != fmt.Sprintf("https://rssy.example.com/websub/%d", fd.SourceID) {
+		t.Fatalf("unexpected subscription request: %v", form)
+	}
+	secret := form.Get("hub.secret")
+
+	if err := verifyWebSubIntent(fd.SourceID, "subscribe", "https://example.com/other", 3600); err == nil {
+		t.Fatalf("intent with a different topic should be rejected")
+	}
+	if err := verifyWebSubIntent(fd.SourceID, "unsubscribe", "https://example.com/self", 0); err == nil {
+		t.Fatalf("unsubscribe we did not request should be rejected")
+	}
+	if err := verifyWebSubIntent(fd.SourceID, "subscribe", "https://example.com/self", 3600); err != nil {
+		t.Fatalf("verifyWebSubIntent() error = %v", err)
+	}
+	if _, ok := getWebSubActiveSourceIDs(time.Now())[fd.SourceID]; !ok {
+		t.Fatalf("source should be active after verification")
+	}
+
+	body := []byte(fmt.Sprintf(`<?xml version="1.0"?>
+<rss version="2.0"><channel><title>Example</title>
+<item><guid>pushed-1</guid><title>Pushed</title><pubDate>%s</pubDate></item>
+</channel></rss>`, time.Now().UTC().Format(time.RFC1123Z)))
+
+	if err := receiveWebSubPush(fd.SourceID, body, signWebSub("wrong", body)); err != nil {
+		t.Fatalf("receiveWebSubPush() with bad signature error = %v", err)
+	}
+	if got, _ := getRecentlyArticles("alice@example.com", false, ""); len(got) != 0 {
+		t.Fatalf("push with bad signature should be ignored, got %+v", got)
+	}
+
+	if err := receiveWebSubPush(fd.SourceID, body, signWebSub(secret, body)); err != nil {
+		t.Fatalf("receiveWebSubPush() error = %v", err)
+	}
+	if got, _ := getRecentlyArticles("alice@example.com", false, ""); len(got) != 1 || got[0].Title != "Pushed" {
+		t.Fatalf("pushed article not saved, got %+v", got)
+	}
+
+	if err := receiveWebSubPush(fd.SourceID+1, body, ""); err != errWebSubUnknownSource {
+		t.Fatalf("push for unknown source error = %v", err)
+	}
+}
+
+func TestWebSubPollFilter(t *testing.T) {
+	now := time.Now()
+	active := map[int64]struct{}{1: {}}
+	always := func(*feedGroup) bool { return true }
+	filter := websubPollFilter(now, active, always)
+
+	pushed := &feedGroup{Feeds: []*Feed{{SourceID: 1, LastFetchedAt: now.Add(-time.Hour).Unix()}}}
+	if filter(pushed) {
+		t.Fatalf("pushed source should not be polled")
+	}
+
+	stale := &feedGroup{Feeds: []*Feed{{SourceID: 1, LastFetchedAt: now.Add(-feedMaxInterval).Unix()}}}
+	if !filter(stale) {
+		t.Fatalf("pushed source should still be polled once per %s", feedMaxInterval)
+	}
+
+	polled := &feedGroup{Feeds: []*Feed{{SourceID: 2}}}
+	if !filter(polled) {
+		t.Fatalf("source without hub should be polled")
+	}
+}